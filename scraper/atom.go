@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	atomNS           = "http://www.w3.org/2005/Atom"
+	defaultFeedLimit = 50
+	maxFeedLimit     = 500
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link,omitempty"`
+	Categories []atomCategory `xml:"category,omitempty"`
+	Summary    string         `xml:"summary"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// newlyAnnounced returns the latest snapshot of each event, newest
+// announcement first.
+func newlyAnnounced(events []PerformanceEvent, limit int) []PerformanceEvent {
+	out := latestSnapshots(events)
+	sort.SliceStable(out, func(i, j int) bool {
+		ti, tj := storedTime(out[i].FirstSeenAt), storedTime(out[j].FirstSeenAt)
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return eventKey(out[i]) < eventKey(out[j])
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// WriteAtomFeed writes events, as returned by newlyAnnounced, as an Atom
+// feed. id distinguishes the feed variant and selfURL is where it is served.
+func WriteAtomFeed(w io.Writer, id, title, selfURL string, events []PerformanceEvent) error {
+	feed := atomFeed{
+		NS:      atomNS,
+		ID:      "urn:violetta-opera-graph:feed:" + id,
+		Title:   title,
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "Violetta Opera Graph"},
+	}
+	if selfURL != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "self", Href: selfURL})
+	}
+
+	for _, ev := range events {
+		published := storedTime(ev.FirstSeenAt).UTC().Format(time.RFC3339)
+		updated := published
+		if scraped := storedTime(ev.ScrapedAt); scraped.After(storedTime(ev.FirstSeenAt)) {
+			updated = scraped.UTC().Format(time.RFC3339)
+		}
+		if updated > feed.Updated {
+			feed.Updated = updated
+		}
+
+		entry := atomEntry{
+			ID:        "urn:violetta-opera-graph:event:" + eventKey(ev),
+			Title:     ev.Title,
+			Published: published,
+			Updated:   updated,
+			Summary:   atomSummary(ev),
+		}
+		if ev.VenueName != "" {
+			entry.Title += " – " + ev.VenueName
+		}
+		if ev.SourceURL != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "alternate", Href: ev.SourceURL})
+		}
+		for _, term := range []string{ev.Region, ev.VenueCode, ev.Composer} {
+			if term != "" {
+				entry.Categories = append(entry.Categories, atomCategory{Term: term})
+			}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
+
+// atomSummary is the plain-text listing an editor would copy: what, who,
+// where and when.
+func atomSummary(ev PerformanceEvent) string {
+	var lines []string
+	if ev.Composer != "" {
+		lines = append(lines, fmt.Sprintf("%s by %s", ev.Title, ev.Composer))
+	} else {
+		lines = append(lines, ev.Title)
+	}
+	var where []string
+	for _, part := range []string{ev.VenueName, ev.City, ev.State} {
+		if part != "" {
+			where = append(where, part)
+		}
+	}
+	if len(where) > 0 {
+		lines = append(lines, strings.Join(where, ", "))
+	}
+	if len(ev.Dates) > 0 {
+		lines = append(lines, strings.Join(ev.Dates, "; "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// feedVariant names a filtered feed for its Atom ID, e.g.
+// "region=socal;venue=laopera", so each variant has a stable identity.
+func feedVariant(f EventFilter) string {
+	var parts []string
+	for _, p := range []struct {
+		name   string
+		values []string
+	}{
+		{"region", f.Regions}, {"venue", f.Venues}, {"composer", f.Composers}, {"opera", f.Operas},
+	} {
+		if len(p.values) == 0 {
+			continue
+		}
+		values := make([]string, len(p.values))
+		for i, v := range p.values {
+			values[i] = url.QueryEscape(strings.ToLower(v))
+		}
+		sort.Strings(values)
+		parts = append(parts, p.name+"="+strings.Join(values, ","))
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, ";")
+}
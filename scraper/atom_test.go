@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"testing"
+)
+
+func TestNewlyAnnounced(t *testing.T) {
+	events := []PerformanceEvent{
+		// Two daily snapshots of the same event: the feed keeps the later
+		// details but the earlier first-seen time.
+		{EventID: "tosca", VenueCode: "laopera", Title: "Tosca", ScrapedAt: "2026-09-01T10:00:00Z", FirstSeenAt: "2026-09-01T10:00:00Z"},
+		{EventID: "tosca", VenueCode: "laopera", Title: "Tosca (updated)", ScrapedAt: "2026-09-10T10:00:00Z", FirstSeenAt: "2026-09-01T10:00:00Z"},
+		// Stored before first-seen tracking: falls back to scraped_at.
+		{EventID: "carmen", VenueCode: "laopera", Title: "Carmen", ScrapedAt: "2026-09-05T10:00:00Z"},
+		// Same event ID at another venue is a different event.
+		{EventID: "tosca", VenueCode: "sandiegoopera", Title: "Tosca", ScrapedAt: "2026-09-03T10:00:00Z", FirstSeenAt: "2026-09-03T10:00:00Z"},
+	}
+
+	got := newlyAnnounced(events, 0)
+	want := []struct{ key, title, firstSeen string }{
+		{"laopera:carmen", "Carmen", "2026-09-05T10:00:00Z"},
+		{"sandiegoopera:tosca", "Tosca", "2026-09-03T10:00:00Z"},
+		{"laopera:tosca", "Tosca (updated)", "2026-09-01T10:00:00Z"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if eventKey(got[i]) != w.key || got[i].Title != w.title || got[i].FirstSeenAt != w.firstSeen {
+			t.Errorf("entry %d = %s %q %s, want %s %q %s", i, eventKey(got[i]), got[i].Title, got[i].FirstSeenAt, w.key, w.title, w.firstSeen)
+		}
+	}
+
+	if got := newlyAnnounced(events, 1); len(got) != 1 || got[0].EventID != "carmen" {
+		t.Errorf("limit 1 = %+v", got)
+	}
+}
+
+func TestWriteAtomFeed(t *testing.T) {
+	events := newlyAnnounced([]PerformanceEvent{{
+		EventID:     "tosca",
+		VenueCode:   "laopera",
+		Region:      "socal",
+		Title:       "Tosca",
+		Composer:    "Giacomo Puccini",
+		Dates:       []string{"2026-11-08 7:30 PM"},
+		VenueName:   "Dorothy Chandler Pavilion",
+		SourceURL:   "https://www.laopera.org/tosca?x=1&y=2",
+		ScrapedAt:   "2026-09-10T10:00:00Z",
+		FirstSeenAt: "2026-09-01T10:00:00Z",
+	}}, 0)
+
+	var buf bytes.Buffer
+	q, _ := url.ParseQuery("region=socal&composer=Giacomo Puccini")
+	if err := WriteAtomFeed(&buf, feedVariant(ParseEventFilter(q)), "Opera in socal", "http://localhost:8080/api/feed.atom?region=socal", events); err != nil {
+		t.Fatal(err)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &feed); err != nil {
+		t.Fatalf("feed is not valid XML: %v\n%s", err, buf.String())
+	}
+	if feed.ID != "urn:violetta-opera-graph:feed:region=socal;composer=giacomo+puccini" {
+		t.Errorf("feed id = %q", feed.ID)
+	}
+	if feed.Updated != "2026-09-10T10:00:00Z" {
+		t.Errorf("feed updated = %q", feed.Updated)
+	}
+	if len(feed.Entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(feed.Entries))
+	}
+	e := feed.Entries[0]
+	if e.ID != "urn:violetta-opera-graph:event:laopera:tosca" || e.Published != "2026-09-01T10:00:00Z" || e.Updated != "2026-09-10T10:00:00Z" {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.Title != "Tosca – Dorothy Chandler Pavilion" || len(e.Links) != 1 || e.Links[0].Href != "https://www.laopera.org/tosca?x=1&y=2" {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.Summary != "Tosca by Giacomo Puccini\nDorothy Chandler Pavilion\n2026-11-08 7:30 PM" {
+		t.Errorf("summary = %q", e.Summary)
+	}
+}
+
+func TestFirstSeenStore(t *testing.T) {
+	dataDir := t.TempDir()
+
+	first := []PerformanceEvent{{EventID: "tosca", VenueCode: "laopera", ScrapedAt: "2026-09-01T10:00:00Z"}}
+	NewFirstSeenStore(dataDir).Stamp(first)
+
+	later := []PerformanceEvent{
+		{EventID: "tosca", VenueCode: "laopera", ScrapedAt: "2026-09-10T10:00:00Z"},
+		{EventID: "carmen", VenueCode: "laopera", ScrapedAt: "2026-09-10T10:00:00Z"},
+	}
+	NewFirstSeenStore(dataDir).Stamp(later)
+
+	if later[0].FirstSeenAt != "2026-09-01T10:00:00Z" {
+		t.Errorf("tosca first seen = %q, want the first run's time", later[0].FirstSeenAt)
+	}
+	if later[1].FirstSeenAt != "2026-09-10T10:00:00Z" {
+		t.Errorf("carmen first seen = %q, want this run's time", later[1].FirstSeenAt)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is what a caller may do. Each role may do everything the ones
+// before it may.
+type Role int
+
+const (
+	RolePublic Role = iota
+	RoleViewer
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "public"
+}
+
+func parseRole(s string) (Role, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer":
+		return RoleViewer, true
+	case "admin":
+		return RoleAdmin, true
+	}
+	return RolePublic, false
+}
+
+// AuthConfig is the auth section of config.yaml.
+type AuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Let anyone read events, productions, feeds and search; everything else
+	// needs at least a viewer.
+	PublicRead bool `yaml:"public_read"`
+	// File of "<role> <token>" lines, relative to config.yaml. Tokens are
+	// also read from $VIOLETTA_ADMIN_TOKENS and $VIOLETTA_VIEWER_TOKENS.
+	TokensFile   string       `yaml:"tokens_file"`
+	SessionHours int          `yaml:"session_hours"`
+	Users        []UserConfig `yaml:"users"`
+}
+
+// UserConfig is a local account. PasswordHash is a bcrypt hash, as printed
+// by `scraper hash-password`.
+type UserConfig struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"password_hash"`
+	Role         string `yaml:"role"`
+}
+
+const (
+	sessionCookie = "violetta_session"
+	// Tokens shorter than this are ignored as too easy to guess.
+	minTokenLength = 16
+)
+
+var errBadCredentials = errors.New("invalid username or password")
+
+// Principal is who made a request.
+type Principal struct {
+	Name string `json:"user,omitempty"`
+	Role Role   `json:"-"`
+}
+
+type session struct {
+	Principal
+	expires time.Time
+}
+
+// Auth checks API tokens and session cookies against the roles routes
+// require. While disabled every request is let through.
+type Auth struct {
+	mu         sync.RWMutex
+	enabled    bool
+	publicRead bool
+	tokens     map[[32]byte]Principal // by SHA-256 of the token
+	users      map[string]UserConfig
+	sessionTTL time.Duration
+	sessions   map[string]session
+}
+
+func NewAuth() *Auth {
+	return &Auth{tokens: map[[32]byte]Principal{}, users: map[string]UserConfig{}, sessions: map[string]session{}}
+}
+
+// Configure replaces the tokens, users and settings. Sessions of users
+// that are gone or whose role changed end.
+func (a *Auth) Configure(cfg AuthConfig, configDir string) {
+	tokens := map[[32]byte]Principal{}
+	add := func(role Role, token, from string) {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return
+		}
+		if len(token) < minTokenLength {
+			log.Printf("Warning: ignoring %s token from %s shorter than %d characters", role, from, minTokenLength)
+			return
+		}
+		tokens[sha256.Sum256([]byte(token))] = Principal{Name: role.String() + " token", Role: role}
+	}
+	for _, t := range strings.Split(os.Getenv("VIOLETTA_VIEWER_TOKENS"), ",") {
+		add(RoleViewer, t, "$VIOLETTA_VIEWER_TOKENS")
+	}
+	for _, t := range strings.Split(os.Getenv("VIOLETTA_ADMIN_TOKENS"), ",") {
+		add(RoleAdmin, t, "$VIOLETTA_ADMIN_TOKENS")
+	}
+	if cfg.TokensFile != "" {
+		path := cfg.TokensFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		if err := readTokens(path, add); err != nil {
+			log.Printf("Warning: failed to read tokens: %v", err)
+		}
+	}
+
+	users := map[string]UserConfig{}
+	for _, u := range cfg.Users {
+		users[strings.ToLower(u.Username)] = u
+	}
+	ttl := time.Duration(cfg.SessionHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.enabled = cfg.Enabled
+	a.publicRead = cfg.PublicRead
+	a.tokens = tokens
+	a.users = users
+	a.sessionTTL = ttl
+	for id, sess := range a.sessions {
+		u, ok := users[strings.ToLower(sess.Name)]
+		if role, _ := parseRole(u.Role); !ok || role != sess.Role {
+			delete(a.sessions, id)
+		}
+	}
+	if cfg.Enabled && len(tokens) == 0 && len(users) == 0 {
+		log.Printf("Warning: auth is enabled but no tokens or users are configured; only public routes are open")
+	}
+}
+
+// readTokens passes each "<role> <token>" line of path to add, skipping
+// blank lines and # comments.
+func readTokens(path string, add func(role Role, token, from string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		role, ok := parseRole(fields[0])
+		if len(fields) != 2 || !ok {
+			log.Printf("Warning: %s:%d: want \"viewer <token>\" or \"admin <token>\"", path, n)
+			continue
+		}
+		add(role, fields[1], path)
+	}
+	return scanner.Err()
+}
+
+func (a *Auth) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.enabled
+}
+
+// Identify returns who made r, from a bearer token or a session cookie.
+// Anyone else is RolePublic.
+func (a *Auth) Identify(r *http.Request) Principal {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if token := bearerToken(r); token != "" {
+		if p, ok := a.tokens[sha256.Sum256([]byte(token))]; ok {
+			return p
+		}
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if sess, ok := a.sessions[c.Value]; ok && time.Now().Before(sess.expires) {
+			return sess.Principal
+		}
+	}
+	return Principal{}
+}
+
+// bearerToken returns the token in r's Authorization header, if any.
+func bearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// Require wraps h so that GET and HEAD requests need the read role and
+// all others the write role. Routes that are public to read need a viewer
+// unless public_read is set.
+func (a *Auth) Require(read, write Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.mu.RLock()
+		enabled, publicRead := a.enabled, a.publicRead
+		a.mu.RUnlock()
+		if !enabled {
+			h(w, r)
+			return
+		}
+		need := write
+		if r.Method == "GET" || r.Method == "HEAD" {
+			need = read
+		}
+		if need == RolePublic && !publicRead {
+			need = RoleViewer
+		}
+		p := a.Identify(r)
+		switch {
+		case p.Role >= need:
+			h(w, r)
+		case p.Role == RolePublic:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="violetta"`)
+			http.Error(w, "Authentication required", 401)
+		default:
+			http.Error(w, "Forbidden: needs the "+need.String()+" role", 403)
+		}
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// Login checks a user's password and starts a session, returning its ID.
+func (a *Auth) Login(username, password string) (string, session, error) {
+	a.mu.RLock()
+	u, ok := a.users[strings.ToLower(username)]
+	ttl := a.sessionTTL
+	a.mu.RUnlock()
+
+	hash := []byte(u.PasswordHash)
+	if !ok {
+		// Compare anyway so unknown users take as long as known ones.
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("violetta"), bcrypt.DefaultCost)
+		})
+		hash = dummyHash
+	}
+	role, validRole := parseRole(u.Role)
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok || !validRole {
+		return "", session{}, errBadCredentials
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", session{}, err
+	}
+	id := hex.EncodeToString(b)
+	sess := session{Principal: Principal{Name: u.Username, Role: role}, expires: time.Now().Add(ttl)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for old, s := range a.sessions {
+		if now.After(s.expires) {
+			delete(a.sessions, old)
+		}
+	}
+	a.sessions[id] = sess
+	return id, sess, nil
+}
+
+func (a *Auth) Logout(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, id)
+}
+
+// HashPassword returns the bcrypt hash to put in a user's password_hash.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
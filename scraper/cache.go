@@ -40,6 +40,15 @@ func (c *HTMLCache) Get(url string) ([]byte, bool) {
 	return data, true
 }
 
+// Load returns cached content regardless of age.
+func (c *HTMLCache) Load(url string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(c.getFilePath(url))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
 func (c *HTMLCache) Put(url string, content []byte) error {
 	path := c.getFilePath(url)
 	return ioutil.WriteFile(path, content, 0644)
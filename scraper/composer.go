@@ -0,0 +1,232 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Composer sources, in the order ResolveComposer prefers them when they
+// disagree: explicit structured data, then page text, then the composer of
+// the matched graph opera.
+const (
+	composerFromJSONLD = "json-ld"
+	composerFromText   = "text"
+	composerFromGraph  = "graph"
+)
+
+var composerSourcePrecedence = []string{composerFromJSONLD, composerFromText, composerFromGraph}
+
+// wellKnownComposers are surnames recognised in possessive phrases such as
+// "Puccini's Tosca" even before graph.json is available.
+var wellKnownComposers = []string{
+	"Adams", "Barber", "Bartók", "Beethoven", "Bellini", "Berg", "Berlioz", "Bernstein",
+	"Bizet", "Britten", "Cavalli", "Charpentier", "Cilea", "Debussy", "Delibes", "Donizetti",
+	"Dvořák", "Floyd", "Gershwin", "Giordano", "Glass", "Glinka", "Gluck", "Gounod", "Handel",
+	"Haydn", "Heggie", "Humperdinck", "Janáček", "Korngold", "Lehár", "Leoncavallo", "Lully",
+	"Mascagni", "Massenet", "Menotti", "Meyerbeer", "Monteverdi", "Mozart", "Mussorgsky",
+	"Offenbach", "Pergolesi", "Ponchielli", "Poulenc", "Prokofiev", "Puccini", "Purcell",
+	"Rachmaninoff", "Rameau", "Ravel", "Rimsky-Korsakov", "Rossini", "Saariaho", "Saint-Saëns",
+	"Shostakovich", "Smetana", "Strauss", "Stravinsky", "Tchaikovsky", "Thomas", "Verdi",
+	"Wagner", "Weber", "Weill",
+}
+
+var wellKnownComposerSurnames = func() map[string]bool {
+	set := make(map[string]bool, len(wellKnownComposers))
+	for _, name := range wellKnownComposers {
+		set[composerSurname(name)] = true
+	}
+	return set
+}()
+
+var (
+	// "music by Giuseppe Verdi", "composed by Puccini", "Composer: Kaija Saariaho"
+	composerByRe = regexp.MustCompile(`(?:[Mm]usic|[Cc]omposed|[Oo]pera) by\s+(\p{Lu}[\p{L}'’.-]*(?: \p{Lu}[\p{L}'’.-]*){0,3})|[Cc]omposer:\s*(\p{Lu}[\p{L}'’.-]*(?: \p{Lu}[\p{L}'’.-]*){0,3})`)
+	// "Puccini's Tosca"
+	composerPossessiveRe = regexp.MustCompile(`(\p{Lu}[\p{L}-]+)['’]s\b`)
+)
+
+// composerFromPageText finds a composer named in event text. Possessives are
+// only trusted for well-known opera composers, since "Figaro's wedding" or
+// "Carmen's revenge" would otherwise read as composers.
+func composerFromPageText(text string) string {
+	if m := composerByRe.FindStringSubmatch(text); m != nil {
+		name := m[1]
+		if name == "" {
+			name = m[2]
+		}
+		if name = strings.TrimRight(name, "."); name != "" {
+			return name
+		}
+	}
+	for _, m := range composerPossessiveRe.FindAllStringSubmatch(text, -1) {
+		if wellKnownComposerSurnames[composerSurname(m[1])] {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// ldComposer extracts a composer name from a JSON-LD event's own composer
+// property or from the composer of its workPerformed.
+func ldComposer(obj map[string]interface{}) string {
+	if name := ldName(obj["composer"]); name != "" {
+		return name
+	}
+	return ldWorkComposer(obj["workPerformed"])
+}
+
+func ldWorkComposer(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return ldName(v["composer"])
+	case []interface{}:
+		for _, item := range v {
+			if name := ldWorkComposer(item); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// ldName returns the name of a JSON-LD Person, given as a string, an object
+// with a name, or an array of either.
+func ldName(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		name, _ := v["name"].(string)
+		return strings.TrimSpace(name)
+	case []interface{}:
+		for _, item := range v {
+			if name := ldName(item); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// ldNames returns every name in a JSON-LD Person or list of people,
+// without duplicates.
+func ldNames(v interface{}) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		if items, ok := v.([]interface{}); ok {
+			for _, item := range items {
+				walk(item)
+			}
+			return
+		}
+		if name := ldName(v); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	walk(v)
+	return names
+}
+
+// addComposerSource records a composer found by one source on an event.
+func addComposerSource(ev *PerformanceEvent, source, name string) {
+	if name == "" {
+		return
+	}
+	if ev.ComposerSources == nil {
+		ev.ComposerSources = make(map[string]string)
+	}
+	if _, ok := ev.ComposerSources[source]; !ok {
+		ev.ComposerSources[source] = name
+	}
+}
+
+// composerSurname reduces a composer name to a comparable surname: "Giuseppe
+// Verdi", "G. Verdi" and "VERDI" all become "verdi".
+func composerSurname(name string) string {
+	words := strings.Fields(normalizeTitle(name))
+	for len(words) > 1 {
+		switch words[len(words)-1] {
+		case "ii", "iii", "jr", "sr":
+			words = words[:len(words)-1]
+			continue
+		}
+		break
+	}
+	if len(words) == 0 {
+		return ""
+	}
+	if len(words) > 1 && words[len(words)-2] == "rimsky" {
+		return "rimsky " + words[len(words)-1]
+	}
+	return words[len(words)-1]
+}
+
+// ComposerIndex resolves composers for events matched to graph operas.
+type ComposerIndex struct {
+	byOpera map[string]string // opera node key -> composer name
+}
+
+// NewComposerIndex follows composed_by edges from opera to composer nodes,
+// falling back to the opera node's composerName attribute.
+func NewComposerIndex(g *GraphDocument) *ComposerIndex {
+	ci := &ComposerIndex{byOpera: make(map[string]string)}
+	if g == nil {
+		return ci
+	}
+
+	labels := make(map[string]string, len(g.Nodes))
+	for _, n := range g.Nodes {
+		labels[n.Key] = n.Attributes.Label
+		if n.Attributes.Type == "opera" && n.Attributes.ComposerName != "" {
+			ci.byOpera[n.Key] = n.Attributes.ComposerName
+		}
+	}
+	for _, e := range g.Edges {
+		if e.Attributes.Type == "composed_by" && labels[e.Target] != "" {
+			ci.byOpera[e.Source] = labels[e.Target]
+		}
+	}
+	return ci
+}
+
+// ResolveComposers adds the graph composer of each matched event and sets
+// Composer from the agreeing (or, on conflict, most trusted) source.
+func (ci *ComposerIndex) ResolveComposers(events []PerformanceEvent) {
+	for i := range events {
+		ev := &events[i]
+		if ci != nil && ev.MatchedOperaKey != "" {
+			addComposerSource(ev, composerFromGraph, ci.byOpera[ev.MatchedOperaKey])
+		}
+		resolveComposer(ev)
+	}
+}
+
+// resolveComposer picks Composer from ComposerSources and flags events whose
+// sources name different composers. When the sources agree, the longest
+// form of the name wins ("Giuseppe Verdi" over "Verdi").
+func resolveComposer(ev *PerformanceEvent) {
+	if len(ev.ComposerSources) == 0 {
+		return
+	}
+
+	chosen := ""
+	ev.ComposerConflict = false
+	for _, source := range composerSourcePrecedence {
+		name, ok := ev.ComposerSources[source]
+		if !ok {
+			continue
+		}
+		switch {
+		case chosen == "":
+			chosen = name
+		case composerSurname(name) != composerSurname(chosen):
+			ev.ComposerConflict = true
+		case len(name) > len(chosen):
+			chosen = name
+		}
+	}
+	ev.Composer = chosen
+}
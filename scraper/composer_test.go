@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestComposerFromPageText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"A new production with music by Giuseppe Verdi and libretto by Piave.", "Giuseppe Verdi"},
+		{"Composed by Kaija Saariaho.", "Kaija Saariaho"},
+		{"Composer: Philip Glass", "Philip Glass"},
+		{"Puccini's Tosca opens the season", "Puccini"},
+		{"Dvořák’s Rusalka", "Dvořák"},
+		{"Figaro's wedding day goes awry", ""},
+		{"Tickets on sale now", ""},
+	}
+
+	for _, tt := range tests {
+		if got := composerFromPageText(tt.text); got != tt.want {
+			t.Errorf("composerFromPageText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestComposerSurname(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Giuseppe Verdi", "verdi"},
+		{"G. Verdi", "verdi"},
+		{"VERDI", "verdi"},
+		{"Antonín Dvořák", "dvorak"},
+		{"Nikolai Rimsky-Korsakov", "rimsky korsakov"},
+		{"Johann Strauss II", "strauss"},
+	}
+
+	for _, tt := range tests {
+		if got := composerSurname(tt.name); got != tt.want {
+			t.Errorf("composerSurname(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveComposers(t *testing.T) {
+	var g GraphDocument
+	err := json.Unmarshal([]byte(`{
+		"nodes": [
+			{"key": "Q1", "attributes": {"label": "La traviata", "type": "opera"}},
+			{"key": "Q2", "attributes": {"label": "Tosca", "type": "opera", "composerName": "Puccini"}},
+			{"key": "C1", "attributes": {"label": "Giuseppe Verdi", "type": "composer"}}
+		],
+		"edges": [
+			{"source": "Q1", "target": "C1", "attributes": {"type": "composed_by"}}
+		]
+	}`), &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci := NewComposerIndex(&g)
+
+	events := []PerformanceEvent{
+		{Title: "La traviata", MatchedOperaKey: "Q1", ComposerSources: map[string]string{composerFromText: "Verdi"}},
+		{Title: "Tosca", MatchedOperaKey: "Q2", ComposerSources: map[string]string{composerFromJSONLD: "Giacomo Puccini"}},
+		{Title: "Tosca", MatchedOperaKey: "Q2", ComposerSources: map[string]string{composerFromText: "Verdi"}},
+		{Title: "Unknown"},
+	}
+	ci.ResolveComposers(events)
+
+	tests := []struct {
+		composer string
+		conflict bool
+	}{
+		{"Giuseppe Verdi", false},
+		{"Giacomo Puccini", false},
+		{"Verdi", true},
+		{"", false},
+	}
+	for i, tt := range tests {
+		ev := events[i]
+		if ev.Composer != tt.composer || ev.ComposerConflict != tt.conflict {
+			t.Errorf("event %d (%s): composer %q conflict %v, want %q conflict %v",
+				i, ev.Title, ev.Composer, ev.ComposerConflict, tt.composer, tt.conflict)
+		}
+	}
+}
+
+func TestLDNames(t *testing.T) {
+	var performer interface{}
+	json.Unmarshal([]byte(`[{"@type": "Person", "name": "Sondra Radvanovsky"}, "Russell Thomas", {"name": "Sondra Radvanovsky"}, [{"name": "Ryan Speedo Green"}]]`), &performer)
+	got := ldNames(performer)
+	want := []string{"Sondra Radvanovsky", "Russell Thomas", "Ryan Speedo Green"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("ldNames = %v, want %v", got, want)
+	}
+}
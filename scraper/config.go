@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// maxConfigBytes bounds a config uploaded through the API.
+const maxConfigBytes = 1 << 20
+
+// ConfigValidation is the outcome of checking a config.
+type ConfigValidation struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// ParseConfig parses config YAML and returns every problem found with it,
+// so that an editor can show them all at once.
+func ParseConfig(data []byte) (Config, []string) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, []string{fmt.Sprintf("invalid YAML: %v", err)}
+	}
+	return cfg, ValidateConfig(cfg)
+}
+
+// ValidateConfig checks the settings the scraper relies on: delays and caps
+// it would misbehave with, duplicate or unusable codes, bad URLs and
+// schedules, and malformed user accounts.
+func ValidateConfig(cfg Config) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	sc := cfg.Scraping
+	if sc.Navigation.MinDelayMs < 0 {
+		add("scraping.navigation.min_delay_ms must not be negative")
+	}
+	if sc.Navigation.MinDelayMs >= sc.Navigation.MaxDelayMs {
+		add("scraping.navigation.min_delay_ms (%d) must be less than max_delay_ms (%d)", sc.Navigation.MinDelayMs, sc.Navigation.MaxDelayMs)
+	}
+	if sc.HardCaps.MaxPagesPerDomainPerRun <= 0 {
+		add("scraping.hard_caps.max_pages_per_domain_per_run must be greater than 0")
+	}
+	if sc.HardCaps.MaxTotalPagesPerRun <= 0 {
+		add("scraping.hard_caps.max_total_pages_per_run must be greater than 0")
+	}
+	if sc.Retry.StrikesPerDomainStop <= 0 {
+		add("scraping.retry.strikes_per_domain_stop must be greater than 0")
+	}
+	if sc.Cache.TTLHours < 0 {
+		add("scraping.cache.ttl_hours must not be negative")
+	}
+	if c := sc.GenericParser.MinConfidence; c < 0 || c > 1 {
+		add("scraping.generic_parser.min_confidence must be between 0 and 1")
+	}
+	policy := map[string][]string{"allow_hosts": sc.URLPolicy.AllowHosts, "deny_hosts": sc.URLPolicy.DenyHosts}
+	for _, field := range []string{"allow_hosts", "deny_hosts"} {
+		for _, host := range policy[field] {
+			if normalizeHost(host) == "" || strings.ContainsAny(host, "/:@ ") {
+				add("scraping.url_policy.%s: %q is not a host name", field, host)
+			}
+		}
+	}
+
+	regions := make(map[string]bool)
+	venues := make(map[string]string) // code -> region
+	for i, region := range cfg.RegionalVenues.Regions {
+		where := fmt.Sprintf("regional_venues.regions[%d]", i)
+		if problem := codeProblem(region.Code); problem != "" {
+			add("%s: code %s", where, problem)
+		} else if regions[strings.ToLower(region.Code)] {
+			add("%s: duplicate region code %q", where, region.Code)
+		}
+		regions[strings.ToLower(region.Code)] = true
+
+		for j, venue := range region.Venues {
+			where := fmt.Sprintf("%s.venues[%d]", where, j)
+			if venue.Code != "" {
+				where = fmt.Sprintf("%s (%s)", where, venue.Code)
+			}
+			if problem := codeProblem(venue.Code); problem != "" {
+				add("%s: code %s", where, problem)
+			} else if other, ok := venues[strings.ToLower(venue.Code)]; ok {
+				add("%s: duplicate venue code %q, also in region %q", where, venue.Code, other)
+			}
+			venues[strings.ToLower(venue.Code)] = region.Code
+
+			if strings.TrimSpace(venue.Name) == "" {
+				add("%s: name is required", where)
+			}
+			if venue.OfficialURL == "" && venue.CalendarURL == "" {
+				add("%s: official_url or calendar_url is required", where)
+			}
+			urls := []struct{ field, url string }{
+				{"official_url", venue.OfficialURL},
+				{"calendar_url", venue.CalendarURL},
+				{"operabase_url", venue.OperabaseURL},
+			}
+			for _, u := range urls {
+				if u.url != "" && !validHTTPURL(u.url) {
+					add("%s: %s %q is not an http(s) URL", where, u.field, u.url)
+				}
+			}
+		}
+	}
+
+	users := make(map[string]bool)
+	for i, u := range cfg.Auth.Users {
+		where := fmt.Sprintf("auth.users[%d]", i)
+		if strings.TrimSpace(u.Username) == "" {
+			add("%s: username is required", where)
+		} else if users[strings.ToLower(u.Username)] {
+			add("%s: duplicate username %q", where, u.Username)
+		}
+		users[strings.ToLower(u.Username)] = true
+		if _, ok := parseRole(u.Role); !ok {
+			add("%s: role %q must be viewer or admin", where, u.Role)
+		}
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			add("%s: password_hash is not a bcrypt hash (make one with `scraper hash-password`)", where)
+		}
+	}
+	if cfg.Auth.SessionHours < 0 {
+		add("auth.session_hours must not be negative")
+	}
+
+	serverProblems(cfg.Server, add)
+
+	if _, _, _, err := parseSchedules(cfg); err != nil {
+		add("%v", err)
+	}
+	return problems
+}
+
+// codeProblem describes what is wrong with a region or venue code, which
+// ends up in file names, or returns "".
+func codeProblem(code string) string {
+	if code == "" {
+		return "is required"
+	}
+	for _, r := range code {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Sprintf("%q may only contain letters, digits, - and _", code)
+		}
+	}
+	return ""
+}
+
+func validHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// configETag identifies one version of the config file's contents.
+func configETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// WriteConfig replaces the config file atomically, first copying the
+// current version to <path>.bak.
+func WriteConfig(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if old, err := os.ReadFile(path); err == nil {
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.WriteFile(path+".bak", old, mode); err != nil {
+			return fmt.Errorf("failed to back up config: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	return nil
+}
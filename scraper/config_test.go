@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfigYAML = `scraping:
+  navigation:
+    min_delay_ms: 1000
+    max_delay_ms: 2000
+  hard_caps:
+    max_pages_per_domain_per_run: 10
+    max_total_pages_per_run: 50
+  retry:
+    strikes_per_domain_stop: 3
+  generic_parser:
+    min_confidence: 0.45
+regional_venues:
+  enabled: true
+  regions:
+    - name: Southern California
+      code: socal
+      venues:
+        - name: LA Opera
+          code: laopera
+          calendar_url: https://www.laopera.org/whats-on
+`
+
+func TestValidateConfig(t *testing.T) {
+	if _, problems := ParseConfig([]byte(testConfigYAML)); len(problems) > 0 {
+		t.Fatalf("valid config: %v", problems)
+	}
+
+	tests := []struct {
+		name, from, to, want string
+	}{
+		{"delays", "max_delay_ms: 2000", "max_delay_ms: 1000", "must be less than max_delay_ms"},
+		{"caps", "max_total_pages_per_run: 50", "max_total_pages_per_run: 0", "max_total_pages_per_run must be greater than 0"},
+		{"confidence", "min_confidence: 0.45", "min_confidence: 45", "between 0 and 1"},
+		{"url", "https://www.laopera.org/whats-on", "www.laopera.org", `calendar_url "www.laopera.org" is not an http(s) URL`},
+		{"code", "code: laopera", "code: la/opera", "may only contain"},
+		{"schedule", "code: socal", "code: socal\n      schedule: sometimes", `region:socal schedule "sometimes"`},
+		{"yaml", "regions:", "regions: [", "invalid YAML"},
+		{"user", "regional_venues:", "auth:\n  users:\n    - username: ada\n      password_hash: plain\n      role: owner\nregional_venues:", `role "owner" must be viewer or admin`},
+		{"url policy", "  generic_parser:", "  url_policy:\n    deny_hosts: [\"http://evil.example\"]\n  generic_parser:", `deny_hosts: "http://evil.example" is not a host name`},
+		{"duplicate venue", "          calendar_url: https://www.laopera.org/whats-on\n",
+			"          calendar_url: https://www.laopera.org/whats-on\n    - name: Elsewhere\n      code: other\n      venues:\n        - name: Copy\n          code: LAOpera\n          official_url: https://example.org\n",
+			`duplicate venue code "LAOpera", also in region "socal"`},
+	}
+	for _, tt := range tests {
+		_, problems := ParseConfig([]byte(strings.Replace(testConfigYAML, tt.from, tt.to, 1)))
+		if !strings.Contains(strings.Join(problems, "\n"), tt.want) {
+			t.Errorf("%s: problems %q, want one containing %q", tt.name, problems, tt.want)
+		}
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteConfig(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("config = %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".bak"); string(data) != "old" {
+		t.Errorf("backup = %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600 kept", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 2 {
+		t.Errorf("left behind %d files, want config and backup", len(entries))
+	}
+}
+
+func TestHandleConfigPut(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(testConfigYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(configPath, dir, "")
+	s.lookup = publicLookup
+
+	rec := httptest.NewRecorder()
+	s.handleConfig(rec, httptest.NewRequest("GET", "/api/config", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != 200 || etag == "" {
+		t.Fatalf("GET: %d, etag %q", rec.Code, etag)
+	}
+
+	invalid := strings.Replace(testConfigYAML, "max_delay_ms: 2000", "max_delay_ms: 10", 1)
+	rec = httptest.NewRecorder()
+	s.handleConfigValidate(rec, httptest.NewRequest("POST", "/api/config/validate", strings.NewReader(invalid)))
+	var result ConfigValidation
+	json.NewDecoder(rec.Body).Decode(&result)
+	if rec.Code != 200 || result.Valid || len(result.Errors) != 1 {
+		t.Errorf("validate: %d %+v", rec.Code, result)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleConfig(rec, httptest.NewRequest("PUT", "/api/config", strings.NewReader(invalid)))
+	if rec.Code != 422 {
+		t.Errorf("PUT invalid: %d, want 422", rec.Code)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != testConfigYAML {
+		t.Error("invalid config was written")
+	}
+
+	metadata := strings.Replace(testConfigYAML, "https://www.laopera.org/whats-on", "http://169.254.169.254/latest/meta-data/", 1)
+	rec = httptest.NewRecorder()
+	s.handleConfig(rec, httptest.NewRequest("PUT", "/api/config", strings.NewReader(metadata)))
+	if rec.Code != 422 || !strings.Contains(rec.Body.String(), "not a public address") {
+		t.Errorf("PUT venue on metadata address: %d %s, want 422", rec.Code, rec.Body)
+	}
+
+	scheduled := strings.Replace(testConfigYAML, "code: socal", "code: socal\n      schedule: '@daily'", 1) +
+		"scheduler:\n  enabled: true\n"
+	req := httptest.NewRequest("PUT", "/api/config", strings.NewReader(scheduled))
+	req.Header.Set("If-Match", etag)
+	rec = httptest.NewRecorder()
+	s.handleConfig(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	if data, _ := os.ReadFile(configPath + ".bak"); string(data) != testConfigYAML {
+		t.Error("previous config not backed up")
+	}
+	if st := s.scheduler.Status(); !st.Enabled || len(st.Entries) != 1 {
+		t.Errorf("scheduler not reloaded: %+v", st)
+	}
+
+	// The ETag from before the write is now stale.
+	req = httptest.NewRequest("PUT", "/api/config", strings.NewReader(testConfigYAML))
+	req.Header.Set("If-Match", etag)
+	rec = httptest.NewRecorder()
+	s.handleConfig(rec, req)
+	if rec.Code != 412 {
+		t.Errorf("PUT with stale If-Match: %d, want 412", rec.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LoadStoredEvents reads every saved event from the regional and custom
+// directories under dataDir. A non-empty region limits the scan to that
+// region ("custom" for scrape-url results).
+func LoadStoredEvents(dataDir, region string) []PerformanceEvent {
+	var allEvents []PerformanceEvent
+
+	regionalDir := filepath.Join(dataDir, "data", "raw", "regional")
+	if regions, err := os.ReadDir(regionalDir); err == nil {
+		for _, r := range regions {
+			if !r.IsDir() || (region != "" && r.Name() != region) {
+				continue
+			}
+			allEvents = append(allEvents, readEventFiles(filepath.Join(regionalDir, r.Name()), r.Name())...)
+		}
+	}
+
+	if region == "" || region == "custom" {
+		allEvents = append(allEvents, readEventFiles(filepath.Join(dataDir, "data", "raw", "custom"), "custom")...)
+	}
+
+	return allEvents
+}
+
+// readEventFiles reads the event JSON files in dir, defaulting each event's
+// region. Unreadable files are skipped.
+func readEventFiles(dir, region string) []PerformanceEvent {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []PerformanceEvent
+	for _, f := range files {
+		if f.Name() == "sources.json" || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		events, err := readEventFile(filepath.Join(dir, f.Name()), region)
+		if err != nil {
+			continue
+		}
+		out = append(out, events...)
+	}
+	return out
+}
+
+// latestSnapshots collapses the dated snapshots of each event into one,
+// keeping the latest snapshot's details and the earliest first-seen time
+// (falling back to scraped_at for events stored before it was tracked).
+// Events keep the order in which they were first encountered.
+func latestSnapshots(events []PerformanceEvent) []PerformanceEvent {
+	byKey := make(map[string]*PerformanceEvent)
+	var keys []string
+	for _, ev := range events {
+		firstSeen := ev.FirstSeenAt
+		if firstSeen == "" {
+			firstSeen = ev.ScrapedAt
+		}
+		key := eventKey(ev)
+		cur, ok := byKey[key]
+		if !ok {
+			ev := ev
+			ev.FirstSeenAt = firstSeen
+			byKey[key] = &ev
+			keys = append(keys, key)
+			continue
+		}
+		if firstSeen != "" && (cur.FirstSeenAt == "" || storedTime(firstSeen).Before(storedTime(cur.FirstSeenAt))) {
+			cur.FirstSeenAt = firstSeen
+		}
+		if storedTime(ev.ScrapedAt).After(storedTime(cur.ScrapedAt)) {
+			firstSeen := cur.FirstSeenAt
+			*cur = ev
+			cur.FirstSeenAt = firstSeen
+		}
+	}
+
+	out := make([]PerformanceEvent, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, *byKey[key])
+	}
+	return out
+}
+
+// storedTime parses an RFC 3339 timestamp from a stored event, treating
+// missing or malformed values as the epoch.
+func storedTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Unix(0, 0).UTC()
+	}
+	return t
+}
+
+// EventFilter selects stored events. Each field is a list of accepted
+// values; empty lists accept everything.
+type EventFilter struct {
+	Regions   []string
+	Venues    []string
+	Composers []string
+	Operas    []string // matched graph opera keys
+}
+
+// ParseEventFilter reads region, venue, composer and opera query parameters.
+// Each may be repeated or comma-separated.
+func ParseEventFilter(q url.Values) EventFilter {
+	return EventFilter{
+		Regions:   splitFilterValues(q["region"]),
+		Venues:    splitFilterValues(q["venue"]),
+		Composers: splitFilterValues(q["composer"]),
+		Operas:    splitFilterValues(q["opera"]),
+	}
+}
+
+func splitFilterValues(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// Region returns the single region the filter is limited to, if any, so
+// callers can skip reading other regions' files.
+func (f EventFilter) Region() string {
+	if len(f.Regions) == 1 {
+		return f.Regions[0]
+	}
+	return ""
+}
+
+// Match reports whether ev passes the filter. Composers match by whole
+// words, ignoring case and accents, so "puccini" selects "Giacomo Puccini".
+func (f EventFilter) Match(ev PerformanceEvent) bool {
+	if len(f.Regions) > 0 && !containsFold(f.Regions, ev.Region) {
+		return false
+	}
+	if len(f.Venues) > 0 && !containsFold(f.Venues, ev.VenueCode) {
+		return false
+	}
+	if len(f.Operas) > 0 && !containsFold(f.Operas, ev.MatchedOperaKey) {
+		return false
+	}
+	if len(f.Composers) > 0 {
+		composer := strings.Fields(normalizeTitle(ev.Composer))
+		matched := false
+		for _, c := range f.Composers {
+			if containsWords(composer, strings.Fields(normalizeTitle(c))) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// CalendarName describes the filter for calendar apps, e.g. "Opera: Puccini
+// in socal".
+func (f EventFilter) CalendarName() string {
+	name := "Opera"
+	if len(f.Composers) > 0 {
+		name += ": " + strings.Join(f.Composers, ", ")
+	}
+	if len(f.Operas) > 0 {
+		name += " (" + strings.Join(f.Operas, ", ") + ")"
+	}
+	where := append(append([]string{}, f.Venues...), f.Regions...)
+	if len(where) > 0 {
+		name += " in " + strings.Join(where, ", ")
+	}
+	return name
+}
+
+// Apply returns the events that pass the filter.
+func (f EventFilter) Apply(events []PerformanceEvent) []PerformanceEvent {
+	var out []PerformanceEvent
+	for _, ev := range events {
+		if f.Match(ev) {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadStoredEvents(t *testing.T) {
+	dataDir := t.TempDir()
+	write := func(rel string, events []PerformanceEvent) {
+		path := filepath.Join(dataDir, "data", "raw", rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(events)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("regional/socal/laopera.json", []PerformanceEvent{{EventID: "a", VenueCode: "laopera"}})
+	write("regional/nm/santafeopera.json", []PerformanceEvent{{EventID: "b", VenueCode: "santafeopera"}})
+	write("custom/example.json", []PerformanceEvent{{EventID: "c"}})
+	write("custom/sources.json", []PerformanceEvent{{EventID: "not an event"}})
+
+	if got := LoadStoredEvents(dataDir, ""); len(got) != 3 {
+		t.Errorf("loaded %d events, want 3", len(got))
+	}
+	got := LoadStoredEvents(dataDir, "socal")
+	if len(got) != 1 || got[0].EventID != "a" || got[0].Region != "socal" {
+		t.Errorf("socal events = %+v", got)
+	}
+	got = LoadStoredEvents(dataDir, "custom")
+	if len(got) != 1 || got[0].EventID != "c" || got[0].Region != "custom" {
+		t.Errorf("custom events = %+v", got)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	events := []PerformanceEvent{
+		{EventID: "1", Region: "socal", VenueCode: "laopera", Composer: "Giacomo Puccini", MatchedOperaKey: "Q1"},
+		{EventID: "2", Region: "socal", VenueCode: "sandiegoopera", Composer: "Giuseppe Verdi"},
+		{EventID: "3", Region: "nm", VenueCode: "santafeopera", Composer: "Puccini"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"1", "2", "3"}},
+		{"composer=puccini&region=socal", []string{"1"}},
+		{"composer=Puccini", []string{"1", "3"}},
+		{"composer=giacomo", []string{"1"}},
+		{"composer=pucc", nil},
+		{"venue=laopera,santafeopera", []string{"1", "3"}},
+		{"opera=Q1", []string{"1"}},
+		{"region=SoCal&venue=santafeopera", nil},
+	}
+
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		var got []string
+		for _, ev := range ParseEventFilter(q).Apply(events) {
+			got = append(got, ev.EventID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
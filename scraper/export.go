@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// exportFormats are the formats accepted by the export command and by
+// /api/events?format=.
+var exportFormats = []string{"csv", "parquet", "ics", "json"}
+
+// EventRow is one performance date of an event, flattened for tabular
+// analysis. Empty optional columns are written as nulls in Parquet.
+type EventRow struct {
+	EventID         string     `parquet:"event_id"`
+	Region          string     `parquet:"region"`
+	VenueCode       string     `parquet:"venue_code,optional"`
+	VenueName       string     `parquet:"venue_name,optional"`
+	City            string     `parquet:"city,optional"`
+	State           string     `parquet:"state,optional"`
+	Title           string     `parquet:"opera_title"`
+	Composer        string     `parquet:"composer,optional"`
+	MatchedOperaKey string     `parquet:"matched_opera_key,optional"`
+	MatchConfidence float64    `parquet:"match_confidence,optional"`
+	Date            string     `parquet:"date,optional"`       // as scraped
+	LocalDate       string     `parquet:"local_date,optional"` // YYYY-MM-DD at the venue
+	LocalTime       string     `parquet:"local_time,optional"` // HH:MM, empty for all-day dates
+	Start           *time.Time `parquet:"start,optional"`      // nil unless timed in a known zone or offset
+	Timezone        string     `parquet:"timezone,optional"`
+	Strategy        string     `parquet:"strategy,optional"`
+	Confidence      float64    `parquet:"confidence,optional"`
+	SourceURL       string     `parquet:"source_url,optional"`
+	ScrapedAt       string     `parquet:"scraped_at,optional"`
+	FirstSeenAt     string     `parquet:"first_seen_at,optional"`
+}
+
+// eventRowColumns lists the CSV columns in order, named as in Parquet.
+var eventRowColumns = []struct {
+	name  string
+	value func(r EventRow) string
+}{
+	{"event_id", func(r EventRow) string { return r.EventID }},
+	{"region", func(r EventRow) string { return r.Region }},
+	{"venue_code", func(r EventRow) string { return r.VenueCode }},
+	{"venue_name", func(r EventRow) string { return r.VenueName }},
+	{"city", func(r EventRow) string { return r.City }},
+	{"state", func(r EventRow) string { return r.State }},
+	{"opera_title", func(r EventRow) string { return r.Title }},
+	{"composer", func(r EventRow) string { return r.Composer }},
+	{"matched_opera_key", func(r EventRow) string { return r.MatchedOperaKey }},
+	{"match_confidence", func(r EventRow) string { return formatScore(r.MatchConfidence) }},
+	{"date", func(r EventRow) string { return r.Date }},
+	{"local_date", func(r EventRow) string { return r.LocalDate }},
+	{"local_time", func(r EventRow) string { return r.LocalTime }},
+	{"start", func(r EventRow) string {
+		if r.Start == nil {
+			return ""
+		}
+		return r.Start.UTC().Format(time.RFC3339)
+	}},
+	{"timezone", func(r EventRow) string { return r.Timezone }},
+	{"strategy", func(r EventRow) string { return r.Strategy }},
+	{"confidence", func(r EventRow) string { return formatScore(r.Confidence) }},
+	{"source_url", func(r EventRow) string { return r.SourceURL }},
+	{"scraped_at", func(r EventRow) string { return r.ScrapedAt }},
+	{"first_seen_at", func(r EventRow) string { return r.FirstSeenAt }},
+}
+
+// exportContentTypes are the HTTP content types of each export format.
+var exportContentTypes = map[string]string{
+	"csv":     "text/csv; charset=utf-8",
+	"parquet": "application/vnd.apache.parquet",
+	"ics":     "text/calendar; charset=utf-8",
+	"json":    "application/json",
+}
+
+func formatScore(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// EventRows flattens events into one row per performance date. Events
+// without dates still get a single row so they are not lost from the
+// dataset.
+func EventRows(events []PerformanceEvent) []EventRow {
+	var rows []EventRow
+	for _, ev := range events {
+		base := EventRow{
+			EventID:         ev.EventID,
+			Region:          ev.Region,
+			VenueCode:       ev.VenueCode,
+			VenueName:       ev.VenueName,
+			City:            ev.City,
+			State:           ev.State,
+			Title:           ev.Title,
+			Composer:        ev.Composer,
+			MatchedOperaKey: ev.MatchedOperaKey,
+			MatchConfidence: ev.MatchConfidence,
+			Strategy:        ev.Strategy,
+			Confidence:      ev.Confidence,
+			SourceURL:       ev.SourceURL,
+			ScrapedAt:       ev.ScrapedAt,
+			FirstSeenAt:     ev.FirstSeenAt,
+		}
+		if len(ev.Dates) == 0 {
+			rows = append(rows, base)
+			continue
+		}
+
+		loc := eventLocation(ev)
+		for _, d := range ev.Dates {
+			row := base
+			row.Date = d
+			if start, allDay, ok := parseOccurrence(d, loc); ok {
+				if loc == nil && hasOffset(d) {
+					// The zone is unknown, but the date's own offset still
+					// places it in time, as in the iCalendar export, and
+					// is the best guess at the venue's clock.
+					start, _ = time.Parse(time.RFC3339, strings.TrimSpace(d))
+				}
+				row.LocalDate = start.Format("2006-01-02")
+				if !allDay {
+					row.LocalTime = start.Format("15:04")
+					if loc != nil || hasOffset(d) {
+						row.Start = &start
+					}
+				}
+				if loc != nil {
+					row.Timezone = loc.String()
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// WriteEventsCSV writes rows as CSV with a header line.
+func WriteEventsCSV(w io.Writer, rows []EventRow) error {
+	cw := csv.NewWriter(w)
+	record := make([]string, len(eventRowColumns))
+	for i, col := range eventRowColumns {
+		record[i] = col.name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		for i, col := range eventRowColumns {
+			record[i] = col.value(row)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteEventsParquet writes rows as a snappy-compressed Parquet file.
+func WriteEventsParquet(w io.Writer, rows []EventRow) error {
+	pw := parquet.NewGenericWriter[EventRow](w, parquet.Compression(&parquet.Snappy))
+	if _, err := pw.Write(rows); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+// WriteEvents writes the latest snapshot of each event in format.
+func WriteEvents(w io.Writer, format string, filter EventFilter, events []PerformanceEvent) error {
+	events = latestSnapshots(events)
+	switch format {
+	case "csv":
+		return WriteEventsCSV(w, EventRows(events))
+	case "parquet":
+		return WriteEventsParquet(w, EventRows(events))
+	case "ics":
+		return WriteICalendar(w, filter.CalendarName(), events)
+	case "json":
+		return writeIndentedJSON(w, events)
+	}
+	return fmt.Errorf("unknown export format %q (want one of %v)", format, exportFormats)
+}
+
+func writeIndentedJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// RunExport implements the export command:
+//
+//	scraper export --format csv --out events.csv --region socal
+func RunExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dataDir := fs.String("data-dir", defaultDataDir(), "Data directory")
+	format := fs.String("format", "csv", fmt.Sprintf("Output format: %v", exportFormats))
+	out := fs.String("out", "-", "Output file (\"-\" for stdout)")
+	region := fs.String("region", "", "Region codes to export, comma-separated")
+	venue := fs.String("venue", "", "Venue codes to export, comma-separated")
+	composer := fs.String("composer", "", "Composers to export, comma-separated")
+	opera := fs.String("opera", "", "Matched graph opera keys to export, comma-separated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := ParseEventFilter(url.Values{
+		"region":   {*region},
+		"venue":    {*venue},
+		"composer": {*composer},
+		"opera":    {*opera},
+	})
+	return ExportEvents(*out, *format, *dataDir, filter)
+}
+
+// ExportEvents writes the stored events selected by filter to path, or to
+// stdout if path is "-".
+func ExportEvents(path, format, dataDir string, filter EventFilter) error {
+	if _, ok := exportContentTypes[format]; !ok {
+		return fmt.Errorf("unknown export format %q (want one of %v)", format, exportFormats)
+	}
+	events := filter.Apply(LoadStoredEvents(dataDir, filter.Region()))
+
+	w := io.Writer(os.Stdout)
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := WriteEvents(w, format, filter, events); err != nil {
+		return err
+	}
+	log.Printf("Exported %d events as %s to %s", len(latestSnapshots(events)), format, path)
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func exportTestEvents() []PerformanceEvent {
+	return []PerformanceEvent{
+		{
+			EventID:   "tosca",
+			Region:    "socal",
+			VenueCode: "laopera",
+			Title:     "Tosca",
+			Composer:  "Giacomo Puccini",
+			Dates:     []string{"2026-11-08 7:30 PM", "2026-12-07"},
+			VenueName: "Dorothy Chandler Pavilion",
+			City:      "Los Angeles",
+			State:     "CA",
+			ScrapedAt: "2026-10-01T12:00:00Z",
+		},
+		{EventID: "gala", Region: "custom", Title: "Season Gala, \"Encore\""},
+	}
+}
+
+func TestEventRows(t *testing.T) {
+	rows := EventRows(exportTestEvents())
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3 (one per date, one for the undated event)", len(rows))
+	}
+
+	timed := rows[0]
+	if timed.LocalDate != "2026-11-08" || timed.LocalTime != "19:30" || timed.Timezone != "America/Los_Angeles" {
+		t.Errorf("timed row = %+v", timed)
+	}
+	if want := time.Date(2026, 11, 9, 3, 30, 0, 0, time.UTC); timed.Start == nil || !timed.Start.Equal(want) {
+		t.Errorf("start = %v, want %v", timed.Start, want)
+	}
+
+	allDay := rows[1]
+	if allDay.LocalDate != "2026-12-07" || allDay.LocalTime != "" || allDay.Start != nil {
+		t.Errorf("all-day row = %+v", allDay)
+	}
+	if rows[2].EventID != "gala" || rows[2].Date != "" {
+		t.Errorf("undated row = %+v", rows[2])
+	}
+}
+
+func TestEventRowsUnknownZone(t *testing.T) {
+	// A custom source with no state, whose dates carry an offset.
+	rows := EventRows([]PerformanceEvent{{EventID: "ld_tosca", Title: "Tosca", Dates: []string{"2026-11-08T19:30:00-05:00", "2026-11-10T19:30:00"}}})
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+
+	offset := rows[0]
+	if offset.LocalDate != "2026-11-08" || offset.LocalTime != "19:30" || offset.Timezone != "" {
+		t.Errorf("offset row = %+v", offset)
+	}
+	if want := time.Date(2026, 11, 9, 0, 30, 0, 0, time.UTC); offset.Start == nil || !offset.Start.Equal(want) {
+		t.Errorf("start = %v, want %v", offset.Start, want)
+	}
+	// Without an offset the time is floating and has no instant.
+	if floating := rows[1]; floating.LocalTime != "19:30" || floating.Start != nil {
+		t.Errorf("floating row = %+v", floating)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEventsCSV(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "2026-11-09T00:30:00Z") {
+		t.Errorf("CSV missing the UTC start:\n%s", buf.String())
+	}
+}
+
+func TestWriteEventsCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEventsCSV(&buf, EventRows(exportTestEvents())); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want header + 3", len(records))
+	}
+
+	col := make(map[string]int)
+	for i, name := range records[0] {
+		col[name] = i
+	}
+	if got := records[1][col["start"]]; got != "2026-11-09T03:30:00Z" {
+		t.Errorf("start = %q", got)
+	}
+	if got := records[3][col["opera_title"]]; got != "Season Gala, \"Encore\"" {
+		t.Errorf("opera_title = %q", got)
+	}
+}
+
+func TestWriteEventsKeepsEachDate(t *testing.T) {
+	// Two nights of one production as ParseLAOpera stores them, one scraped
+	// twice.
+	events := []PerformanceEvent{
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-08 7:30 PM"}, State: "CA", ScrapedAt: "2026-10-01T12:00:00Z"},
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-12 7:30 PM"}, State: "CA", ScrapedAt: "2026-10-01T12:00:00Z"},
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-08 7:30 PM"}, State: "CA", ScrapedAt: "2026-10-02T12:00:00Z"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEvents(&buf, "csv", EventFilter{}, events); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want header + 2", len(records))
+	}
+	col := make(map[string]int)
+	for i, name := range records[0] {
+		col[name] = i
+	}
+	if records[1][col["local_date"]] != "2026-11-08" || records[2][col["local_date"]] != "2026-11-12" {
+		t.Errorf("local dates = %q, %q", records[1][col["local_date"]], records[2][col["local_date"]])
+	}
+}
+
+func TestWriteEventsParquet(t *testing.T) {
+	rows := EventRows(exportTestEvents())
+	var buf bytes.Buffer
+	if err := WriteEventsParquet(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := parquet.Read[EventRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("read %d rows, want %d", len(got), len(rows))
+	}
+	if got[0].Title != "Tosca" || got[0].LocalTime != "19:30" || got[0].Start == nil || !got[0].Start.Equal(*rows[0].Start) {
+		t.Errorf("row 0 = %+v", got[0])
+	}
+	if got[1].Start != nil || got[2].VenueCode != "" {
+		t.Errorf("optional columns not round-tripped as empty: %+v %+v", got[1], got[2])
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FirstSeenStore remembers when each event was first scraped, so feeds can
+// list newly announced performances even though every run rewrites the
+// venue's event file.
+type FirstSeenStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func firstSeenPath(dataDir string) string {
+	return filepath.Join(dataDir, "data", "raw", "first_seen.json")
+}
+
+func NewFirstSeenStore(dataDir string) *FirstSeenStore {
+	return &FirstSeenStore{path: firstSeenPath(dataDir)}
+}
+
+// load reads the ledger (event key -> RFC 3339 time). It is re-read on
+// every Stamp so that a CLI run and the server do not drop each other's
+// entries.
+func (fs *FirstSeenStore) load() map[string]string {
+	seen := make(map[string]string)
+	if data, err := os.ReadFile(fs.path); err == nil {
+		if err := json.Unmarshal(data, &seen); err != nil {
+			log.Printf("Failed to parse first-seen ledger: %v", err)
+		}
+	}
+	return seen
+}
+
+// Stamp sets FirstSeenAt on each event, recording events not seen before,
+// and saves the ledger.
+func (fs *FirstSeenStore) Stamp(events []PerformanceEvent) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	seen := fs.load()
+	changed := false
+	for i := range events {
+		key := eventKey(events[i])
+		at, ok := seen[key]
+		if !ok {
+			at = events[i].ScrapedAt
+			if at == "" {
+				at = time.Now().Format(time.RFC3339)
+			}
+			seen[key] = at
+			changed = true
+		}
+		events[i].FirstSeenAt = at
+	}
+
+	if !changed {
+		return
+	}
+	if err := fs.save(seen); err != nil {
+		log.Printf("Failed to save first-seen ledger: %v", err)
+	}
+}
+
+// save writes the ledger atomically. Callers hold fs.mu.
+func (fs *FirstSeenStore) save(seen map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0755); err != nil {
+		return err
+	}
+	data, _ := json.MarshalIndent(seen, "", "  ")
+	tmp := fs.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fs.path)
+}
+
+// eventKey identifies an event across runs. Event IDs are only unique
+// within a venue, so the venue code, or the custom source for events with
+// no venue, is part of the key. Events without an ID are told apart by their
+// first date as well as their title, since parsers such as ParseLAOpera
+// emit one event per performance.
+func eventKey(ev PerformanceEvent) string {
+	id := ev.EventID
+	if id == "" {
+		id = sanitizeID(ev.Title)
+		if len(ev.Dates) > 0 {
+			id += "_" + sanitizeID(ev.Dates[0])
+		}
+	}
+	return eventScope(ev) + ":" + id
+}
+
+// eventScope is the venue code of ev, or "source-<id>" for events from a
+// custom source.
+func eventScope(ev PerformanceEvent) string {
+	if ev.VenueCode == "" && ev.SourceID != "" {
+		return "source-" + ev.SourceID
+	}
+	return ev.VenueCode
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestEventKey(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   PerformanceEvent
+		want string
+	}{
+		{"event ID", PerformanceEvent{EventID: "tosca", VenueCode: "laopera", Title: "Tosca", Dates: []string{"2026-11-08"}}, "laopera:tosca"},
+		{"title and first date", PerformanceEvent{VenueCode: "laopera", Title: "Don Giovanni", Dates: []string{"2026-11-08 7:30 PM", "2026-11-10"}}, "laopera:don_giovanni_2026_11_08_7_30_pm"},
+		{"undated", PerformanceEvent{VenueCode: "laopera", Title: "Gala"}, "laopera:gala"},
+		{"custom source", PerformanceEvent{EventID: "ld_tosca_2026_11_08", SourceID: "0123456789ab", Title: "Tosca"}, "source-0123456789ab:ld_tosca_2026_11_08"},
+		{"custom file without a source", PerformanceEvent{EventID: "ld_tosca_2026_11_08", Title: "Tosca"}, ":ld_tosca_2026_11_08"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventKey(tt.ev); got != tt.want {
+				t.Errorf("eventKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstSeenStoreKeepsEachDate(t *testing.T) {
+	fs := NewFirstSeenStore(t.TempDir())
+
+	// ParseLAOpera emits one event per performance, without an event ID.
+	events := []PerformanceEvent{
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-08 7:30 PM"}, ScrapedAt: "2026-09-01T10:00:00Z"},
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-12 7:30 PM"}, ScrapedAt: "2026-09-01T10:00:00Z"},
+	}
+	fs.Stamp(events)
+
+	// A date announced later is new, not covered by the earlier dates.
+	later := []PerformanceEvent{
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-08 7:30 PM"}, ScrapedAt: "2026-09-05T10:00:00Z"},
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-20 7:30 PM"}, ScrapedAt: "2026-09-05T10:00:00Z"},
+	}
+	fs.Stamp(later)
+	if later[0].FirstSeenAt != "2026-09-01T10:00:00Z" {
+		t.Errorf("known date first seen %s, want the first scrape", later[0].FirstSeenAt)
+	}
+	if later[1].FirstSeenAt != "2026-09-05T10:00:00Z" {
+		t.Errorf("new date first seen %s, want its scrape time", later[1].FirstSeenAt)
+	}
+}
+
+func TestLatestSnapshotsKeepsEachDate(t *testing.T) {
+	// ParseLAOpera emits one event per performance, without an event ID.
+	events := []PerformanceEvent{
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-08 7:30 PM"}, ScrapedAt: "2026-09-01T10:00:00Z"},
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-12 7:30 PM"}, ScrapedAt: "2026-09-01T10:00:00Z"},
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-08 7:30 PM"}, ScrapedAt: "2026-09-02T10:00:00Z"},
+		// The same generic-parser ID from two custom sources.
+		{EventID: "ld_tosca_2026_11_08", SourceID: "aaaaaaaaaaaa", Title: "Tosca", ScrapedAt: "2026-09-01T10:00:00Z"},
+		{EventID: "ld_tosca_2026_11_08", SourceID: "bbbbbbbbbbbb", Title: "Tosca", ScrapedAt: "2026-09-01T10:00:00Z"},
+	}
+
+	got := latestSnapshots(events)
+	if len(got) != 4 {
+		t.Fatalf("got %d events, want 4: %+v", len(got), got)
+	}
+	if got[0].ScrapedAt != "2026-09-02T10:00:00Z" || got[0].FirstSeenAt != "2026-09-01T10:00:00Z" {
+		t.Errorf("first date = scraped %s, first seen %s, want the later snapshot first seen earlier", got[0].ScrapedAt, got[0].FirstSeenAt)
+	}
+}
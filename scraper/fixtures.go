@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Parser fixtures live in testdata/parsers/<parser>/<name>.html with the
+// expected output next to them in <name>.golden.json. <parser> is a venue
+// code understood by GetParser, or "generic" for ParseGenericEvents.
+const fixtureSourcePrefix = "<!-- fixture-source: "
+
+var fixtureSourceRe = regexp.MustCompile(`^<!-- fixture-source: (\S+) -->`)
+
+// SnapshotFixture copies a page from the HTML cache into the fixture corpus so
+// a venue's current markup can be pinned by a golden test.
+func SnapshotFixture(cache *HTMLCache, pageURL, parser, name, fixturesDir string) (string, error) {
+	content, ok := cache.Load(pageURL)
+	if !ok {
+		return "", fmt.Errorf("%s is not in the HTML cache; scrape it first", pageURL)
+	}
+
+	dir := filepath.Join(fixturesDir, parser)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s%s -->\n", fixtureSourcePrefix, pageURL)
+	buf.Write(content)
+
+	path := filepath.Join(dir, name+".html")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// fixtureSource returns the source URL recorded in a fixture's header comment.
+func fixtureSource(content []byte) string {
+	if m := fixtureSourceRe.FindSubmatch(content); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// addFixtureSeeds seeds a fuzz target with every parser fixture.
+func addFixtureSeeds(f *testing.F) {
+	f.Helper()
+	fixtures, _ := filepath.Glob(filepath.Join("testdata", "parsers", "*", "*.html"))
+	for _, fixture := range fixtures {
+		content, err := os.ReadFile(fixture)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(content))
+	}
+}
+
+var fuzzTitles = []string{
+	"La traviata", "Madama Butterfly", "Die Zauberflöte", "Русалка",
+	"Le nozze di Figaro", "Carmen", "Ariadne auf Naxos", "蝴蝶夫人",
+}
+
+func FuzzParseJSONLD(f *testing.F) {
+	addFixtureSeeds(f)
+	f.Add(`<script type="application/ld+json">{"@type":"MusicEvent","name":"Русалка","startDate":"2027-03-13"}</script>`)
+	f.Add(`<script type="application/ld+json">{"@graph":[{"@graph":[{"@type":["Event"],"name":"Tosca"}]}]}</script>`)
+	f.Add(`<script type="application/ld+json">` + strings.Repeat(`{"@graph":[`, 200) + strings.Repeat(`]}`, 200) + `</script>`)
+	f.Add(`<script type="application/ld+json">{"@type":"Event","name":1,"location":[{"name":null}]}</script>`)
+
+	f.Fuzz(func(t *testing.T, page string) {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+		if err != nil {
+			return
+		}
+		for _, ev := range parseJSONLD(doc, "https://example.org/") {
+			if ev.Title == "" {
+				t.Errorf("event with empty title: %+v", ev)
+			}
+		}
+	})
+}
+
+func FuzzParseHeuristicDOM(f *testing.F) {
+	addFixtureSeeds(f)
+	f.Add(`<article class="event"><h3>Madama Butterfly “Un bel dì”</h3><p>March 6, 2027</p><a href="/mb">x</a></article>`)
+	f.Add(`<div class="calendar"><div class="event"><div class="event"><b>Tosca</b> 2027-01-01</div></div></div>`)
+
+	f.Fuzz(func(t *testing.T, page string) {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+		if err != nil {
+			return
+		}
+		for _, ev := range parseHeuristicDOM(doc, "https://example.org/calendar") {
+			if ev.Title == "" || len(ev.Dates) == 0 {
+				t.Errorf("incomplete event: %+v", ev)
+			}
+		}
+	})
+}
+
+func FuzzParseGenericEvents(f *testing.F) {
+	addFixtureSeeds(f)
+
+	f.Fuzz(func(t *testing.T, page string) {
+		events, strategy := ParseGenericEvents([]byte(page), "https://example.org/")
+		if len(events) == 0 && strategy != "none" && strategy != "error" {
+			t.Errorf("no events but strategy %q", strategy)
+		}
+	})
+}
+
+func FuzzExtractDates(f *testing.F) {
+	f.Add("Saturday, November 8, 2026 at 7:30pm")
+	f.Add("2026-11-08 · 8 November 2026 · 11/08/2026 · Nov 8, 2026")
+	f.Add("8 November 2026")
+	f.Add("\xff\xfe2026-01-01")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		for _, d := range extractDates(text) {
+			if !strings.Contains(text, d) {
+				t.Errorf("extractDates(%q) returned %q, not a substring", text, d)
+			}
+			parseEventDate(d)
+		}
+	})
+}
+
+func FuzzSanitizeID(f *testing.F) {
+	for _, title := range fuzzTitles {
+		f.Add(title)
+	}
+	f.Add("Madama Butterfly “Un bel dì vedremo” – a new production by the company")
+	f.Add("\xff\xfe\xfd")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		id := sanitizeID(s)
+		if !utf8.ValidString(id) {
+			t.Errorf("sanitizeID(%q) = %q, not valid UTF-8", s, id)
+		}
+		if n := utf8.RuneCountInString(id); n > 40 {
+			t.Errorf("sanitizeID(%q) has %d runes, want <= 40", s, n)
+		}
+		if strings.ContainsAny(id, " /\\|") {
+			t.Errorf("sanitizeID(%q) = %q contains a separator", s, id)
+		}
+		if strings.ContainsFunc(s, unicode.IsLetter) && strings.Trim(id, "_") == "" && utf8.ValidString(s) && utf8.RuneCountInString(strings.TrimSpace(s)) <= 40 {
+			t.Errorf("sanitizeID(%q) = %q dropped every letter", s, id)
+		}
+	})
+}
+
+func FuzzFuzzyMatchTitle(f *testing.F) {
+	for _, title := range fuzzTitles {
+		f.Add(title)
+	}
+	f.Add("Madama Butterfly “a new production”")
+	f.Add("LA TRAVIATA")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, title string) {
+		match, score := FuzzyMatchTitle(title, fuzzTitles)
+		if score < 0 || score > 1 {
+			t.Errorf("FuzzyMatchTitle(%q) score %v out of range", title, score)
+		}
+		if match == "" {
+			if score != 0 {
+				t.Errorf("FuzzyMatchTitle(%q) has score %v but no match", title, score)
+			}
+			return
+		}
+		found := false
+		for _, known := range fuzzTitles {
+			found = found || known == match
+		}
+		if !found {
+			t.Errorf("FuzzyMatchTitle(%q) = %q, not a known title", title, match)
+		}
+	})
+}
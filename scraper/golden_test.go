@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files from current parser output")
+
+// goldenResult is what a fixture's .golden.json records.
+type goldenResult struct {
+	Strategy string             `json:"strategy,omitempty"`
+	Events   []PerformanceEvent `json:"events"`
+}
+
+// TestParserGolden runs every fixture under testdata/parsers through its
+// parser and compares the output with the recorded golden file.
+func TestParserGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "parsers", "*", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no parser fixtures found")
+	}
+
+	for _, fixture := range fixtures {
+		parser := filepath.Base(filepath.Dir(fixture))
+		name := strings.TrimSuffix(filepath.Base(fixture), ".html")
+
+		t.Run(parser+"/"+name, func(t *testing.T) {
+			content, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := runFixtureParser(t, parser, content)
+			gotJSON, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON = append(gotJSON, '\n')
+
+			goldenPath := strings.TrimSuffix(fixture, ".html") + ".golden.json"
+			if *update {
+				if err := os.WriteFile(goldenPath, gotJSON, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("reading golden file (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(gotJSON, want) {
+				t.Errorf("output differs from %s (run with -update if the change is intended)\ngot:\n%s\nwant:\n%s", goldenPath, gotJSON, want)
+			}
+		})
+	}
+}
+
+func runFixtureParser(t *testing.T, parser string, content []byte) goldenResult {
+	t.Helper()
+
+	var res goldenResult
+	if parser == "generic" {
+		res.Events, res.Strategy = ParseGenericEvents(content, fixtureSource(content))
+	} else {
+		events, err := GetParser(parser)(content)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		res.Events = events
+	}
+
+	// ScrapedAt is the wall clock at parse time.
+	for i := range res.Events {
+		res.Events[i].ScrapedAt = ""
+	}
+	if res.Events == nil {
+		res.Events = []PerformanceEvent{}
+	}
+	return res
+}
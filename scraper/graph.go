@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// GraphDocument is the subset of the processed graph.json (Graphology format)
+// the scraper needs for matching scraped events to graph nodes.
+type GraphDocument struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	Key        string `json:"key"`
+	Attributes struct {
+		Label        string `json:"label"`
+		Type         string `json:"type"`
+		ComposerID   string `json:"composerId"`
+		ComposerName string `json:"composerName"`
+		// Optional alternative titles, e.g. translations or Wikidata
+		// labels keyed by language code.
+		Aliases []string          `json:"aliases"`
+		Labels  map[string]string `json:"labels"`
+	} `json:"attributes"`
+}
+
+type GraphEdge struct {
+	Key        string `json:"key"`
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	Attributes struct {
+		Type string `json:"type"`
+	} `json:"attributes"`
+}
+
+func graphPath(dataDir string) string {
+	return filepath.Join(dataDir, "data", "processed", "graph.json")
+}
+
+// LoadGraph reads graph.json from the processed data directory.
+func LoadGraph(dataDir string) (*GraphDocument, error) {
+	data, err := os.ReadFile(graphPath(dataDir))
+	if err != nil {
+		return nil, err
+	}
+	var g GraphDocument
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Operas returns every opera node with its alternative titles.
+func (g *GraphDocument) Operas() []OperaTitle {
+	var operas []OperaTitle
+	for _, n := range g.Nodes {
+		if n.Attributes.Type != "opera" || n.Attributes.Label == "" {
+			continue
+		}
+		op := OperaTitle{Key: n.Key, Title: n.Attributes.Label}
+		op.Aliases = append(op.Aliases, n.Attributes.Aliases...)
+		langs := make([]string, 0, len(n.Attributes.Labels))
+		for lang := range n.Attributes.Labels {
+			langs = append(langs, lang)
+		}
+		sort.Strings(langs)
+		for _, lang := range langs {
+			op.Aliases = append(op.Aliases, n.Attributes.Labels[lang])
+		}
+		operas = append(operas, op)
+	}
+	return operas
+}
+
+// GraphIndex holds the lookups the scraper builds over graph.json.
+type GraphIndex struct {
+	Matcher   *TitleMatcher
+	Composers *ComposerIndex
+	Nodes     map[string]GraphNode
+}
+
+// LoadGraphIndex builds the title matcher, composer index and node lookup
+// over graph.json. All are empty if the graph has not been built yet.
+func LoadGraphIndex(dataDir string) *GraphIndex {
+	g, err := LoadGraph(dataDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to load graph.json: %v", err)
+		}
+		return &GraphIndex{Matcher: NewTitleMatcher(nil), Composers: NewComposerIndex(nil), Nodes: map[string]GraphNode{}}
+	}
+	nodes := make(map[string]GraphNode, len(g.Nodes))
+	for _, n := range g.Nodes {
+		nodes[n.Key] = n
+	}
+	return &GraphIndex{Matcher: NewTitleMatcher(g.Operas()), Composers: NewComposerIndex(g), Nodes: nodes}
+}
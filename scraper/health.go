@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHealthRuns is how many runs per venue are kept for trend detection.
+const maxHealthRuns = 20
+
+// VenueRun records the outcome of scraping one venue in one run.
+type VenueRun struct {
+	At            string   `json:"at"`
+	Events        int      `json:"events"`
+	Rejected      int      `json:"rejected,omitempty"`
+	Parser        string   `json:"parser"`
+	Strategy      string   `json:"strategy,omitempty"`
+	CacheHit      bool     `json:"cache_hit"`
+	FetchMs       int64    `json:"fetch_ms,omitempty"`
+	Strikes       int      `json:"strikes"`
+	Error         string   `json:"error,omitempty"`
+	MissingMarkup []string `json:"missing_markup,omitempty"`
+}
+
+// VenueHealth is the health history of one venue across runs.
+type VenueHealth struct {
+	VenueCode   string     `json:"venue_code"`
+	Region      string     `json:"region"`
+	Status      string     `json:"status"` // "ok", "degraded" or "failing"
+	LastSuccess string     `json:"last_success,omitempty"`
+	Anomalies   []string   `json:"anomalies"`
+	Runs        []VenueRun `json:"runs"`
+}
+
+// HealthStore persists venue health to data/health/venues.json so drift is
+// detected across separate CLI and server runs.
+type HealthStore struct {
+	mu     sync.Mutex
+	path   string
+	venues map[string]*VenueHealth
+}
+
+func healthPath(dataDir string) string {
+	return filepath.Join(dataDir, "data", "health", "venues.json")
+}
+
+// NewHealthStore loads existing health history from dataDir, if any.
+func NewHealthStore(dataDir string) *HealthStore {
+	hs := &HealthStore{
+		path:   healthPath(dataDir),
+		venues: make(map[string]*VenueHealth),
+	}
+	for _, vh := range loadVenueHealth(dataDir) {
+		vh := vh
+		hs.venues[vh.VenueCode] = &vh
+	}
+	return hs
+}
+
+func loadVenueHealth(dataDir string) []VenueHealth {
+	data, err := os.ReadFile(healthPath(dataDir))
+	if err != nil {
+		return nil
+	}
+	var venues []VenueHealth
+	if err := json.Unmarshal(data, &venues); err != nil {
+		log.Printf("Failed to parse venue health: %v", err)
+		return nil
+	}
+	return venues
+}
+
+// Record appends a run for a venue, re-evaluates its anomalies, logs any it
+// finds and saves the store.
+func (hs *HealthStore) Record(region, venueCode string, run VenueRun) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	vh, ok := hs.venues[venueCode]
+	if !ok {
+		vh = &VenueHealth{VenueCode: venueCode}
+		hs.venues[venueCode] = vh
+	}
+	vh.Region = region
+
+	previous := vh.Runs
+	vh.Anomalies = detectAnomalies(previous, run)
+	vh.Runs = append(vh.Runs, run)
+	if len(vh.Runs) > maxHealthRuns {
+		vh.Runs = vh.Runs[len(vh.Runs)-maxHealthRuns:]
+	}
+	if run.Error == "" && run.Events > 0 {
+		vh.LastSuccess = run.At
+	}
+	vh.Status = healthStatus(run, vh.Anomalies)
+
+	for _, a := range vh.Anomalies {
+		log.Printf("[%s] HEALTH %s: %s", venueCode, strings.ToUpper(vh.Status), a)
+	}
+
+	if err := hs.save(); err != nil {
+		log.Printf("Failed to save venue health: %v", err)
+	}
+}
+
+// save writes the health file atomically. Callers hold hs.mu.
+func (hs *HealthStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(hs.path), 0755); err != nil {
+		return err
+	}
+	data, _ := json.MarshalIndent(sortedVenueHealth(hs.venues), "", "  ")
+	tmp := hs.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, hs.path)
+}
+
+func sortedVenueHealth(venues map[string]*VenueHealth) []VenueHealth {
+	out := make([]VenueHealth, 0, len(venues))
+	for _, vh := range venues {
+		out = append(out, *vh)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Region != out[j].Region {
+			return out[i].Region < out[j].Region
+		}
+		return out[i].VenueCode < out[j].VenueCode
+	})
+	return out
+}
+
+func healthStatus(run VenueRun, anomalies []string) string {
+	switch {
+	case run.Error != "" || (run.Events == 0 && len(anomalies) > 0):
+		return "failing"
+	case len(anomalies) > 0:
+		return "degraded"
+	default:
+		return "ok"
+	}
+}
+
+// detectAnomalies compares a run against the venue's recent history.
+func detectAnomalies(previous []VenueRun, run VenueRun) []string {
+	anomalies := []string{}
+
+	if run.Error != "" {
+		anomalies = append(anomalies, "scrape failed: "+run.Error)
+		failures := 1
+		for i := len(previous) - 1; i >= 0 && previous[i].Error != ""; i-- {
+			failures++
+		}
+		if failures >= 3 {
+			anomalies = append(anomalies, fmt.Sprintf("failed %d runs in a row", failures))
+		}
+	}
+
+	if len(run.MissingMarkup) > 0 {
+		anomalies = append(anomalies, fmt.Sprintf("%s parser selectors no longer match: %s", run.Parser, strings.Join(run.MissingMarkup, ", ")))
+	}
+
+	last, ok := lastSuccessfulRun(previous)
+	if !ok || run.Error != "" {
+		return anomalies
+	}
+
+	usual := medianEvents(previous)
+	switch {
+	case run.Events == 0:
+		anomalies = append(anomalies, fmt.Sprintf("event count dropped from %d to 0", last.Events))
+	case usual >= 4 && run.Events*2 < usual:
+		anomalies = append(anomalies, fmt.Sprintf("event count dropped from a usual %d to %d", usual, run.Events))
+	}
+
+	if run.Strategy != "" && last.Strategy != "" && run.Strategy != last.Strategy {
+		anomalies = append(anomalies, fmt.Sprintf("strategy changed from %s to %s", last.Strategy, run.Strategy))
+	}
+
+	if !run.CacheHit && run.FetchMs > 0 {
+		if usualMs := medianFetchMs(previous); usualMs > 0 && run.FetchMs > 3*usualMs {
+			anomalies = append(anomalies, fmt.Sprintf("fetch took %.1fs, usually %.1fs", float64(run.FetchMs)/1000, float64(usualMs)/1000))
+		}
+	}
+
+	return anomalies
+}
+
+func lastSuccessfulRun(runs []VenueRun) (VenueRun, bool) {
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Error == "" && runs[i].Events > 0 {
+			return runs[i], true
+		}
+	}
+	return VenueRun{}, false
+}
+
+func medianEvents(runs []VenueRun) int {
+	var counts []int
+	for _, r := range runs {
+		if r.Error == "" && r.Events > 0 {
+			counts = append(counts, r.Events)
+		}
+	}
+	if len(counts) == 0 {
+		return 0
+	}
+	sort.Ints(counts)
+	return counts[len(counts)/2]
+}
+
+func medianFetchMs(runs []VenueRun) int64 {
+	var ms []int64
+	for _, r := range runs {
+		if !r.CacheHit && r.FetchMs > 0 {
+			ms = append(ms, r.FetchMs)
+		}
+	}
+	if len(ms) == 0 {
+		return 0
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i] < ms[j] })
+	return ms[len(ms)/2]
+}
+
+// runStrategy summarises how a venue's events were extracted: the generic
+// strategies that contributed, in precedence order, or the parser name for
+// venue-specific parsers.
+func runStrategy(parser string, events []PerformanceEvent) string {
+	if parser != "generic" {
+		return parser
+	}
+	used := make(map[string]bool)
+	for _, ev := range events {
+		for _, s := range ev.Strategies {
+			used[s] = true
+		}
+	}
+	var out []string
+	for _, s := range strategyPrecedence {
+		if used[s] {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "+")
+}
+
+// newVenueRun starts a run record stamped with the current time.
+func newVenueRun() VenueRun {
+	return VenueRun{At: time.Now().Format(time.RFC3339)}
+}
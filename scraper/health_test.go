@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	history := []VenueRun{
+		{Events: 38, Parser: "laopera", Strategy: "laopera", FetchMs: 3000},
+		{Events: 40, Parser: "laopera", Strategy: "laopera", FetchMs: 2800},
+		{Events: 40, Parser: "laopera", Strategy: "laopera", FetchMs: 3200},
+	}
+
+	tests := []struct {
+		name string
+		prev []VenueRun
+		run  VenueRun
+		want []string
+	}{
+		{
+			name: "steady",
+			prev: history,
+			run:  VenueRun{Events: 41, Parser: "laopera", Strategy: "laopera", FetchMs: 3100},
+			want: []string{},
+		},
+		{
+			name: "redesign",
+			prev: history,
+			run:  VenueRun{Events: 0, Parser: "laopera", Strategy: "laopera", MissingMarkup: []string{".calendar__event-item"}},
+			want: []string{
+				"laopera parser selectors no longer match: .calendar__event-item",
+				"event count dropped from 40 to 0",
+			},
+		},
+		{
+			name: "partial drop",
+			prev: history,
+			run:  VenueRun{Events: 12, Parser: "laopera", Strategy: "laopera", FetchMs: 3000},
+			want: []string{"event count dropped from a usual 40 to 12"},
+		},
+		{
+			name: "strategy change and slow fetch",
+			prev: []VenueRun{{Events: 5, Parser: "generic", Strategy: "json-ld", FetchMs: 2000}},
+			run:  VenueRun{Events: 5, Parser: "generic", Strategy: "heuristic+meta", FetchMs: 9000},
+			want: []string{
+				"strategy changed from json-ld to heuristic+meta",
+				"fetch took 9.0s, usually 2.0s",
+			},
+		},
+		{
+			name: "repeated failures",
+			prev: append(history, VenueRun{Error: "navigating: timeout"}, VenueRun{Error: "navigating: timeout"}),
+			run:  VenueRun{Error: "navigating: timeout"},
+			want: []string{"scrape failed: navigating: timeout", "failed 3 runs in a row"},
+		},
+		{
+			name: "first run empty",
+			run:  VenueRun{Events: 0, Parser: "generic"},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectAnomalies(tt.prev, tt.run); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectAnomalies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthStorePersists(t *testing.T) {
+	dir := t.TempDir()
+
+	hs := NewHealthStore(dir)
+	hs.Record("socal", "laopera", VenueRun{Events: 40, Parser: "laopera"})
+	hs.Record("socal", "laopera", VenueRun{Events: 0, Parser: "laopera"})
+
+	venues := loadVenueHealth(dir)
+	if len(venues) != 1 {
+		t.Fatalf("got %d venues, want 1", len(venues))
+	}
+	if venues[0].Status != "failing" || len(venues[0].Runs) != 2 {
+		t.Errorf("got status %q with %d runs, want failing with 2", venues[0].Status, len(venues[0].Runs))
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // venue time zones must resolve on hosts without zoneinfo
+	"unicode/utf8"
+)
+
+const (
+	icalProdID = "-//Violetta Opera Graph//Scraper//EN"
+	icalDomain = "violetta-opera-graph"
+	// Performances rarely list an end time; assume a typical opera evening.
+	icalDefaultDuration = "PT3H"
+	icalMaxLineOctets   = 75
+)
+
+// stateTimezones maps venue states to the zone their local times are in.
+var stateTimezones = map[string]string{
+	"AZ": "America/Phoenix", "CA": "America/Los_Angeles", "CO": "America/Denver",
+	"DC": "America/New_York", "FL": "America/New_York", "GA": "America/New_York",
+	"HI": "Pacific/Honolulu", "IL": "America/Chicago", "MA": "America/New_York",
+	"MN": "America/Chicago", "NM": "America/Denver", "NV": "America/Los_Angeles",
+	"NY": "America/New_York", "OR": "America/Los_Angeles", "PA": "America/New_York",
+	"TX": "America/Chicago", "UT": "America/Denver", "WA": "America/Los_Angeles",
+}
+
+// clockTimeRe finds a time of day such as "7:30 PM", "2pm" or "19:30".
+var clockTimeRe = regexp.MustCompile(`(?i)\b(\d{1,2})(?::(\d{2}))?\s*([ap])\.?m\b|\b(\d{1,2}):(\d{2})\b`)
+
+// icalOccurrence is one performance date of an event.
+type icalOccurrence struct {
+	Event  PerformanceEvent
+	Start  time.Time
+	AllDay bool
+	Loc    *time.Location // nil for floating or UTC times
+	// The date carried its own offset but the venue's zone is unknown, so
+	// Start is written in UTC rather than as a floating time.
+	UTC bool
+}
+
+// UID is stable across exports as long as the event's key and date are.
+// The key carries the venue or source, as event IDs are only unique within
+// one.
+func (o icalOccurrence) UID() string {
+	stamp := o.Start.Format("20060102")
+	if !o.AllDay {
+		stamp = o.Start.Format("20060102T1504")
+	}
+	return fmt.Sprintf("%s-%s@%s", eventKey(o.Event), stamp, icalDomain)
+}
+
+// eventLocation returns the venue's time zone, or nil if it is unknown and
+// times should be written as floating local times.
+func eventLocation(ev PerformanceEvent) *time.Location {
+	name, ok := stateTimezones[strings.ToUpper(strings.TrimSpace(ev.State))]
+	if !ok {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// parseOccurrence interprets one of an event's date strings in the venue's
+// time zone. Dates without a time of day become all-day occurrences. If loc
+// is nil, dates with an offset are converted to UTC.
+func parseOccurrence(date string, loc *time.Location) (time.Time, bool, bool) {
+	date = strings.TrimSpace(date)
+	in := loc
+	if in == nil {
+		in = time.UTC
+	}
+
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		return t.In(in), false, true
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, date, in); err == nil {
+			return t, false, true
+		}
+	}
+
+	day, ok := parseEventDate(date)
+	if !ok {
+		return time.Time{}, false, false
+	}
+	// Look for a time of day outside the date itself.
+	rest := date
+	if found := extractDates(date); len(found) > 0 {
+		rest = strings.Replace(date, found[0], " ", 1)
+	}
+	if hour, minute, ok := parseClockTime(rest); ok {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, in), false, true
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, in), true, true
+}
+
+// hasOffset reports whether date is an RFC 3339 time with its own offset.
+func hasOffset(date string) bool {
+	_, err := time.Parse(time.RFC3339, strings.TrimSpace(date))
+	return err == nil
+}
+
+func parseClockTime(s string) (int, int, bool) {
+	m := clockTimeRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, false
+	}
+	if m[4] != "" {
+		hour, _ := strconv.Atoi(m[4])
+		minute, _ := strconv.Atoi(m[5])
+		return hour, minute, hour < 24 && minute < 60
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute := 0
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	if hour < 1 || hour > 12 || minute > 59 {
+		return 0, 0, false
+	}
+	hour %= 12
+	if strings.EqualFold(m[3], "p") {
+		hour += 12
+	}
+	return hour, minute, true
+}
+
+// icalOccurrences expands events into one occurrence per parseable date,
+// dropping duplicates of the same event and date.
+func icalOccurrences(events []PerformanceEvent) []icalOccurrence {
+	seen := make(map[string]bool)
+	var out []icalOccurrence
+	for _, ev := range events {
+		loc := eventLocation(ev)
+		for _, d := range ev.Dates {
+			start, allDay, ok := parseOccurrence(d, loc)
+			if !ok {
+				continue
+			}
+			o := icalOccurrence{Event: ev, Start: start, AllDay: allDay, Loc: loc, UTC: loc == nil && hasOffset(d)}
+			if uid := o.UID(); !seen[uid] {
+				seen[uid] = true
+				out = append(out, o)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// WriteICalendar writes events as an RFC 5545 calendar named name, with one
+// VEVENT per performance date and a VTIMEZONE for every venue zone used.
+func WriteICalendar(w io.Writer, name string, events []PerformanceEvent) error {
+	occurrences := icalOccurrences(events)
+	iw := &icalWriter{w: bufio.NewWriter(w)}
+
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:" + icalProdID)
+	iw.line("CALSCALE:GREGORIAN")
+	iw.line("METHOD:PUBLISH")
+	if name != "" {
+		iw.line("X-WR-CALNAME:" + icalEscape(name))
+	}
+
+	for _, tz := range icalTimezones(occurrences) {
+		writeVTimezone(iw, tz.loc, tz.from, tz.to)
+	}
+	for _, o := range occurrences {
+		writeVEvent(iw, o)
+	}
+
+	iw.line("END:VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+func writeVEvent(iw *icalWriter, o icalOccurrence) {
+	ev := o.Event
+	iw.line("BEGIN:VEVENT")
+	iw.line("UID:" + icalEscape(o.UID()))
+	iw.line("DTSTAMP:" + icalStamp(ev.ScrapedAt))
+	switch {
+	case o.AllDay:
+		iw.line("DTSTART;VALUE=DATE:" + o.Start.Format("20060102"))
+		iw.line("DTEND;VALUE=DATE:" + o.Start.AddDate(0, 0, 1).Format("20060102"))
+	case o.Loc != nil:
+		iw.line(fmt.Sprintf("DTSTART;TZID=%s:%s", o.Loc.String(), o.Start.Format("20060102T150405")))
+		iw.line("DURATION:" + icalDefaultDuration)
+	case o.UTC:
+		iw.line("DTSTART:" + o.Start.UTC().Format("20060102T150405Z"))
+		iw.line("DURATION:" + icalDefaultDuration)
+	default:
+		iw.line("DTSTART:" + o.Start.Format("20060102T150405"))
+		iw.line("DURATION:" + icalDefaultDuration)
+	}
+
+	summary := ev.Title
+	if ev.VenueName != "" {
+		summary += " – " + ev.VenueName
+	}
+	iw.line("SUMMARY:" + icalEscape(summary))
+
+	var location []string
+	for _, part := range []string{ev.VenueName, ev.City, ev.State} {
+		if part != "" {
+			location = append(location, part)
+		}
+	}
+	if len(location) > 0 {
+		iw.line("LOCATION:" + icalEscape(strings.Join(location, ", ")))
+	}
+
+	var description []string
+	if ev.Composer != "" {
+		description = append(description, "Composer: "+ev.Composer)
+		iw.line("CATEGORIES:" + icalEscape(ev.Composer))
+	}
+	if ev.SourceURL != "" {
+		description = append(description, ev.SourceURL)
+		iw.line("URL:" + ev.SourceURL)
+	}
+	if len(description) > 0 {
+		iw.line("DESCRIPTION:" + icalEscape(strings.Join(description, "\n")))
+	}
+	if ev.MatchedOperaKey != "" {
+		iw.line("X-VIOLETTA-OPERA:" + icalEscape(ev.MatchedOperaKey))
+	}
+	iw.line("END:VEVENT")
+}
+
+// icalStamp formats the scrape time as the event's DTSTAMP so repeated
+// exports of unchanged data are byte-identical.
+func icalStamp(scrapedAt string) string {
+	t, err := time.Parse(time.RFC3339, scrapedAt)
+	if err != nil {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format("20060102T150405Z")
+}
+
+type icalTimezone struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// icalTimezones returns each zone used by a timed occurrence with the span
+// of dates its definition must cover.
+func icalTimezones(occurrences []icalOccurrence) []icalTimezone {
+	byName := make(map[string]*icalTimezone)
+	var names []string
+	for _, o := range occurrences {
+		if o.AllDay || o.Loc == nil {
+			continue
+		}
+		tz, ok := byName[o.Loc.String()]
+		if !ok {
+			tz = &icalTimezone{loc: o.Loc, from: o.Start, to: o.Start}
+			byName[o.Loc.String()] = tz
+			names = append(names, o.Loc.String())
+		}
+		if o.Start.Before(tz.from) {
+			tz.from = o.Start
+		}
+		if o.Start.After(tz.to) {
+			tz.to = o.Start
+		}
+	}
+	sort.Strings(names)
+	out := make([]icalTimezone, 0, len(names))
+	for _, n := range names {
+		out = append(out, *byName[n])
+	}
+	return out
+}
+
+// writeVTimezone describes loc's offsets for the calendar years spanning
+// from..to. Go does not expose zone rules, so each transition is found by
+// probing and written as its own STANDARD or DAYLIGHT observance.
+func writeVTimezone(iw *icalWriter, loc *time.Location, from, to time.Time) {
+	start := time.Date(from.Year(), 1, 1, 0, 0, 0, 0, loc)
+	end := time.Date(to.Year()+1, 1, 1, 0, 0, 0, 0, loc)
+
+	iw.line("BEGIN:VTIMEZONE")
+	iw.line("TZID:" + loc.String())
+
+	name, offset := start.In(loc).Zone()
+	writeObservance(iw, start.In(loc).IsDST(), start, offset, offset, name)
+
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		_, nextOffset := next.In(loc).Zone()
+		if nextOffset == offset {
+			continue
+		}
+		// Zone changes fall on whole seconds, so this finds the exact instant.
+		lo, hi := day, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		newName, newOffset := hi.In(loc).Zone()
+		writeObservance(iw, hi.In(loc).IsDST(), hi, offset, newOffset, newName)
+		offset = newOffset
+	}
+
+	iw.line("END:VTIMEZONE")
+}
+
+// writeObservance writes one observance starting at instant at, whose
+// DTSTART is expressed in the local time in effect before it.
+func writeObservance(iw *icalWriter, dst bool, at time.Time, fromOffset, toOffset int, name string) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+	iw.line("BEGIN:" + kind)
+	iw.line("DTSTART:" + at.UTC().Add(time.Duration(fromOffset)*time.Second).Format("20060102T150405"))
+	iw.line("TZOFFSETFROM:" + icalOffset(fromOffset))
+	iw.line("TZOFFSETTO:" + icalOffset(toOffset))
+	if name != "" {
+		iw.line("TZNAME:" + icalEscape(name))
+	}
+	iw.line("END:" + kind)
+}
+
+func icalOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// icalEscape escapes a TEXT value.
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// icalWriter writes content lines with CRLF endings, folding lines longer
+// than 75 octets without splitting UTF-8 sequences.
+type icalWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (iw *icalWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+	limit := icalMaxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, iw.err = iw.w.WriteString(s[:cut] + "\r\n "); iw.err != nil {
+			return
+		}
+		s = s[cut:]
+		limit = icalMaxLineOctets - 1 // continuation lines start with a space
+	}
+	_, iw.err = iw.w.WriteString(s + "\r\n")
+}
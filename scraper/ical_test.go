@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteICalendar(t *testing.T) {
+	events := []PerformanceEvent{
+		{
+			EventID:   "laopera_tosca",
+			Region:    "socal",
+			VenueCode: "laopera",
+			Title:     "Tosca",
+			Composer:  "Giacomo Puccini",
+			Dates:     []string{"2026-11-08 7:30 PM", "2026-11-08 7:30 PM", "2026-11-15 2:00 PM"},
+			VenueName: "Dorothy Chandler Pavilion",
+			City:      "Los Angeles",
+			State:     "CA",
+			SourceURL: "https://www.laopera.org/performances/tosca/",
+			ScrapedAt: "2026-10-01T12:00:00Z",
+		},
+		{
+			EventID:   "custom_gala",
+			Title:     "Season Gala; with a very long title, that needs folding across several content lines",
+			Dates:     []string{"December 7, 2026", "not a date"},
+			ScrapedAt: "2026-10-01T12:00:00Z",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, "Opera: Puccini in socal", events); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Opera: Puccini in socal\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:America/Los_Angeles\r\n",
+		// DST ends 2026-11-01 at 02:00 PDT.
+		"BEGIN:STANDARD\r\nDTSTART:20261101T020000\r\nTZOFFSETFROM:-0700\r\nTZOFFSETTO:-0800\r\nTZNAME:PST\r\n",
+		"UID:laopera:laopera_tosca-20261108T1930@violetta-opera-graph\r\n",
+		"DTSTART;TZID=America/Los_Angeles:20261108T193000\r\nDURATION:PT3H\r\n",
+		"DTSTART;TZID=America/Los_Angeles:20261115T140000\r\n",
+		"DTSTAMP:20261001T120000Z\r\n",
+		"LOCATION:Dorothy Chandler Pavilion\\, Los Angeles\\, CA\r\n",
+		"DTSTART;VALUE=DATE:20261207\r\nDTEND;VALUE=DATE:20261208\r\n",
+		"SUMMARY:Season Gala\\; with a very long title\\, that needs folding across se\r\n veral content lines\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("calendar missing %q", want)
+		}
+	}
+
+	if n := strings.Count(out, "BEGIN:VEVENT"); n != 3 {
+		t.Errorf("got %d VEVENTs, want 3 (duplicate and unparseable dates dropped)", n)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+}
+
+func TestWriteICalendarSharedEventID(t *testing.T) {
+	// Two venues whose parsers give a production the same ID.
+	events := []PerformanceEvent{
+		{EventID: "tosca-2026", VenueCode: "laopera", Title: "Tosca", Dates: []string{"2026-11-08 7:30 PM"}, State: "CA"},
+		{EventID: "tosca-2026", VenueCode: "sfopera", Title: "Tosca", Dates: []string{"2026-11-08 7:30 PM"}, State: "CA"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, "Tosca", events); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if n := strings.Count(out, "BEGIN:VEVENT"); n != 2 {
+		t.Errorf("got %d VEVENTs, want one per venue", n)
+	}
+	for _, want := range []string{
+		"UID:laopera:tosca-2026-20261108T1930@violetta-opera-graph\r\n",
+		"UID:sfopera:tosca-2026-20261108T1930@violetta-opera-graph\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("calendar missing %q", want)
+		}
+	}
+}
+
+func TestParseOccurrence(t *testing.T) {
+	tests := []struct {
+		date   string
+		want   string
+		allDay bool
+	}{
+		{"2026-11-08 7:30 PM", "2026-11-08T19:30:00-08:00", false},
+		{"2026-10-24T19:30", "2026-10-24T19:30:00-07:00", false},
+		{"2026-10-24T19:30:00Z", "2026-10-24T12:30:00-07:00", false},
+		{"Saturday, March 6, 2027 at 8pm", "2027-03-06T20:00:00-08:00", false},
+		{"2026-12-07", "2026-12-07T00:00:00-08:00", true},
+	}
+
+	loc := eventLocation(PerformanceEvent{State: "CA"})
+	for _, tt := range tests {
+		got, allDay, ok := parseOccurrence(tt.date, loc)
+		if !ok || got.Format("2006-01-02T15:04:05-07:00") != tt.want || allDay != tt.allDay {
+			t.Errorf("parseOccurrence(%q) = %s allDay=%v ok=%v, want %s allDay=%v",
+				tt.date, got.Format("2006-01-02T15:04:05-07:00"), allDay, ok, tt.want, tt.allDay)
+		}
+	}
+}
+
+func TestWriteICalendarUnknownZone(t *testing.T) {
+	events := []PerformanceEvent{{
+		EventID:   "custom_carmen",
+		Title:     "Carmen",
+		Dates:     []string{"2026-11-08T19:30:00-08:00", "2026-11-10T19:30"},
+		ScrapedAt: "2026-10-01T12:00:00Z",
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, "Opera", events); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		// An offset with no venue zone is written in UTC...
+		"DTSTART:20261109T033000Z\r\n",
+		// ...and a time with no zone at all stays floating.
+		"DTSTART:20261110T193000\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("calendar missing %q", want)
+		}
+	}
+	if strings.Contains(out, "BEGIN:VTIMEZONE") {
+		t.Error("calendar has a VTIMEZONE with no zoned events")
+	}
+}
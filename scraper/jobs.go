@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// maxJobHistory is how many jobs are kept in data/jobs/jobs.json.
+	maxJobHistory = 100
+	// Progress events are kept in memory only, for the most recent jobs.
+	maxProgressJobs   = 10
+	maxProgressEvents = 2000
+	// subscriberBuffer is how far a progress stream may fall behind before
+	// it is closed; the client reconnects with Last-Event-ID.
+	subscriberBuffer = 256
+)
+
+const (
+	JobRunning     = "running"
+	JobSucceeded   = "succeeded"
+	JobFailed      = "failed"
+	JobCancelled   = "cancelled"
+	JobInterrupted = "interrupted" // the server stopped while it was running
+)
+
+var (
+	errJobRunning    = errors.New("a scrape job is already running")
+	errJobNotFound   = errors.New("job not found")
+	errJobNotRunning = errors.New("job is not running")
+)
+
+// Job is one scrape run started through the API, with per-venue progress.
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"` // "scrape" or "scrape-url"
+	State      string          `json:"state"`
+	Regions    []string        `json:"regions,omitempty"`
+	Venues     []string        `json:"venues,omitempty"`
+	URL        string          `json:"url,omitempty"`
+	Schedule   string          `json:"schedule,omitempty"` // scheduler entry that started it
+	Progress   []VenueProgress `json:"progress"`
+	Done       int             `json:"done"` // venues finished, failed or not
+	Total      int             `json:"total"`
+	Events     int             `json:"events"`
+	Failed     int             `json:"failed"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  string          `json:"started_at"`
+	FinishedAt string          `json:"finished_at,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// VenueProgress is one venue's part in a job.
+type VenueProgress struct {
+	Region     string `json:"region"`
+	Venue      string `json:"venue"`
+	State      string `json:"state"` // "pending", "running", "done", "failed" or "skipped"
+	Events     int    `json:"events"`
+	Rejected   int    `json:"rejected,omitempty"`
+	CacheHit   bool   `json:"cache_hit,omitempty"`
+	Error      string `json:"error,omitempty"`
+	StartedAt  string `json:"started_at,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+func (j *Job) clone() Job {
+	c := *j
+	c.Progress = append([]VenueProgress(nil), j.Progress...)
+	return c
+}
+
+func (j *Job) venue(region, venue string) *VenueProgress {
+	for i := range j.Progress {
+		if j.Progress[i].Region == region && j.Progress[i].Venue == venue {
+			return &j.Progress[i]
+		}
+	}
+	return nil
+}
+
+// JobManager runs one scrape job at a time and keeps the history of past
+// jobs in data/jobs/jobs.json so it survives restarts.
+type JobManager struct {
+	mu     sync.Mutex
+	path   string
+	jobs   []*Job // oldest first
+	active *Job
+	cancel context.CancelFunc
+
+	progress map[string][]ScrapeProgress // by job ID
+	subs     map[string][]chan ScrapeProgress
+
+	// onFinish, if set, is called with each job once it has finished,
+	// without m.mu held.
+	onFinish func(Job)
+}
+
+// NewJobManager loads the job history. Jobs that were running when the
+// server last stopped are marked interrupted.
+func NewJobManager(dataDir string) *JobManager {
+	m := &JobManager{
+		path:     filepath.Join(dataDir, "data", "jobs", "jobs.json"),
+		progress: make(map[string][]ScrapeProgress),
+		subs:     make(map[string][]chan ScrapeProgress),
+	}
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read job history: %v", err)
+		}
+		return m
+	}
+	if err := json.Unmarshal(data, &m.jobs); err != nil {
+		log.Printf("Failed to parse job history: %v", err)
+		return m
+	}
+	interrupted := false
+	for _, j := range m.jobs {
+		if j.State == JobRunning {
+			j.State = JobInterrupted
+			j.Error = "server stopped while the job was running"
+			interrupted = true
+		}
+	}
+	if interrupted {
+		m.save()
+	}
+	return m
+}
+
+// Start registers a new running job covering targets. It fails with
+// errJobRunning if another job has not finished. Cancelling the job cancels
+// the returned context.
+func (m *JobManager) Start(kind string, req ScrapeRequest, url string, targets []scrapeTarget) (Job, context.Context, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active != nil {
+		return Job{}, nil, errJobRunning
+	}
+
+	job := &Job{
+		ID:        newJobID(),
+		Kind:      kind,
+		State:     JobRunning,
+		Regions:   req.Regions,
+		Venues:    req.Venues,
+		URL:       url,
+		Schedule:  req.Schedule,
+		Progress:  []VenueProgress{},
+		Total:     len(targets),
+		StartedAt: time.Now().Format(time.RFC3339),
+	}
+	for _, t := range targets {
+		job.Progress = append(job.Progress, VenueProgress{Region: t.Region.Code, Venue: t.Venue.Code, State: "pending"})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.active, m.cancel = job, cancel
+	m.jobs = append(m.jobs, job)
+	if len(m.jobs) > maxJobHistory {
+		m.jobs = m.jobs[len(m.jobs)-maxJobHistory:]
+	}
+	if len(m.jobs) > maxProgressJobs {
+		for _, old := range m.jobs[:len(m.jobs)-maxProgressJobs] {
+			delete(m.progress, old.ID)
+		}
+	}
+	m.publish(job, ScrapeProgress{Type: ProgressJobStarted, Time: job.StartedAt, URL: url})
+	m.save()
+	return job.clone(), ctx, nil
+}
+
+// Finish records the outcome of the running job with the given ID.
+func (m *JobManager) Finish(id string, err error) {
+	if job, ok := m.finish(id, err); ok && m.onFinish != nil {
+		m.onFinish(job)
+	}
+}
+
+func (m *JobManager) finish(id string, err error) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := m.find(id)
+	if job == nil {
+		return Job{}, false
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.State = JobCancelled
+	case err != nil:
+		job.State = JobFailed
+		job.Error = err.Error()
+	case job.Failed > 0 && job.Failed == job.Total:
+		job.State = JobFailed
+		job.Error = "every venue failed"
+	default:
+		job.State = JobSucceeded
+	}
+	for i := range job.Progress {
+		if job.Progress[i].State == "pending" {
+			job.Progress[i].State = "skipped"
+		}
+	}
+	finished := time.Now()
+	job.FinishedAt = finished.Format(time.RFC3339)
+	if started, err := time.Parse(time.RFC3339, job.StartedAt); err == nil {
+		job.DurationMs = finished.Sub(started).Milliseconds()
+	}
+
+	if m.active == job {
+		m.cancel()
+		m.active, m.cancel = nil, nil
+	}
+	m.publish(job, ScrapeProgress{Type: ProgressJobFinished, Time: job.FinishedAt, Events: job.Events, State: job.State, Error: job.Error})
+	for _, ch := range m.subs[id] {
+		close(ch)
+	}
+	delete(m.subs, id)
+	m.save()
+	return job.clone(), true
+}
+
+// Cancel asks the running job with the given ID to stop.
+func (m *JobManager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := m.find(id)
+	if job == nil {
+		return Job{}, errJobNotFound
+	}
+	if m.active != job {
+		return job.clone(), errJobNotRunning
+	}
+	m.cancel()
+	return job.clone(), nil
+}
+
+// Get returns the job with the given ID.
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job := m.find(id); job != nil {
+		return job.clone(), true
+	}
+	return Job{}, false
+}
+
+// List returns all jobs, newest first.
+func (m *JobManager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Job, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		out = append(out, m.jobs[i].clone())
+	}
+	return out
+}
+
+// Active returns the running job, if any.
+func (m *JobManager) Active() (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active == nil {
+		return Job{}, false
+	}
+	return m.active.clone(), true
+}
+
+// Latest returns the most recently started job, if any.
+func (m *JobManager) Latest() (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.jobs) == 0 {
+		return Job{}, false
+	}
+	return m.jobs[len(m.jobs)-1].clone(), true
+}
+
+// Observer returns a ScrapeObserver recording venue progress on the job
+// and passing every step on to its progress streams.
+func (m *JobManager) Observer(id string) ScrapeObserver {
+	return jobObserver{m: m, id: id}
+}
+
+// Subscribe returns the job's progress events after sequence number after,
+// and, while the job runs, a channel of the events that follow. The
+// channel is closed when the job finishes or the subscriber falls too far
+// behind; call unsubscribe when done with it.
+func (m *JobManager) Subscribe(id string, after int) (backlog []ScrapeProgress, events <-chan ScrapeProgress, unsubscribe func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := m.find(id)
+	if job == nil {
+		return nil, nil, nil, errJobNotFound
+	}
+
+	for _, p := range m.progress[id] {
+		if p.Seq > after {
+			backlog = append(backlog, p)
+		}
+	}
+	if m.active != job {
+		// Progress of jobs from before a restart is gone; the outcome is not.
+		if _, ok := m.progress[id]; !ok {
+			backlog = append(backlog, ScrapeProgress{Job: id, Type: ProgressJobFinished, Time: job.FinishedAt, Events: job.Events, State: job.State, Error: job.Error})
+		}
+		return backlog, nil, func() {}, nil
+	}
+
+	ch := make(chan ScrapeProgress, subscriberBuffer)
+	m.subs[id] = append(m.subs[id], ch)
+	unsubscribe = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, c := range m.subs[id] {
+			if c == ch {
+				m.subs[id] = append(m.subs[id][:i], m.subs[id][i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+	return backlog, ch, unsubscribe, nil
+}
+
+// publish numbers p, keeps it for late subscribers and sends it to the
+// job's streams. Callers hold m.mu.
+func (m *JobManager) publish(job *Job, p ScrapeProgress) {
+	events := m.progress[job.ID]
+	p.Job = job.ID
+	p.Seq = len(events) + 1
+	if n := len(events); n > 0 {
+		p.Seq = events[n-1].Seq + 1
+	}
+	if len(events) >= maxProgressEvents {
+		events = events[1:]
+	}
+	m.progress[job.ID] = append(events, p)
+
+	subs := m.subs[job.ID][:0]
+	for _, ch := range m.subs[job.ID] {
+		select {
+		case ch <- p:
+			subs = append(subs, ch)
+		default:
+			close(ch)
+		}
+	}
+	m.subs[job.ID] = subs
+}
+
+func (m *JobManager) find(id string) *Job {
+	for _, j := range m.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// save writes the history atomically. Callers hold m.mu.
+func (m *JobManager) save() {
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		log.Printf("Failed to save job history: %v", err)
+		return
+	}
+	data, _ := json.MarshalIndent(m.jobs, "", "  ")
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Failed to save job history: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		log.Printf("Failed to save job history: %v", err)
+	}
+}
+
+type jobObserver struct {
+	m  *JobManager
+	id string
+}
+
+func (o jobObserver) Report(p ScrapeProgress) {
+	o.m.mu.Lock()
+	defer o.m.mu.Unlock()
+	job := o.m.find(o.id)
+	if job == nil {
+		return
+	}
+	o.m.publish(job, p)
+
+	v := job.venue(p.Region, p.Venue)
+	if v == nil {
+		return
+	}
+	switch p.Type {
+	case ProgressVenueStarted:
+		v.State = "running"
+		v.StartedAt = p.Time
+	case ProgressCache:
+		v.CacheHit = p.Cache == "hit"
+	case ProgressVenueFinished:
+		v.State = "done"
+		v.Events = p.Events
+		v.Rejected = p.Rejected
+		v.Error = p.Error
+		if started, err := time.Parse(time.RFC3339, v.StartedAt); err == nil {
+			v.DurationMs = time.Since(started).Milliseconds()
+		}
+		if p.Error != "" {
+			v.State = "failed"
+			job.Failed++
+		}
+		job.Done++
+		job.Events += p.Events
+	default:
+		return
+	}
+	o.m.save()
+}
+
+func newJobID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(b))
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testScrapeConfig() Config {
+	var cfg Config
+	cfg.RegionalVenues.Enabled = true
+	cfg.RegionalVenues.Regions = []RegionConfig{
+		{Code: "socal", Venues: []VenueConfig{{Code: "laopera"}, {Code: "sdopera"}}},
+		{Code: "nm", Venues: []VenueConfig{{Code: "santafeopera"}}},
+	}
+	return cfg
+}
+
+func targetCodes(targets []scrapeTarget) string {
+	var codes []string
+	for _, t := range targets {
+		codes = append(codes, t.Region.Code+"/"+t.Venue.Code)
+	}
+	return strings.Join(codes, ",")
+}
+
+func TestScrapeTargets(t *testing.T) {
+	cfg := testScrapeConfig()
+	tests := []struct {
+		req  ScrapeRequest
+		want string
+		err  bool
+	}{
+		{req: ScrapeRequest{}, want: "socal/laopera,socal/sdopera,nm/santafeopera"},
+		{req: ScrapeRequest{Regions: []string{"NM"}}, want: "nm/santafeopera"},
+		{req: ScrapeRequest{Venues: []string{"sdopera", "santafeopera"}}, want: "socal/sdopera,nm/santafeopera"},
+		{req: ScrapeRequest{Regions: []string{"nm"}, Venues: []string{"laopera"}}, want: ""},
+		{req: ScrapeRequest{Regions: []string{"atl"}}, err: true},
+		{req: ScrapeRequest{Venues: []string{"met"}}, err: true},
+	}
+	for _, tt := range tests {
+		targets, err := scrapeTargets(cfg, tt.req)
+		if (err != nil) != tt.err {
+			t.Errorf("scrapeTargets(%+v) error = %v", tt.req, err)
+			continue
+		}
+		if got := targetCodes(targets); got != tt.want {
+			t.Errorf("scrapeTargets(%+v) = %s, want %s", tt.req, got, tt.want)
+		}
+	}
+}
+
+func TestJobManager(t *testing.T) {
+	dataDir := t.TempDir()
+	m := NewJobManager(dataDir)
+	var finished []Job
+	m.onFinish = func(job Job) { finished = append(finished, job) }
+	targets, _ := scrapeTargets(testScrapeConfig(), ScrapeRequest{Regions: []string{"socal"}})
+
+	job, ctx, err := m.Start("scrape", ScrapeRequest{Regions: []string{"socal"}}, "", targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != JobRunning || job.Total != 2 || len(job.Progress) != 2 {
+		t.Errorf("started job = %+v", job)
+	}
+	if _, _, err := m.Start("scrape", ScrapeRequest{}, "", targets); err != errJobRunning {
+		t.Errorf("second Start error = %v, want errJobRunning", err)
+	}
+
+	obs := m.Observer(job.ID)
+	report(obs, ScrapeProgress{Type: ProgressVenueStarted, Region: "socal", Venue: "laopera"})
+	report(obs, ScrapeProgress{Type: ProgressCache, Region: "socal", Venue: "laopera", Cache: "hit"})
+	report(obs, ScrapeProgress{Type: ProgressVenueFinished, Region: "socal", Venue: "laopera", Events: 4})
+	report(obs, ScrapeProgress{Type: ProgressVenueStarted, Region: "socal", Venue: "sdopera"})
+	report(obs, ScrapeProgress{Type: ProgressVenueFinished, Region: "socal", Venue: "sdopera", Error: "navigating: timeout"})
+	m.Finish(job.ID, nil)
+
+	got, ok := m.Get(job.ID)
+	if !ok {
+		t.Fatal("job not found after finishing")
+	}
+	if got.State != JobSucceeded || got.Done != 2 || got.Events != 4 || got.Failed != 1 || got.FinishedAt == "" {
+		t.Errorf("finished job = %+v", got)
+	}
+	if len(finished) != 1 || finished[0].ID != job.ID || finished[0].State != JobSucceeded {
+		t.Errorf("onFinish got %+v", finished)
+	}
+	if !got.Progress[0].CacheHit || got.Progress[1].State != "failed" || got.Progress[1].Error == "" {
+		t.Errorf("failed venue progress = %+v", got.Progress[1])
+	}
+	if ctx.Err() == nil {
+		t.Error("job context not released after Finish")
+	}
+
+	// A cancelled job leaves the venues it never reached skipped.
+	job2, ctx2, err := m.Start("scrape", ScrapeRequest{}, "", targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Cancel(job.ID); err != errJobNotRunning {
+		t.Errorf("cancelling a finished job: %v", err)
+	}
+	if _, err := m.Cancel("nope"); err != errJobNotFound {
+		t.Errorf("cancelling a missing job: %v", err)
+	}
+	if _, err := m.Cancel(job2.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(ctx2.Err(), context.Canceled) {
+		t.Error("Cancel did not cancel the job context")
+	}
+	m.Finish(job2.ID, ctx2.Err())
+	got, _ = m.Get(job2.ID)
+	if got.State != JobCancelled || got.Progress[0].State != "skipped" {
+		t.Errorf("cancelled job = %+v", got)
+	}
+
+	if list := m.List(); len(list) != 2 || list[0].ID != job2.ID {
+		t.Errorf("List = %+v, want newest first", list)
+	}
+}
+
+func TestJobManagerHistory(t *testing.T) {
+	dataDir := t.TempDir()
+	m := NewJobManager(dataDir)
+	done, _, _ := m.Start("scrape", ScrapeRequest{}, "", nil)
+	m.Finish(done.ID, errors.New("failed to launch browser"))
+	running, _, _ := m.Start("scrape-url", ScrapeRequest{}, "https://example.com", nil)
+
+	// A restart loses the running job but keeps its record.
+	m = NewJobManager(dataDir)
+	if _, ok := m.Active(); ok {
+		t.Error("reloaded manager has an active job")
+	}
+	if got, _ := m.Get(done.ID); got.State != JobFailed || got.Error != "failed to launch browser" {
+		t.Errorf("reloaded failed job = %+v", got)
+	}
+	if got, _ := m.Get(running.ID); got.State != JobInterrupted || got.URL != "https://example.com" {
+		t.Errorf("reloaded running job = %+v", got)
+	}
+	if _, _, err := m.Start("scrape", ScrapeRequest{}, "", nil); err != nil {
+		t.Errorf("Start after reload: %v", err)
+	}
+}
+
+func TestHandleScrapeAndJobs(t *testing.T) {
+	dataDir := t.TempDir()
+	configPath := filepath.Join(dataDir, "config.yaml")
+	config := "regional_venues:\n  enabled: true\n  regions:\n    - code: socal\n      venues:\n        - code: laopera\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(configPath, dataDir, "")
+
+	rec := httptest.NewRecorder()
+	s.handleScrape(rec, httptest.NewRequest("POST", "/api/scrape", strings.NewReader(`{"regions": ["atl"]}`)))
+	if rec.Code != 400 {
+		t.Errorf("unknown region: %d, want 400", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	s.handleScrape(rec, httptest.NewRequest("POST", "/api/scrape", strings.NewReader(`{"venues": ["`+strings.Repeat("x", maxJSONBodyBytes)+`"]}`)))
+	if rec.Code != 413 {
+		t.Errorf("oversized body: %d, want 413", rec.Code)
+	}
+
+	// Hold a job so the API has to refuse a second one.
+	job, _, _ := s.jobs.Start("scrape", ScrapeRequest{}, "", nil)
+	rec = httptest.NewRecorder()
+	s.handleScrape(rec, httptest.NewRequest("POST", "/api/scrape", nil))
+	if rec.Code != 409 {
+		t.Errorf("scrape while running: %d, want 409", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleJob(rec, httptest.NewRequest("DELETE", "/api/jobs/"+job.ID, nil))
+	if rec.Code != 202 {
+		t.Errorf("DELETE running job: %d, want 202", rec.Code)
+	}
+	s.jobs.Finish(job.ID, context.Canceled)
+
+	rec = httptest.NewRecorder()
+	s.handleJob(rec, httptest.NewRequest("DELETE", "/api/jobs/"+job.ID, nil))
+	if rec.Code != 409 {
+		t.Errorf("DELETE finished job: %d, want 409", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	s.handleJob(rec, httptest.NewRequest("GET", "/api/jobs/nope", nil))
+	if rec.Code != 404 {
+		t.Errorf("GET missing job: %d, want 404", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	s.handleJob(rec, httptest.NewRequest("GET", "/api/jobs/"+job.ID, nil))
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `"state":"cancelled"`) {
+		t.Errorf("GET job: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestJobProgressStream(t *testing.T) {
+	m := NewJobManager(t.TempDir())
+	targets, _ := scrapeTargets(testScrapeConfig(), ScrapeRequest{Venues: []string{"laopera"}})
+	job, _, _ := m.Start("scrape", ScrapeRequest{}, "", targets)
+	obs := m.Observer(job.ID)
+	report(obs, ScrapeProgress{Type: ProgressVenueStarted, Region: "socal", Venue: "laopera"})
+
+	// A subscriber gets what it missed, then the rest as it happens.
+	backlog, events, unsubscribe, err := m.Subscribe(job.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	if len(backlog) != 1 || backlog[0].Type != ProgressVenueStarted || backlog[0].Seq != 2 || backlog[0].Job != job.ID {
+		t.Errorf("backlog = %+v", backlog)
+	}
+
+	report(obs, ScrapeProgress{Type: ProgressRobots, Region: "socal", Venue: "laopera", Robots: "allowed"})
+	report(obs, ScrapeProgress{Type: ProgressVenueFinished, Region: "socal", Venue: "laopera", Events: 3})
+	m.Finish(job.ID, nil)
+
+	var types []string
+	for p := range events {
+		types = append(types, p.Type)
+	}
+	if got := strings.Join(types, ","); got != "robots,venue_finished,job_finished" {
+		t.Errorf("streamed %s", got)
+	}
+
+	// After the job, the whole log is replayed and no stream is opened.
+	backlog, events, _, _ = m.Subscribe(job.ID, 0)
+	if events != nil || len(backlog) != 5 || backlog[4].State != JobSucceeded || backlog[4].Events != 3 {
+		t.Errorf("finished job backlog = %+v", backlog)
+	}
+	if _, _, _, err := m.Subscribe("nope", 0); err != errJobNotFound {
+		t.Errorf("Subscribe to a missing job: %v", err)
+	}
+}
+
+func TestHandleJobEvents(t *testing.T) {
+	s := NewServer("", t.TempDir(), "")
+	job, _, _ := s.jobs.Start("scrape-url", ScrapeRequest{}, "https://example.com", nil)
+	srv := httptest.NewServer(http.HandlerFunc(s.handleJob))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/api/jobs/"+job.ID+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	go func() {
+		report(s.jobs.Observer(job.ID), ScrapeProgress{Type: ProgressParsed, Events: 2})
+		s.jobs.Finish(job.ID, nil)
+	}()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"id: 1\nevent: job_started\n", "event: parsed\n", "id: 3\nevent: job_finished\ndata: {"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("stream missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	tail := NewLogTail()
+	fmt.Fprint(tail, "one\ntwo\nthr")
+	if got := tail.Lines(10); strings.Join(got, "|") != "one|two" {
+		t.Errorf("Lines = %v, want complete lines only", got)
+	}
+
+	last, lines, unfollow := tail.Follow(1)
+	defer unfollow()
+	fmt.Fprint(tail, "ee\nfour\n")
+	if len(last) != 1 || last[0] != "two" || <-lines != "three" || <-lines != "four" {
+		t.Errorf("Follow tail = %v", last)
+	}
+
+	for i := 0; i < maxLogLines+10; i++ {
+		fmt.Fprintf(tail, "line %d\n", i)
+	}
+	if got := tail.Lines(maxLogLines + 10); len(got) != maxLogLines || got[len(got)-1] != fmt.Sprintf("line %d", maxLogLines+9) {
+		t.Errorf("kept %d lines ending %q", len(got), got[len(got)-1])
+	}
+}
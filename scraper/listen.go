@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ServerConfig is the server section of config.yaml. Command-line flags
+// override it.
+type ServerConfig struct {
+	// host:port to listen on, ":8080" if empty.
+	Listen string `yaml:"listen"`
+	// Unix socket to listen on instead, for running behind a reverse proxy.
+	Socket string `yaml:"socket"`
+	// Origins other sites may call the API from, or "*" for any. Empty
+	// allows only the server's own origin.
+	AllowedOrigins      []string        `yaml:"allowed_origins"`
+	ReadTimeoutSeconds  int             `yaml:"read_timeout_seconds"`
+	WriteTimeoutSeconds int             `yaml:"write_timeout_seconds"`
+	IdleTimeoutSeconds  int             `yaml:"idle_timeout_seconds"`
+	RateLimit           RateLimitConfig `yaml:"rate_limit"`
+	TLS                 struct {
+		Cert string `yaml:"cert"`
+		Key  string `yaml:"key"`
+		// Serve HTTPS with a throwaway certificate for localhost.
+		SelfSigned bool `yaml:"self_signed"`
+	} `yaml:"tls"`
+}
+
+// Defaults for settings the config leaves empty. Streams and scrapes that
+// run longer than the write timeout lift it for themselves.
+const (
+	defaultListen       = ":8080"
+	defaultReadTimeout  = 30 * time.Second
+	defaultWriteTimeout = 2 * time.Minute
+	defaultIdleTimeout  = 2 * time.Minute
+)
+
+// override returns c with the fields set in flags replacing its own.
+func (c ServerConfig) override(flags ServerConfig) ServerConfig {
+	if flags.Listen != "" {
+		c.Listen, c.Socket = flags.Listen, ""
+	}
+	if flags.Socket != "" {
+		c.Socket = flags.Socket
+	}
+	if flags.AllowedOrigins != nil {
+		c.AllowedOrigins = flags.AllowedOrigins
+	}
+	if flags.TLS.Cert != "" || flags.TLS.Key != "" {
+		c.TLS.Cert, c.TLS.Key, c.TLS.SelfSigned = flags.TLS.Cert, flags.TLS.Key, false
+	}
+	if flags.TLS.SelfSigned {
+		c.TLS.SelfSigned = true
+	}
+	return c
+}
+
+// serverProblems checks the server section for ValidateConfig.
+func serverProblems(c ServerConfig, add func(format string, args ...interface{})) {
+	if c.Listen != "" {
+		if _, port, err := net.SplitHostPort(c.Listen); err != nil || port == "" {
+			add("server.listen %q must be host:port, like \":8080\" or \"127.0.0.1:8080\"", c.Listen)
+		}
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			add("server.allowed_origins: %q is not an origin like \"https://example.org\"", origin)
+		}
+	}
+	timeouts := []struct {
+		field   string
+		seconds int
+	}{
+		{"read_timeout_seconds", c.ReadTimeoutSeconds},
+		{"write_timeout_seconds", c.WriteTimeoutSeconds},
+		{"idle_timeout_seconds", c.IdleTimeoutSeconds},
+	}
+	for _, t := range timeouts {
+		if t.seconds < 0 {
+			add("server.%s must not be negative", t.field)
+		}
+	}
+	limits := []struct {
+		field string
+		n     int
+	}{
+		{"requests_per_minute", c.RateLimit.RequestsPerMinute},
+		{"burst", c.RateLimit.Burst},
+		{"scrapes_per_minute", c.RateLimit.ScrapesPerMinute},
+		{"scrape_burst", c.RateLimit.ScrapeBurst},
+		{"browser_pages", c.RateLimit.BrowserPages},
+		{"browser_queue", c.RateLimit.BrowserQueue},
+	}
+	for _, l := range limits {
+		if l.n < 0 {
+			add("server.rate_limit.%s must not be negative", l.field)
+		}
+	}
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		add("server.tls needs both cert and key")
+	}
+	if c.TLS.Cert != "" && c.TLS.SelfSigned {
+		add("server.tls: set either cert and key or self_signed, not both")
+	}
+}
+
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return def
+}
+
+// httpServer builds the http.Server for c around handler, loading or
+// making its TLS certificate if it serves HTTPS.
+func httpServer(c ServerConfig, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       secondsOr(c.ReadTimeoutSeconds, defaultReadTimeout),
+		WriteTimeout:      secondsOr(c.WriteTimeoutSeconds, defaultWriteTimeout),
+		IdleTimeout:       secondsOr(c.IdleTimeoutSeconds, defaultIdleTimeout),
+	}
+	switch {
+	case c.TLS.Cert != "":
+		cert, err := tls.LoadX509KeyPair(c.TLS.Cert, c.TLS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	case c.TLS.SelfSigned:
+		cert, err := selfSignedCert(time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("making self-signed certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	return srv, nil
+}
+
+// listen opens the socket c asks for. A stale unix socket left by an
+// earlier run is removed first.
+func listen(c ServerConfig) (net.Listener, error) {
+	if c.Socket == "" {
+		addr := c.Listen
+		if addr == "" {
+			addr = defaultListen
+		}
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Stat(c.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(c.Socket)
+	}
+	l, err := net.Listen("unix", c.Socket)
+	if err != nil {
+		return nil, err
+	}
+	// Readable and writable by the proxy if it shares our group.
+	if err := os.Chmod(c.Socket, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// serverURL is where to point a browser at the server, for the startup log.
+func serverURL(c ServerConfig, l net.Listener) string {
+	if c.Socket != "" {
+		return "unix:" + c.Socket
+	}
+	scheme := "http"
+	if c.TLS.Cert != "" || c.TLS.SelfSigned {
+		scheme = "https"
+	}
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() || ip.IsLoopback() {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+}
+
+// selfSignedCert makes a certificate for localhost valid for a year, for
+// trying HTTPS locally. Browsers will warn about it.
+func selfSignedCert(now time.Time) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Violetta dev"}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// corsOrigin returns the Access-Control-Allow-Origin to send for a request
+// from origin, or "" if it is not allowed.
+func corsOrigin(allowed []string, origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, a := range allowed {
+		a = strings.TrimSpace(a)
+		if a == "*" {
+			return "*"
+		}
+		if strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
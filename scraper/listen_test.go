@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServerConfigOverride(t *testing.T) {
+	var cfg ServerConfig
+	cfg.Socket = "/run/violetta.sock"
+	cfg.AllowedOrigins = []string{"https://example.org"}
+	cfg.TLS.SelfSigned = true
+
+	var flags ServerConfig
+	flags.Listen = "127.0.0.1:9090"
+	flags.TLS.Cert, flags.TLS.Key = "cert.pem", "key.pem"
+	got := cfg.override(flags)
+	if got.Listen != "127.0.0.1:9090" || got.Socket != "" || got.TLS.SelfSigned || got.TLS.Cert != "cert.pem" {
+		t.Errorf("override = %+v", got)
+	}
+	if len(got.AllowedOrigins) != 1 {
+		t.Errorf("origins not kept: %v", got.AllowedOrigins)
+	}
+	if got := cfg.override(ServerConfig{}); got.Socket != cfg.Socket || !got.TLS.SelfSigned {
+		t.Errorf("empty flags changed config: %+v", got)
+	}
+
+	var problems []string
+	add := func(format string, args ...interface{}) { problems = append(problems, format) }
+	bad := ServerConfig{Listen: "8080", AllowedOrigins: []string{"*", "example.org", "https://example.org/app"}, ReadTimeoutSeconds: -1}
+	bad.TLS.Cert = "cert.pem"
+	serverProblems(bad, add)
+	if len(problems) != 5 {
+		t.Errorf("problems = %q, want listen, two origins, timeout and TLS", problems)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configPath, []byte(testConfigYAML), 0644)
+	s := NewServer(configPath, dir, "")
+	var cfg Config
+	cfg.Server.AllowedOrigins = []string{"http://localhost:5173"}
+	s.applyConfig(cfg)
+	handler := s.Handler()
+
+	get := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/events", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("GET", "http://localhost:5173"); rec.Header().Get("Access-Control-Allow-Origin") != "http://localhost:5173" ||
+		rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("allowed origin headers: %v", rec.Header())
+	}
+	if rec := get("OPTIONS", "https://evil.example"); rec.Code != 204 || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("other origin: %d %v", rec.Code, rec.Header())
+	}
+
+	s.serverFlags.AllowedOrigins = []string{"*"}
+	s.applyConfig(cfg)
+	if rec := get("GET", "https://evil.example"); rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("wildcard from flag: %v", rec.Header())
+	}
+}
+
+func TestServeTLSAndSocket(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+
+	var sc ServerConfig
+	sc.Listen = "127.0.0.1:0"
+	sc.TLS.SelfSigned = true
+	srv, err := httpServer(sc, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := listen(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(l, "", "")
+	defer srv.Close()
+	if u := serverURL(sc, l); !strings.HasPrefix(u, "https://localhost:") {
+		t.Errorf("serverURL = %s", u)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + l.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || resp.TLS.PeerCertificates[0].Subject.CommonName != "localhost" {
+		t.Errorf("not served with the self-signed certificate")
+	}
+
+	// Unix socket paths are limited to about 100 bytes, so keep it short.
+	dir, err := os.MkdirTemp("", "vs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := ServerConfig{Socket: filepath.Join(dir, "s.sock")}
+	os.WriteFile(sock.Socket, nil, 0600) // not a socket, so kept and in the way
+	if _, err := listen(sock); err == nil {
+		t.Error("listened over a regular file")
+	}
+	os.Remove(sock.Socket)
+	ul, err := listen(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := httpServer(sock, handler)
+	go plain.Serve(ul)
+	defer plain.Close()
+	client = &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", sock.Socket)
+	}}}
+	resp, err = client.Get("http://violetta/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("over socket: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	// maxLogLines is how many recent log lines LogTail keeps.
+	maxLogLines     = 1000
+	defaultLogLines = 200
+)
+
+// LogTail is an io.Writer for the standard logger that keeps the most
+// recent lines in memory and passes new ones to followers.
+type LogTail struct {
+	mu      sync.Mutex
+	lines   []string
+	partial string
+	subs    map[chan string]bool
+}
+
+func NewLogTail() *LogTail {
+	return &LogTail{subs: make(map[chan string]bool)}
+}
+
+func (t *LogTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	text := t.partial + string(p)
+	lines := strings.Split(text, "\n")
+	t.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		t.lines = append(t.lines, line)
+		for ch := range t.subs {
+			select {
+			case ch <- line:
+			default:
+				// A follower that cannot keep up is dropped rather than
+				// holding up logging.
+				delete(t.subs, ch)
+				close(ch)
+			}
+		}
+	}
+	if over := len(t.lines) - maxLogLines; over > 0 {
+		t.lines = append([]string(nil), t.lines[over:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns up to the last n complete lines.
+func (t *LogTail) Lines(n int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n > len(t.lines) {
+		n = len(t.lines)
+	}
+	return append([]string{}, t.lines[len(t.lines)-n:]...)
+}
+
+// Follow returns the last n lines and a channel of the lines logged after
+// them. The channel is closed by unfollow or if the follower falls behind.
+func (t *LogTail) Follow(n int) (tail []string, lines <-chan string, unfollow func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n > len(t.lines) {
+		n = len(t.lines)
+	}
+	tail = append([]string{}, t.lines[len(t.lines)-n:]...)
+
+	ch := make(chan string, subscriberBuffer)
+	t.subs[ch] = true
+	return tail, ch, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.subs[ch] {
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+}
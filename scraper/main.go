@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -9,6 +11,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,14 +19,6 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// CustomSource tracks a user-provided URL that was scraped
-type CustomSource struct {
-	URL        string `json:"url"`
-	Label      string `json:"label"`
-	ScrapedAt  string `json:"scraped_at"`
-	EventCount int    `json:"event_count"`
-}
-
 type Config struct {
 	Scraping struct {
 		Navigation struct {
@@ -41,27 +36,41 @@ type Config struct {
 			TTLHours int `yaml:"ttl_hours"`
 		} `yaml:"cache"`
 		RobotsRespect bool `yaml:"robots_respect"`
+		GenericParser struct {
+			MinConfidence float64 `yaml:"min_confidence"`
+		} `yaml:"generic_parser"`
+		URLPolicy struct {
+			AllowHosts []string `yaml:"allow_hosts"`
+			DenyHosts  []string `yaml:"deny_hosts"`
+		} `yaml:"url_policy"`
 	} `yaml:"scraping"`
 	RegionalVenues struct {
 		Enabled bool           `yaml:"enabled"`
 		Regions []RegionConfig `yaml:"regions"`
 	} `yaml:"regional_venues"`
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Server    ServerConfig    `yaml:"server"`
 }
 
 type RegionConfig struct {
-	Name   string        `yaml:"name"`
-	Code   string        `yaml:"code"`
-	Venues []VenueConfig `yaml:"venues"`
+	Name   string        `yaml:"name" json:"name"`
+	Code   string        `yaml:"code" json:"code"`
+	Venues []VenueConfig `yaml:"venues" json:"venues"`
+	// Cron expression for scheduled scrapes of the whole region, if any.
+	Schedule string `yaml:"schedule,omitempty" json:"schedule,omitempty"`
 }
 
 type VenueConfig struct {
-	Name         string `yaml:"name"`
-	Code         string `yaml:"code"`
-	OfficialURL  string `yaml:"official_url"`
-	CalendarURL  string `yaml:"calendar_url"`
-	OperabaseURL string `yaml:"operabase_url"`
-	City         string `yaml:"city"`
-	State        string `yaml:"state"`
+	Name         string `yaml:"name" json:"name"`
+	Code         string `yaml:"code" json:"code"`
+	OfficialURL  string `yaml:"official_url,omitempty" json:"official_url,omitempty"`
+	CalendarURL  string `yaml:"calendar_url,omitempty" json:"calendar_url,omitempty"`
+	OperabaseURL string `yaml:"operabase_url,omitempty" json:"operabase_url,omitempty"`
+	City         string `yaml:"city,omitempty" json:"city,omitempty"`
+	State        string `yaml:"state,omitempty" json:"state,omitempty"`
+	// Cron expression for scheduled scrapes of just this venue, if any.
+	Schedule string `yaml:"schedule,omitempty" json:"schedule,omitempty"`
 }
 
 type PerformanceEvent struct {
@@ -76,6 +85,31 @@ type PerformanceEvent struct {
 	State     string   `json:"state"`
 	SourceURL string   `json:"source_url"`
 	ScrapedAt string   `json:"scraped_at"`
+
+	// Custom source the event was scraped from, for events with no venue.
+	SourceID string `json:"source_id,omitempty"`
+
+	// Set only for events produced by the generic parser. Strategy is the
+	// highest-precedence strategy; Strategies lists all that contributed.
+	Strategy          string   `json:"strategy,omitempty"`
+	Strategies        []string `json:"strategies,omitempty"`
+	Confidence        float64  `json:"confidence,omitempty"`
+	ConfidenceReasons []string `json:"confidence_reasons,omitempty"`
+
+	// Best match among the graph's operas, if any scored high enough.
+	MatchedOperaKey string  `json:"matched_opera_key,omitempty"`
+	MatchConfidence float64 `json:"match_confidence,omitempty"`
+
+	// Composer as reported by each source ("json-ld", "text", "graph");
+	// ComposerConflict is set when they name different composers.
+	ComposerSources  map[string]string `json:"composer_sources,omitempty"`
+	ComposerConflict bool              `json:"composer_conflict,omitempty"`
+
+	// When this event was first scraped, carried over from earlier runs.
+	FirstSeenAt string `json:"first_seen_at,omitempty"`
+
+	// Performers named in JSON-LD, in page order.
+	Cast []string `json:"cast,omitempty"`
 }
 
 // DomainLimiter enforces per-domain rate limiting
@@ -118,6 +152,13 @@ func (dl *DomainLimiter) Wait(domain string) error {
 	return nil
 }
 
+// Strikes returns the current strike count for a domain.
+func (dl *DomainLimiter) Strikes(domain string) int {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return dl.strikes[domain]
+}
+
 func (dl *DomainLimiter) Strike(domain string) {
 	dl.mu.Lock()
 	defer dl.mu.Unlock()
@@ -125,42 +166,181 @@ func (dl *DomainLimiter) Strike(domain string) {
 	log.Printf("[%s] Strike %d/%d", domain, dl.strikes[domain], dl.maxStrikes)
 }
 
+func defaultDataDir() string {
+	return filepath.Join(os.Getenv("HOME"), "Violetta-Opera-Graph-Relationship-Maps")
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := RunExport(os.Args[2:]); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		// Reads the password from stdin so it stays out of shell history.
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		if password == "" {
+			log.Fatalf("No password given")
+		}
+		hash, err := HashPassword(password)
+		if err != nil {
+			log.Fatalf("Hashing failed: %v", err)
+		}
+		fmt.Println(hash)
+		return
+	}
+
 	configPath := flag.String("config", "config.yaml", "Path to config.yaml")
-	dataDir := flag.String("data-dir", filepath.Join(os.Getenv("HOME"), "Violetta-Opera-Graph-Relationship-Maps"), "Data directory")
+	dataDir := flag.String("data-dir", defaultDataDir(), "Data directory")
 	region := flag.String("region", "", "Region code to scrape (socal, norcal, nm, atl)")
 	serverMode := flag.Bool("server", false, "Start Admin API server")
 	staticDir := flag.String("static", "", "Path to static files directory for SPA serving")
 	dumpHTML := flag.Bool("dump-html", false, "Dump rendered HTML to disk for debugging")
+	snapshotName := flag.String("snapshot-fixture", "", "Copy a cached page into the parser fixture corpus under this name")
+	snapshotURL := flag.String("url", "", "Page URL for --snapshot-fixture")
+	snapshotParser := flag.String("parser", "generic", "Parser for --snapshot-fixture (venue code or \"generic\")")
+	fixturesDir := flag.String("fixtures-dir", filepath.Join("testdata", "parsers"), "Parser fixture directory for --snapshot-fixture")
+	exportICS := flag.String("export-ics", "", "Write stored events as iCalendar to this file (\"-\" for stdout) and exit")
+	venueFilter := flag.String("venue", "", "Venue codes to export, comma-separated")
+	composerFilter := flag.String("composer", "", "Composers to export, comma-separated")
+	operaFilter := flag.String("opera", "", "Matched graph opera keys to export, comma-separated")
+	listenAddr := flag.String("listen", "", "Address for --server to listen on, like :8080 (overrides server.listen)")
+	socketPath := flag.String("socket", "", "Unix socket for --server to listen on instead of a port")
+	origins := flag.String("allowed-origins", "", "Origins allowed to call the API, comma-separated, or * (overrides server.allowed_origins)")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file for --server")
+	tlsKey := flag.String("tls-key", "", "TLS key file for --server")
+	selfSigned := flag.Bool("tls-self-signed", false, "Serve HTTPS with a self-signed certificate for local testing")
 	flag.Parse()
 
 	// Ensure absolute path for config
 	absConfigPath, _ := filepath.Abs(*configPath)
 
+	if *snapshotName != "" {
+		cache := NewHTMLCache(filepath.Join(*dataDir, "data", "raw", "html"), 0)
+		path, err := SnapshotFixture(cache, *snapshotURL, *snapshotParser, *snapshotName, *fixturesDir)
+		if err != nil {
+			log.Fatalf("Snapshot failed: %v", err)
+		}
+		log.Printf("Wrote %s; run `go test -run TestParserGolden -update` to record its expected output", path)
+		return
+	}
+
+	if *exportICS != "" {
+		filter := ParseEventFilter(url.Values{
+			"region":   {*region},
+			"venue":    {*venueFilter},
+			"composer": {*composerFilter},
+			"opera":    {*operaFilter},
+		})
+		if err := ExportEvents(*exportICS, "ics", *dataDir, filter); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		return
+	}
+
 	if *serverMode {
+		var flags ServerConfig
+		flags.Listen, flags.Socket = *listenAddr, *socketPath
+		if *origins != "" {
+			flags.AllowedOrigins = strings.Split(*origins, ",")
+		}
+		flags.TLS.Cert, flags.TLS.Key, flags.TLS.SelfSigned = *tlsCert, *tlsKey, *selfSigned
 		srv := NewServer(absConfigPath, *dataDir, *staticDir)
-		go srv.Start(8080)
+		go srv.Start(flags)
 		select {}
 	}
 
 	RunScrape(*configPath, *dataDir, *region, *dumpHTML)
 }
 
-func RunScrape(configPath, dataDir, region string, dumpHTML bool) error {
+func LoadConfig(configPath string) (Config, error) {
+	var cfg Config
 	cfgData, err := os.ReadFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to read config: %v", err)
+		return cfg, fmt.Errorf("failed to read config: %v", err)
 	}
-
-	var cfg Config
 	if err := yaml.Unmarshal(cfgData, &cfg); err != nil {
-		return fmt.Errorf("failed to parse config: %v", err)
+		return cfg, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return cfg, nil
+}
+
+// ScrapeRequest selects the regions and venues a scrape covers. Empty
+// lists select every configured region and venue.
+type ScrapeRequest struct {
+	Regions []string `json:"regions"`
+	Venues  []string `json:"venues"`
+	// Schedule names the scheduler entry that started the scrape, if any,
+	// and Source the custom source it is for.
+	Schedule string `json:"-"`
+	Source   string `json:"-"`
+}
+
+type scrapeTarget struct {
+	Region RegionConfig
+	Venue  VenueConfig
+}
+
+// scrapeTargets returns the venues req selects from cfg, in config order,
+// or an error naming any region or venue code that is not configured.
+func scrapeTargets(cfg Config, req ScrapeRequest) ([]scrapeTarget, error) {
+	knownRegions := make(map[string]bool)
+	knownVenues := make(map[string]bool)
+	var targets []scrapeTarget
+	for _, regionCfg := range cfg.RegionalVenues.Regions {
+		knownRegions[strings.ToLower(regionCfg.Code)] = true
+		for _, venue := range regionCfg.Venues {
+			knownVenues[strings.ToLower(venue.Code)] = true
+			if len(req.Regions) > 0 && !containsFold(req.Regions, regionCfg.Code) {
+				continue
+			}
+			if len(req.Venues) > 0 && !containsFold(req.Venues, venue.Code) {
+				continue
+			}
+			targets = append(targets, scrapeTarget{Region: regionCfg, Venue: venue})
+		}
+	}
+	for _, code := range req.Regions {
+		if !knownRegions[strings.ToLower(code)] {
+			return nil, fmt.Errorf("unknown region %q", code)
+		}
+	}
+	for _, code := range req.Venues {
+		if !knownVenues[strings.ToLower(code)] {
+			return nil, fmt.Errorf("unknown venue %q", code)
+		}
+	}
+	return targets, nil
+}
+
+func RunScrape(configPath, dataDir, region string, dumpHTML bool) error {
+	var req ScrapeRequest
+	if region != "" {
+		req.Regions = []string{region}
+	}
+	return RunScrapeContext(context.Background(), configPath, dataDir, req, dumpHTML, nil)
+}
+
+// RunScrapeContext scrapes the venues selected by req, reporting each step
+// to observer if it is not nil. Cancelling ctx stops the scrape after the
+// venue in progress.
+func RunScrapeContext(ctx context.Context, configPath, dataDir string, req ScrapeRequest, dumpHTML bool, observer ScrapeObserver) error {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
 	}
 
 	if !cfg.RegionalVenues.Enabled {
 		log.Println("Regional venue scraping is disabled in config")
 		return nil
 	}
+	targets, err := scrapeTargets(cfg, req)
+	if err != nil {
+		return err
+	}
 
 	if cfg.Scraping.RobotsRespect {
 		log.Println("robots.txt respect: ENABLED")
@@ -176,6 +356,12 @@ func RunScrape(configPath, dataDir, region string, dumpHTML bool) error {
 	cache := NewHTMLCache(cacheDir, cfg.Scraping.Cache.TTLHours)
 
 	robots := NewRobotsGuard(cfg.Scraping.RobotsRespect)
+	guard := NewURLGuard(cfg)
+
+	graph := LoadGraphIndex(dataDir)
+	scorer := NewConfidenceScorer(graph.Matcher, cfg.Scraping.GenericParser.MinConfidence)
+	health := NewHealthStore(dataDir)
+	firstSeen := NewFirstSeenStore(dataDir)
 
 	browser, err := NewBrowserManager()
 	if err != nil {
@@ -187,25 +373,49 @@ func RunScrape(configPath, dataDir, region string, dumpHTML bool) error {
 	}
 	defer browser.Stop()
 
-	for _, regionCfg := range cfg.RegionalVenues.Regions {
-		if region != "" && regionCfg.Code != region {
-			continue
+	for i, target := range targets {
+		if err := ctx.Err(); err != nil {
+			log.Printf("Scrape cancelled with %d of %d venues done", i, len(targets))
+			return err
 		}
+		regionCfg, venue := target.Region, target.Venue
+		if i == 0 || targets[i-1].Region.Code != regionCfg.Code {
+			log.Printf("Scraping region: %s (%s)", regionCfg.Name, regionCfg.Code)
+		}
+		report(observer, ScrapeProgress{Type: ProgressVenueStarted, Region: regionCfg.Code, Venue: venue.Code})
 
-		log.Printf("Scraping region: %s (%s)", regionCfg.Name, regionCfg.Code)
-
-		for _, venue := range regionCfg.Venues {
-			events, err := scrapeVenue(venue, regionCfg.Code, limiter, cache, robots, browser, dumpHTML, dataDir)
+		run := func() VenueRun {
+			run := newVenueRun()
+			events, err := scrapeVenue(venue, regionCfg.Code, limiter, cache, robots, browser, guard, dumpHTML, dataDir, &run, observer)
+			run.Strikes = limiter.Strikes(venue.Code)
 			if err != nil {
 				log.Printf("[%s] Error: %v", venue.Code, err)
-				continue
+				run.Error = err.Error()
+				health.Record(regionCfg.Code, venue.Code, run)
+				return run
 			}
 
+			scorer.ScoreAll(events)
+			events, rejected := scorer.Split(events)
+			if len(rejected) > 0 {
+				log.Printf("[%s] Dropped %d events below confidence %.2f", venue.Code, len(rejected), scorer.Threshold)
+			}
+
+			annotateMatches(events, graph.Matcher)
+			graph.Composers.ResolveComposers(events)
+
+			run.Events = len(events)
+			run.Rejected = len(rejected)
+			run.Strategy = runStrategy(run.Parser, events)
+			health.Record(regionCfg.Code, venue.Code, run)
+
 			if len(events) == 0 {
 				log.Printf("[%s] No events found", venue.Code)
-				continue
+				return run
 			}
 
+			firstSeen.Stamp(events)
+
 			outDir := filepath.Join(dataDir, "data", "raw", "regional", regionCfg.Code)
 			os.MkdirAll(outDir, 0755)
 
@@ -213,19 +423,38 @@ func RunScrape(configPath, dataDir, region string, dumpHTML bool) error {
 			data, _ := json.MarshalIndent(events, "", "  ")
 			if err := os.WriteFile(outFile, data, 0644); err != nil {
 				log.Printf("[%s] Failed to write: %v", venue.Code, err)
+				run.Error = fmt.Sprintf("writing events: %v", err)
 			} else {
 				log.Printf("[%s] Saved %d events to %s", venue.Code, len(events), outFile)
 			}
-		}
+			return run
+		}()
+
+		report(observer, ScrapeProgress{
+			Type:     ProgressVenueFinished,
+			Region:   regionCfg.Code,
+			Venue:    venue.Code,
+			Events:   run.Events,
+			Rejected: run.Rejected,
+			Strikes:  run.Strikes,
+			Error:    run.Error,
+		})
 	}
 	return nil
 }
 
-func scrapeVenue(venue VenueConfig, regionCode string, limiter *DomainLimiter, cache *HTMLCache, robots *RobotsGuard, browser *BrowserManager, dumpHTML bool, dataDir string) ([]PerformanceEvent, error) {
+// scrapeVenue fetches and parses one venue, filling in run's fetch and parse
+// details for health tracking and reporting each step to observer. Every
+// request the page makes goes through guard, as in ScrapeURL.
+func scrapeVenue(venue VenueConfig, regionCode string, limiter *DomainLimiter, cache *HTMLCache, robots *RobotsGuard, browser *BrowserManager, guard *URLGuard, dumpHTML bool, dataDir string, run *VenueRun, observer ScrapeObserver) ([]PerformanceEvent, error) {
 	targetURL := venue.CalendarURL
 	if targetURL == "" {
 		targetURL = venue.OfficialURL
 	}
+	run.Parser = parserName(venue.Code)
+	if err := guard.Check(context.Background(), targetURL); err != nil {
+		return nil, err
+	}
 
 	userAgent := "ViolettaOperaGraph/1.0 (research project)"
 
@@ -233,31 +462,51 @@ func scrapeVenue(venue VenueConfig, regionCode string, limiter *DomainLimiter, c
 		return nil, err
 	}
 
+	step := func(p ScrapeProgress) {
+		p.Region, p.Venue = regionCode, venue.Code
+		report(observer, p)
+	}
+	strike := func(err error) error {
+		limiter.Strike(venue.Code)
+		step(ScrapeProgress{Type: ProgressStrike, Strikes: limiter.Strikes(venue.Code), Error: err.Error()})
+		return err
+	}
+
 	if !robots.IsAllowed(userAgent, targetURL) {
+		step(ScrapeProgress{Type: ProgressRobots, URL: targetURL, Robots: "blocked"})
 		return nil, fmt.Errorf("blocked by robots.txt")
 	}
+	step(ScrapeProgress{Type: ProgressRobots, URL: targetURL, Robots: "allowed"})
 
 	var content []byte
 	var hit bool
 
 	if content, hit = cache.Get(targetURL); hit {
 		log.Printf("[%s] Cache hit for %s", venue.Code, targetURL)
+		run.CacheHit = true
+		step(ScrapeProgress{Type: ProgressCache, URL: targetURL, Cache: "hit"})
 	} else {
+		step(ScrapeProgress{Type: ProgressCache, URL: targetURL, Cache: "miss"})
 		log.Printf("[%s] Fetching %s via Playwright...", venue.Code, targetURL)
+		fetchStart := time.Now()
 
 		page, err := browser.NewPage(userAgent)
 		if err != nil {
-			limiter.Strike(venue.Code)
-			return nil, fmt.Errorf("creating page: %w", err)
+			return nil, strike(fmt.Errorf("creating page: %w", err))
 		}
 		defer page.Close()
+		if err := guard.Route(page); err != nil {
+			return nil, fmt.Errorf("routing page: %w", err)
+		}
 
 		if _, err := page.Goto(targetURL, playwright.PageGotoOptions{
 			Timeout:   playwright.Float(30000),
 			WaitUntil: playwright.WaitUntilStateDomcontentloaded,
 		}); err != nil {
-			limiter.Strike(venue.Code)
-			return nil, fmt.Errorf("navigating: %w", err)
+			return nil, strike(fmt.Errorf("navigating: %w", err))
+		}
+		if err := guard.Check(context.Background(), page.URL()); err != nil {
+			return nil, err
 		}
 
 		// Wait for network idle to ensure JS rendered
@@ -273,6 +522,8 @@ func scrapeVenue(venue VenueConfig, regionCode string, limiter *DomainLimiter, c
 			return nil, fmt.Errorf("getting content: %w", err)
 		}
 		content = []byte(html)
+		run.FetchMs = time.Since(fetchStart).Milliseconds()
+		step(ScrapeProgress{Type: ProgressFetched, URL: targetURL, FetchMs: run.FetchMs})
 
 		if err := cache.Put(targetURL, content); err != nil {
 			log.Printf("Failed to cache %s: %v", targetURL, err)
@@ -294,22 +545,27 @@ func scrapeVenue(venue VenueConfig, regionCode string, limiter *DomainLimiter, c
 		return []PerformanceEvent{}, nil
 	}
 
+	run.MissingMarkup = missingMarkup(venue.Code, content)
+
 	events, err := parser(content)
 	if err != nil {
 		return nil, fmt.Errorf("parsing: %w", err)
 	}
 
 	log.Printf("[%s] Parsed %d events", venue.Code, len(events))
+	step(ScrapeProgress{Type: ProgressParsed, Events: len(events)})
 	return events, nil
 }
 
 // ScrapeURL fetches a URL via Playwright and parses it using the generic parser.
-func ScrapeURL(targetURL string, browser *BrowserManager) ([]PerformanceEvent, string, error) {
+// Every request the page makes goes through guard. Every returned event
+// carries a confidence score from scorer and a composer resolved against
+// composers.
+func ScrapeURL(targetURL string, browser *BrowserManager, guard *URLGuard, scorer *ConfidenceScorer, composers *ComposerIndex) ([]PerformanceEvent, string, error) {
 	userAgent := "ViolettaOperaGraph/1.0 (research project)"
 
-	u, err := url.Parse(targetURL)
-	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
-		return nil, "", fmt.Errorf("invalid URL: %s", targetURL)
+	if err := guard.Check(context.Background(), targetURL); err != nil {
+		return nil, "", err
 	}
 
 	log.Printf("[scrape-url] Fetching %s via Playwright...", targetURL)
@@ -319,6 +575,9 @@ func ScrapeURL(targetURL string, browser *BrowserManager) ([]PerformanceEvent, s
 		return nil, "", fmt.Errorf("creating page: %w", err)
 	}
 	defer page.Close()
+	if err := guard.Route(page); err != nil {
+		return nil, "", fmt.Errorf("routing page: %w", err)
+	}
 
 	if _, err := page.Goto(targetURL, playwright.PageGotoOptions{
 		Timeout:   playwright.Float(30000),
@@ -326,6 +585,10 @@ func ScrapeURL(targetURL string, browser *BrowserManager) ([]PerformanceEvent, s
 	}); err != nil {
 		return nil, "", fmt.Errorf("navigating to %s: %w", targetURL, err)
 	}
+	// Redirects were checked hop by hop; make sure of where we ended up.
+	if err := guard.Check(context.Background(), page.URL()); err != nil {
+		return nil, "", err
+	}
 
 	page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
 		State: playwright.LoadStateNetworkidle,
@@ -339,6 +602,9 @@ func ScrapeURL(targetURL string, browser *BrowserManager) ([]PerformanceEvent, s
 	}
 
 	events, strategy := ParseGenericEvents([]byte(html), targetURL)
+	scorer.ScoreAll(events)
+	annotateMatches(events, scorer.Matcher)
+	composers.ResolveComposers(events)
 	log.Printf("[scrape-url] Parsed %d events from %s using strategy: %s", len(events), targetURL, strategy)
 
 	return events, strategy, nil
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// minTitleMatchScore is the lowest score TitleMatcher reports as a match.
+	minTitleMatchScore = 0.6
+	// maxMatchTitleRunes caps the title length TitleMatcher compares; longer
+	// strings are page text rather than titles.
+	maxMatchTitleRunes = 200
+	// minGramOverlap is the share of the shorter title's trigrams an entry
+	// must have in common with the query to be scored at all.
+	minGramOverlap = 0.3
+	// maxScoredCandidates bounds how many index candidates get a full
+	// similarity score per query variant.
+	maxScoredCandidates = 64
+)
+
+// OperaTitle is one known opera with the alternative titles it is staged
+// under (translations, short forms).
+type OperaTitle struct {
+	Key     string
+	Title   string
+	Aliases []string
+}
+
+// TitleMatch is one candidate returned by TitleMatcher.Match.
+type TitleMatch struct {
+	Key   string  `json:"key,omitempty"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+	// Via is the alias that matched, if not the canonical title.
+	Via string `json:"via,omitempty"`
+}
+
+// builtinTitleGroups lists original and translated titles of frequently
+// staged operas. An opera whose title matches any entry in a group gets the
+// rest of the group as aliases, on top of any aliases from graph.json.
+var builtinTitleGroups = [][]string{
+	{"Die Zauberflöte", "The Magic Flute", "La flûte enchantée", "Il flauto magico"},
+	{"Le nozze di Figaro", "The Marriage of Figaro", "Les noces de Figaro", "Die Hochzeit des Figaro"},
+	{"Così fan tutte", "Women Are Like That"},
+	{"Die Entführung aus dem Serail", "The Abduction from the Seraglio"},
+	{"Il barbiere di Siviglia", "The Barber of Seville"},
+	{"Un ballo in maschera", "A Masked Ball"},
+	{"La forza del destino", "The Force of Destiny"},
+	{"Il trovatore", "The Troubadour"},
+	{"Der Freischütz", "The Marksman"},
+	{"Der fliegende Holländer", "The Flying Dutchman"},
+	{"Das Rheingold", "The Rhinegold"},
+	{"Die Walküre", "The Valkyrie"},
+	{"Götterdämmerung", "Twilight of the Gods"},
+	{"Die Meistersinger von Nürnberg", "The Mastersingers of Nuremberg"},
+	{"Der Rosenkavalier", "The Knight of the Rose"},
+	{"Die Frau ohne Schatten", "The Woman Without a Shadow"},
+	{"Madama Butterfly", "Madame Butterfly"},
+	{"La fanciulla del West", "The Girl of the Golden West"},
+	{"Les pêcheurs de perles", "The Pearl Fishers"},
+	{"Les contes d'Hoffmann", "The Tales of Hoffmann"},
+	{"Příhody lišky Bystroušky", "The Cunning Little Vixen"},
+	{"Rusalka", "Русалка"},
+	{"Eugene Onegin", "Евгений Онегин", "Yevgeny Onegin", "Eugen Onegin"},
+	{"The Queen of Spades", "Pikovaya dama", "Пиковая дама"},
+	{"Boris Godunov", "Борис Годунов"},
+	{"Orfeo ed Euridice", "Orpheus and Eurydice", "Orphée et Eurydice"},
+	{"L'elisir d'amore", "The Elixir of Love"},
+}
+
+// builtinTitleAliases indexes builtinTitleGroups by normalised title.
+var builtinTitleAliases = func() map[string][]string {
+	index := make(map[string][]string)
+	for _, group := range builtinTitleGroups {
+		for _, title := range group {
+			n := normalizeTitle(title)
+			index[n] = append(index[n], group...)
+		}
+	}
+	return index
+}()
+
+// leadingArticles are stripped from the front of normalised titles so that
+// "La Traviata" and "Traviata" compare equal.
+var leadingArticles = map[string]bool{
+	// English
+	"the": true, "a": true, "an": true,
+	// Italian
+	"il": true, "lo": true, "la": true, "i": true, "gli": true, "le": true, "l": true, "un": true, "una": true, "uno": true,
+	// French
+	"les": true, "une": true,
+	// German
+	"der": true, "die": true, "das": true, "ein": true, "eine": true,
+	// Spanish / Portuguese
+	"el": true, "los": true, "las": true, "o": true, "os": true, "as": true,
+}
+
+// subtitleSeparators split a production title from its marketing subtitle,
+// as in "Carmen – a new production" or "Tosca: Puccini's thriller".
+var subtitleSeparators = []string{" – ", " — ", " - ", ": ", " | ", " (", " / "}
+
+var foldDiacritics = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// ligatures that NFD does not decompose.
+var titleLigatures = strings.NewReplacer("ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "&", " and ")
+
+// normalizeTitle lowercases a title, folds diacritics and ligatures, turns
+// punctuation into spaces and drops one leading article.
+func normalizeTitle(s string) string {
+	s = strings.ToLower(s)
+	if folded, _, err := transform.String(foldDiacritics, s); err == nil {
+		s = folded
+	}
+	s = titleLigatures.Replace(s)
+
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && leadingArticles[words[0]] {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// titleVariants returns the normalised title and, if it carries a
+// production subtitle, the normalised main title on its own.
+func titleVariants(title string) []string {
+	variants := []string{normalizeTitle(title)}
+	main := title
+	for _, sep := range subtitleSeparators {
+		if i := strings.Index(main, sep); i > 0 {
+			main = main[:i]
+		}
+	}
+	if main != title {
+		if v := normalizeTitle(main); v != "" && v != variants[0] {
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
+
+type titleEntry struct {
+	opera int
+	alias string // empty for the canonical title
+	norm  string
+	runes []rune
+	grams int // distinct trigrams in norm
+}
+
+// TitleMatcher matches scraped titles against known operas, tolerant of
+// accents, articles, production subtitles and translated titles. Titles are
+// indexed by trigram when the matcher is built, so a query only scores the
+// entries it shares enough trigrams with instead of every known title.
+type TitleMatcher struct {
+	operas  []OperaTitle
+	entries []titleEntry
+	grams   map[string][]int32 // trigram -> indices into entries
+}
+
+func NewTitleMatcher(operas []OperaTitle) *TitleMatcher {
+	m := &TitleMatcher{operas: operas, grams: make(map[string][]int32)}
+	for i, op := range operas {
+		canon := normalizeTitle(op.Title)
+		if canon == "" {
+			continue
+		}
+		m.add(i, "", canon)
+
+		seen := map[string]bool{canon: true}
+		aliases := append(append([]string{}, op.Aliases...), builtinTitleAliases[canon]...)
+		for _, alias := range aliases {
+			n := normalizeTitle(alias)
+			if n == "" || seen[n] {
+				continue
+			}
+			seen[n] = true
+			m.add(i, alias, n)
+		}
+	}
+	return m
+}
+
+func (m *TitleMatcher) add(opera int, alias, norm string) {
+	idx := int32(len(m.entries))
+	grams := trigrams(norm)
+	for _, g := range grams {
+		m.grams[g] = append(m.grams[g], idx)
+	}
+	m.entries = append(m.entries, titleEntry{
+		opera: opera,
+		alias: alias,
+		norm:  norm,
+		runes: []rune(norm),
+		grams: len(grams),
+	})
+}
+
+// trigrams returns the distinct trigrams of a normalised title, padded so
+// that short titles and word boundaries still produce grams.
+func trigrams(norm string) []string {
+	r := []rune("  " + norm + " ")
+	seen := make(map[string]bool, len(r))
+	var grams []string
+	for i := 0; i+3 <= len(r); i++ {
+		g := string(r[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			grams = append(grams, g)
+		}
+	}
+	return grams
+}
+
+// newTitleMatcherFromTitles builds a matcher over bare titles, using each
+// title as its own key.
+func newTitleMatcherFromTitles(titles []string) *TitleMatcher {
+	operas := make([]OperaTitle, len(titles))
+	for i, t := range titles {
+		operas[i] = OperaTitle{Title: t}
+	}
+	return NewTitleMatcher(operas)
+}
+
+// Len returns the number of known operas.
+func (m *TitleMatcher) Len() int {
+	return len(m.operas)
+}
+
+// Match returns up to n candidate operas scoring at least
+// minTitleMatchScore, best first.
+func (m *TitleMatcher) Match(title string, n int) []TitleMatch {
+	if utf8.RuneCountInString(title) > maxMatchTitleRunes {
+		return nil
+	}
+	variants := titleVariants(title)
+	if variants[0] == "" {
+		return nil
+	}
+
+	best := make(map[int]TitleMatch)
+	for _, v := range variants {
+		vr := []rune(v)
+		for _, ei := range m.candidates(v) {
+			e := m.entries[ei]
+			score := titleSimilarity(vr, e.runes)
+			if score < minTitleMatchScore {
+				continue
+			}
+			if cur, ok := best[e.opera]; ok && cur.Score >= score {
+				continue
+			}
+			op := m.operas[e.opera]
+			best[e.opera] = TitleMatch{Key: op.Key, Title: op.Title, Score: score, Via: e.alias}
+		}
+	}
+
+	matches := make([]TitleMatch, 0, len(best))
+	for _, tm := range best {
+		matches = append(matches, tm)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Title < matches[j].Title
+	})
+	if n > 0 && len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches
+}
+
+// candidates returns the entries sharing at least minGramOverlap of the
+// shorter title's trigrams with norm, most overlapping first, capped at
+// maxScoredCandidates.
+func (m *TitleMatcher) candidates(norm string) []int32 {
+	grams := trigrams(norm)
+	shared := make(map[int32]int)
+	for _, g := range grams {
+		for _, ei := range m.grams[g] {
+			shared[ei]++
+		}
+	}
+
+	type candidate struct {
+		entry   int32
+		overlap float64
+	}
+	cands := make([]candidate, 0, len(shared))
+	for ei, count := range shared {
+		overlap := float64(count) / float64(minInt(len(grams), m.entries[ei].grams))
+		if overlap >= minGramOverlap {
+			cands = append(cands, candidate{ei, overlap})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].overlap != cands[j].overlap {
+			return cands[i].overlap > cands[j].overlap
+		}
+		return cands[i].entry < cands[j].entry
+	})
+	if len(cands) > maxScoredCandidates {
+		cands = cands[:maxScoredCandidates]
+	}
+
+	out := make([]int32, len(cands))
+	for i, c := range cands {
+		out[i] = c.entry
+	}
+	return out
+}
+
+// Best returns the top candidate, if any.
+func (m *TitleMatcher) Best(title string) (TitleMatch, bool) {
+	matches := m.Match(title, 1)
+	if len(matches) == 0 {
+		return TitleMatch{}, false
+	}
+	return matches[0], true
+}
+
+// titleSimilarity scores two normalised titles in [0, 1]. Word containment
+// ("rigoletto" in "verdi rigoletto") scores by the share of words matched;
+// everything else falls back to Levenshtein similarity.
+func titleSimilarity(a, b []rune) float64 {
+	if string(a) == string(b) {
+		return 1
+	}
+
+	score := 0.0
+	wa, wb := strings.Fields(string(a)), strings.Fields(string(b))
+	if len(wa) > len(wb) {
+		wa, wb = wb, wa
+	}
+	if containsWords(wb, wa) {
+		score = 0.7 + 0.3*float64(len(wa))/float64(len(wb))
+	}
+
+	// Skip the edit distance when the length difference alone rules out
+	// beating the current score.
+	maxLen := maxInt(len(a), len(b))
+	if maxLen == 0 {
+		return score
+	}
+	lengthBound := 1 - float64(absInt(len(a)-len(b)))/float64(maxLen)
+	if lengthBound > score {
+		score = max(score, 1-float64(levenshtein(a, b))/float64(maxLen))
+	}
+	return score
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// containsWords reports whether needle appears as a contiguous word sequence
+// in haystack.
+func containsWords(haystack, needle []string) bool {
+	if len(needle) == 0 {
+		return false
+	}
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j, w := range needle {
+			if haystack[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// annotateMatches records the best known-opera match on each event.
+func annotateMatches(events []PerformanceEvent, m *TitleMatcher) {
+	if m == nil {
+		return
+	}
+	for i := range events {
+		if tm, ok := m.Best(events[i].Title); ok {
+			events[i].MatchedOperaKey = tm.Key
+			events[i].MatchConfidence = tm.Score
+		}
+	}
+}
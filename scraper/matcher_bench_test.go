@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// syntheticOperaTitles builds a deterministic corpus of n plausible opera
+// titles, standing in for the full Open Opus/Wikidata opera list.
+func syntheticOperaTitles(n int) []string {
+	articles := []string{"", "La ", "Il ", "Le ", "Die ", "Der ", "The ", "Les ", "L'"}
+	nouns := []string{
+		"traviata", "trovatore", "nozze", "flauto", "ritorno", "incoronazione", "clemenza",
+		"forza", "sonnambula", "favorita", "fanciulla", "rondine", "cenerentola", "gazza",
+		"Zauberflöte", "Walküre", "Rosenkavalier", "Fledermaus", "Meistersinger", "Freischütz",
+		"pêcheurs", "contes", "troyens", "huguenots", "mamelles", "Rusalka", "Jenůfa", "Onegin",
+		"Queen", "Rake", "Turn", "Dream", "Fairy", "Ring", "Tempest", "Harvest", "Mountain",
+	}
+	tails := []string{
+		"", " di Tito", " d'Ulisse", " in patria", " del destino", " di Poppea", " del West",
+		" von Nürnberg", " ohne Schatten", " de perles", " d'Hoffmann", " de Tirésias",
+		" of Spades", " of the Screw", "'s Progress", " Night's Dream", " Queen", " of Dreams",
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	seen := make(map[string]bool, n)
+	titles := make([]string, 0, n)
+	for len(titles) < n {
+		t := articles[rng.Intn(len(articles))] + nouns[rng.Intn(len(nouns))] + tails[rng.Intn(len(tails))]
+		if rng.Intn(3) == 0 {
+			t = fmt.Sprintf("%s (%d)", t, 1600+rng.Intn(425))
+		}
+		if !seen[t] {
+			seen[t] = true
+			titles = append(titles, t)
+		}
+	}
+	return titles
+}
+
+var benchQueries = []string{
+	"La Traviata", "Il ritorno d'Ulisse in patria", "Die Walkure", "The Queen of Spades",
+	"Carmen – a new production", "Les contes d'Hoffmann (1881)", "Season Subscription",
+	"Rusalka", "Fledermaus New Year's Eve Gala", "Madame Butterfly",
+}
+
+// legacyFuzzyMatchTitle is FuzzyMatchTitle as it was before TitleMatcher:
+// lowercase, then a full Levenshtein matrix against every known title. It is
+// kept here as the benchmark baseline.
+func legacyFuzzyMatchTitle(title string, knownOperas []string) (string, float64) {
+	normTitle := strings.ToLower(strings.TrimSpace(title))
+	bestMatch := ""
+	bestScore := 0.0
+
+	for _, opera := range knownOperas {
+		normOpera := strings.ToLower(strings.TrimSpace(opera))
+		if normTitle == normOpera {
+			return opera, 1.0
+		}
+		if strings.Contains(normTitle, normOpera) || strings.Contains(normOpera, normTitle) {
+			score := float64(minInt(len(normTitle), len(normOpera))) / float64(maxInt(len(normTitle), len(normOpera)))
+			if score > bestScore {
+				bestScore, bestMatch = score, opera
+			}
+			continue
+		}
+
+		ra, rb := []rune(normTitle), []rune(normOpera)
+		d := make([][]int, len(ra)+1)
+		for i := range d {
+			d[i] = make([]int, len(rb)+1)
+			d[i][0] = i
+		}
+		for j := range d[0] {
+			d[0][j] = j
+		}
+		for i := 1; i <= len(ra); i++ {
+			for j := 1; j <= len(rb); j++ {
+				cost := 1
+				if ra[i-1] == rb[j-1] {
+					cost = 0
+				}
+				d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			}
+		}
+
+		maxLen := maxInt(utf8.RuneCountInString(normTitle), utf8.RuneCountInString(normOpera))
+		if maxLen == 0 {
+			continue
+		}
+		if score := 1.0 - float64(d[len(ra)][len(rb)])/float64(maxLen); score > bestScore {
+			bestScore, bestMatch = score, opera
+		}
+	}
+
+	if bestScore < 0.6 {
+		return "", 0
+	}
+	return bestMatch, bestScore
+}
+
+// scanBest scores title against every entry of m without using the trigram
+// index; the indexed Match must agree with it.
+func scanBest(m *TitleMatcher, title string) (TitleMatch, bool) {
+	var best TitleMatch
+	found := false
+	for _, v := range titleVariants(title) {
+		vr := []rune(v)
+		for _, e := range m.entries {
+			score := titleSimilarity(vr, e.runes)
+			if score >= minTitleMatchScore && (!found || score > best.Score) {
+				best = TitleMatch{Key: m.operas[e.opera].Key, Title: m.operas[e.opera].Title, Score: score, Via: e.alias}
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+func TestTitleMatcherIndexAgreesWithScan(t *testing.T) {
+	titles := syntheticOperaTitles(3000)
+	m := newTitleMatcherFromTitles(titles)
+
+	queries := append([]string{}, benchQueries...)
+	for i := 0; i < len(titles); i += 97 {
+		q := []rune(titles[i])
+		// Drop a rune to simulate a typo.
+		queries = append(queries, titles[i], string(append(q[:len(q)/2:len(q)/2], q[len(q)/2+1:]...)))
+	}
+
+	for _, q := range queries {
+		want, wantOK := scanBest(m, q)
+		got, gotOK := m.Best(q)
+		if wantOK != gotOK || (wantOK && got.Score != want.Score) {
+			t.Errorf("Best(%q) = %+v (%v), full scan found %+v (%v)", q, got, gotOK, want, wantOK)
+		}
+	}
+}
+
+func BenchmarkTitleMatching(b *testing.B) {
+	for _, size := range []int{100, 1000, 5000} {
+		titles := syntheticOperaTitles(size)
+
+		b.Run(fmt.Sprintf("legacy/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				legacyFuzzyMatchTitle(benchQueries[i%len(benchQueries)], titles)
+			}
+		})
+
+		b.Run(fmt.Sprintf("indexed/%d", size), func(b *testing.B) {
+			m := newTitleMatcherFromTitles(titles)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.Best(benchQueries[i%len(benchQueries)])
+			}
+		})
+	}
+}
+
+func BenchmarkTitleMatcherBuild(b *testing.B) {
+	titles := syntheticOperaTitles(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newTitleMatcherFromTitles(titles)
+	}
+}
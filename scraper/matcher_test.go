@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"La Traviata", "traviata"},
+		{"Die Zauberflöte", "zauberflote"},
+		{"L'elisir d'amore", "elisir d amore"},
+		{"Götterdämmerung", "gotterdammerung"},
+		{"  THE   Magic Flute ", "magic flute"},
+		{"Dido & Aeneas", "dido and aeneas"},
+		{"La", "la"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeTitle(tt.in); got != tt.want {
+			t.Errorf("normalizeTitle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTitleMatcher(t *testing.T) {
+	m := NewTitleMatcher([]OperaTitle{
+		{Key: "Q193600", Title: "La traviata"},
+		{Key: "Q128974", Title: "Die Zauberflöte"},
+		{Key: "Q190226", Title: "Le nozze di Figaro"},
+		{Key: "Q212599", Title: "Carmen"},
+		{Key: "Q183221", Title: "Rusalka"},
+		{Key: "Q187591", Title: "Madama Butterfly"},
+		{Key: "Q1090990", Title: "Don Pasquale"},
+		{Key: "Q207576", Title: "Don Giovanni", Aliases: []string{"Il dissoluto punito"}},
+	})
+
+	tests := []struct {
+		title   string
+		wantKey string
+		wantVia string
+	}{
+		{"Traviata", "Q193600", ""},
+		{"LA TRAVIATA", "Q193600", ""},
+		{"The Magic Flute", "Q128974", "The Magic Flute"},
+		{"Die Zauberflote", "Q128974", ""},
+		{"Marriage of Figaro", "Q190226", "The Marriage of Figaro"},
+		{"Carmen – a new production", "Q212599", ""},
+		{"Carmen (in concert)", "Q212599", ""},
+		{"Русалка", "Q183221", "Русалка"},
+		{"Madama Butterfly “Un bel dì”", "Q187591", ""},
+		{"Il dissoluto punito", "Q207576", "Il dissoluto punito"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			tm, ok := m.Best(tt.title)
+			if !ok {
+				t.Fatalf("Best(%q) found no match", tt.title)
+			}
+			if tm.Key != tt.wantKey || tm.Via != tt.wantVia {
+				t.Errorf("Best(%q) = %s via %q, want %s via %q", tt.title, tm.Key, tm.Via, tt.wantKey, tt.wantVia)
+			}
+		})
+	}
+
+	if tm, ok := m.Best("Season Subscription"); ok {
+		t.Errorf("Best(\"Season Subscription\") = %+v, want no match", tm)
+	}
+
+	matches := m.Match("Don", 5)
+	if len(matches) != 2 {
+		t.Fatalf("Match(\"Don\") = %+v, want both Don operas", matches)
+	}
+	if matches[0].Score < matches[1].Score {
+		t.Errorf("Match(\"Don\") not sorted by score: %+v", matches)
+	}
+}
+
+func TestHandleMatchLimit(t *testing.T) {
+	s := NewServer(filepath.Join(t.TempDir(), "config.yaml"), t.TempDir(), "")
+	for _, tt := range []struct {
+		n    string
+		code int
+	}{
+		{"5", 200},
+		{"50", 200},
+		{"51", 400},
+		{"1000000000", 400},
+		{"0", 400},
+	} {
+		rec := httptest.NewRecorder()
+		s.handleMatch(rec, httptest.NewRequest("GET", "/api/match?title=Tosca&n="+tt.n, nil))
+		if rec.Code != tt.code {
+			t.Errorf("n=%s: %d, want %d", tt.n, rec.Code, tt.code)
+		}
+	}
+}
@@ -4,26 +4,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
 )
 
 type VenueParser func(htmlContent []byte) ([]PerformanceEvent, error)
 
+// venueParsers maps venue codes to their venue-specific parsers.
+var venueParsers = map[string]VenueParser{
+	"laopera": ParseLAOpera,
+}
+
+// venueParserMarkup lists, per venue parser, the selectors it depends on. If
+// none of them match a fetched page the venue has most likely redesigned.
+var venueParserMarkup = map[string][]string{
+	"laopera": {".calendar__event-item", ".calendar__grid-event"},
+}
+
 func GetParser(venueCode string) VenueParser {
-	switch venueCode {
-	case "laopera":
-		return ParseLAOpera
-	default:
-		// Fall back to generic parser for unknown venues
-		return func(htmlContent []byte) ([]PerformanceEvent, error) {
-			events, _ := ParseGenericEvents(htmlContent, "")
-			return events, nil
+	if parser, ok := venueParsers[venueCode]; ok {
+		return parser
+	}
+	// Fall back to generic parser for unknown venues
+	return func(htmlContent []byte) ([]PerformanceEvent, error) {
+		events, _ := ParseGenericEvents(htmlContent, "")
+		return events, nil
+	}
+}
+
+// parserName returns the venue code for venues with their own parser, or
+// "generic".
+func parserName(venueCode string) string {
+	if _, ok := venueParsers[venueCode]; ok {
+		return venueCode
+	}
+	return "generic"
+}
+
+// missingMarkup returns the venue parser's selectors if none of them match
+// the page, or nil if at least one does.
+func missingMarkup(venueCode string, htmlContent []byte) []string {
+	selectors := venueParserMarkup[venueCode]
+	if len(selectors) == 0 {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(htmlContent)))
+	if err != nil {
+		return selectors
+	}
+	for _, sel := range selectors {
+		if doc.Find(sel).Length() > 0 {
+			return nil
 		}
 	}
+	return selectors
 }
 
 func ParseLAOpera(htmlContent []byte) ([]PerformanceEvent, error) {
@@ -113,32 +153,148 @@ func ParseLAOpera(htmlContent []byte) ([]PerformanceEvent, error) {
 
 // --- Smart Generic Parser (multi-strategy, local-only) ---
 
-// ParseGenericEvents uses 3 ranked strategies to extract events from any HTML page.
-// Returns events and the strategy name that produced them.
+// strategyPrecedence orders the generic strategies from most to least
+// trusted. When candidates from several strategies describe the same event,
+// each field is taken from the most trusted strategy that supplied it.
+var strategyPrecedence = []string{"json-ld", "heuristic", "meta"}
+
+// ParseGenericEvents runs all 3 strategies against any HTML page and merges
+// their candidates. Returns the events and the contributing strategy names
+// joined with "+", or "none" if nothing was found.
 func ParseGenericEvents(htmlContent []byte, sourceURL string) ([]PerformanceEvent, string) {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(htmlContent)))
 	if err != nil {
 		return nil, "error"
 	}
 
-	// Strategy 1: JSON-LD / Schema.org structured data (gold standard)
-	if events := parseJSONLD(doc, sourceURL); len(events) > 0 {
-		return events, "json-ld"
+	candidates := map[string][]PerformanceEvent{
+		// Strategy 1: JSON-LD / Schema.org structured data (gold standard)
+		"json-ld": parseJSONLD(doc, sourceURL),
+		// Strategy 2: Heuristic DOM extraction
+		"heuristic": parseHeuristicDOM(doc, sourceURL),
+		// Strategy 3: Meta tag fallback (page-level only)
+		"meta": parseMetaFallback(doc, sourceURL),
+	}
+
+	events := mergeCandidates(candidates)
+	if len(events) == 0 {
+		return nil, "none"
+	}
+
+	var used []string
+	for _, strategy := range strategyPrecedence {
+		if len(candidates[strategy]) > 0 {
+			used = append(used, strategy)
+		}
+	}
+	return events, strings.Join(used, "+")
+}
+
+// mergeCandidates deduplicates candidates across strategies. Two candidates
+// are the same event when their normalised titles are equal and they share a
+// date (or one of them has no dates). Dates are unioned; every other field
+// follows strategyPrecedence.
+func mergeCandidates(candidates map[string][]PerformanceEvent) []PerformanceEvent {
+	var merged []PerformanceEvent
+	for _, strategy := range strategyPrecedence {
+		for _, cand := range candidates[strategy] {
+			cand.Strategy = strategy
+			cand.Strategies = []string{strategy}
+
+			if i := findMergeTarget(merged, cand); i >= 0 {
+				mergeInto(&merged[i], cand)
+			} else {
+				merged = append(merged, cand)
+			}
+		}
+	}
+	return merged
+}
+
+func findMergeTarget(merged []PerformanceEvent, cand PerformanceEvent) int {
+	title := normalizeTitleKey(cand.Title)
+	for i, ev := range merged {
+		if normalizeTitleKey(ev.Title) != title {
+			continue
+		}
+		if len(ev.Dates) == 0 || len(cand.Dates) == 0 || sharesDate(ev.Dates, cand.Dates) {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergeInto fills empty fields of dst from a lower-precedence candidate and
+// adds any dates dst does not already have.
+func mergeInto(dst *PerformanceEvent, src PerformanceEvent) {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	for source, name := range src.ComposerSources {
+		addComposerSource(dst, source, name)
+	}
+	resolveComposer(dst)
+	fill(&dst.VenueName, src.VenueName)
+	fill(&dst.City, src.City)
+	fill(&dst.State, src.State)
+	fill(&dst.SourceURL, src.SourceURL)
+	for _, name := range src.Cast {
+		if !containsFold(dst.Cast, name) {
+			dst.Cast = append(dst.Cast, name)
+		}
+	}
+
+	have := make(map[string]bool)
+	for _, d := range dst.Dates {
+		have[dateKey(d)] = true
+	}
+	for _, d := range src.Dates {
+		if k := dateKey(d); !have[k] {
+			have[k] = true
+			dst.Dates = append(dst.Dates, d)
+		}
 	}
 
-	// Strategy 2: Heuristic DOM extraction
-	if events := parseHeuristicDOM(doc, sourceURL); len(events) > 0 {
-		return events, "heuristic"
+	for _, s := range dst.Strategies {
+		if s == src.Strategy {
+			return
+		}
 	}
+	dst.Strategies = append(dst.Strategies, src.Strategy)
+}
 
-	// Strategy 3: Meta tag fallback (page-level only)
-	if events := parseMetaFallback(doc, sourceURL); len(events) > 0 {
-		return events, "meta"
+func sharesDate(a, b []string) bool {
+	keys := make(map[string]bool, len(a))
+	for _, d := range a {
+		keys[dateKey(d)] = true
 	}
+	for _, d := range b {
+		if keys[dateKey(d)] {
+			return true
+		}
+	}
+	return false
+}
 
-	return nil, "none"
+// dateKey normalises a date string so "2026-03-14" and "March 14, 2026"
+// compare equal. Unparseable dates compare by their trimmed text.
+func dateKey(d string) string {
+	if t, ok := parseEventDate(d); ok {
+		return t.Format("2006-01-02")
+	}
+	return strings.ToLower(strings.TrimSpace(d))
+}
+
+func normalizeTitleKey(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
 }
 
+// maxLDDepth bounds how deep parseJSONLD follows nested arrays and @graph
+// containers, so hostile pages can't make it recurse without limit.
+const maxLDDepth = 8
+
 // parseJSONLD extracts events from <script type="application/ld+json"> tags
 func parseJSONLD(doc *goquery.Document, sourceURL string) []PerformanceEvent {
 	var events []PerformanceEvent
@@ -149,47 +305,61 @@ func parseJSONLD(doc *goquery.Document, sourceURL string) []PerformanceEvent {
 			return
 		}
 
-		// Try as single object
-		var obj map[string]interface{}
-		if err := json.Unmarshal([]byte(text), &obj); err == nil {
-			if ev := extractEventFromLD(obj, sourceURL); ev != nil {
-				events = append(events, *ev)
-			}
-			// Check for @graph array
-			if graph, ok := obj["@graph"].([]interface{}); ok {
-				for _, item := range graph {
-					if m, ok := item.(map[string]interface{}); ok {
-						if ev := extractEventFromLD(m, sourceURL); ev != nil {
-							events = append(events, *ev)
-						}
-					}
-				}
-			}
+		var data interface{}
+		if err := json.Unmarshal([]byte(text), &data); err != nil {
 			return
 		}
-
-		// Try as array
-		var arr []map[string]interface{}
-		if err := json.Unmarshal([]byte(text), &arr); err == nil {
-			for _, obj := range arr {
-				if ev := extractEventFromLD(obj, sourceURL); ev != nil {
-					events = append(events, *ev)
-				}
-			}
-		}
+		events = appendLDEvents(events, data, sourceURL, 0)
 	})
 
 	return events
 }
 
-func extractEventFromLD(obj map[string]interface{}, sourceURL string) *PerformanceEvent {
-	typ, _ := obj["@type"].(string)
+// appendLDEvents walks a decoded JSON-LD value: a single object, an array of
+// objects, or an object with an @graph array, in any nesting up to maxLDDepth.
+func appendLDEvents(events []PerformanceEvent, v interface{}, sourceURL string, depth int) []PerformanceEvent {
+	if depth > maxLDDepth {
+		return events
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			events = appendLDEvents(events, item, sourceURL, depth+1)
+		}
+	case map[string]interface{}:
+		if ev := extractEventFromLD(v, sourceURL); ev != nil {
+			events = append(events, *ev)
+		}
+		if graph, ok := v["@graph"]; ok {
+			events = appendLDEvents(events, graph, sourceURL, depth+1)
+		}
+	}
+	return events
+}
+
+var ldEventTypes = map[string]bool{
+	"Event": true, "MusicEvent": true, "TheaterEvent": true,
+	"DanceEvent": true, "Festival": true, "ScreeningEvent": true,
+}
 
-	eventTypes := map[string]bool{
-		"Event": true, "MusicEvent": true, "TheaterEvent": true,
-		"DanceEvent": true, "Festival": true, "ScreeningEvent": true,
+// isLDEvent reports whether @type, a string or an array of strings, names an
+// event type.
+func isLDEvent(typ interface{}) bool {
+	switch typ := typ.(type) {
+	case string:
+		return ldEventTypes[typ]
+	case []interface{}:
+		for _, t := range typ {
+			if s, ok := t.(string); ok && ldEventTypes[s] {
+				return true
+			}
+		}
 	}
-	if !eventTypes[typ] {
+	return false
+}
+
+func extractEventFromLD(obj map[string]interface{}, sourceURL string) *PerformanceEvent {
+	if !isLDEvent(obj["@type"]) {
 		return nil
 	}
 
@@ -222,7 +392,7 @@ func extractEventFromLD(obj map[string]interface{}, sourceURL string) *Performan
 		eventURL = u
 	}
 
-	return &PerformanceEvent{
+	ev := &PerformanceEvent{
 		EventID:   fmt.Sprintf("ld_%s_%s", sanitizeID(name), sanitizeID(strings.Join(dates, "_"))),
 		Title:     name,
 		Dates:     dates,
@@ -232,7 +402,14 @@ func extractEventFromLD(obj map[string]interface{}, sourceURL string) *Performan
 		SourceURL: eventURL,
 		ScrapedAt: time.Now().Format(time.RFC3339),
 		Region:    "custom",
+		Cast:      ldNames(obj["performer"]),
+	}
+	addComposerSource(ev, composerFromJSONLD, ldComposer(obj))
+	if description, ok := obj["description"].(string); ok {
+		addComposerSource(ev, composerFromText, composerFromPageText(description))
 	}
+	resolveComposer(ev)
+	return ev
 }
 
 // Date patterns for heuristic extraction
@@ -244,95 +421,138 @@ var (
 	numericDateRe = regexp.MustCompile(`\d{1,2}/\d{1,2}/\d{4}`)
 )
 
-// parseHeuristicDOM scans the DOM for event-like patterns
-func parseHeuristicDOM(doc *goquery.Document, sourceURL string) []PerformanceEvent {
-	var events []PerformanceEvent
-	seen := make(map[string]bool)
+// heuristicSelectors match elements that commonly wrap a single event.
+var heuristicSelectors = []string{
+	"[itemtype*='schema.org/Event']",
+	"[class*='event']", "[class*='Event']",
+	"[class*='performance']", "[class*='Performance']",
+	"[class*='show']", "[class*='Show']",
+	"[class*='schedule']", "[class*='Schedule']",
+	"[class*='calendar']", "[class*='Calendar']",
+	"[class*='season']", "[class*='Season']",
+	"[class*='production']", "[class*='Production']",
+	"article",
+	"[data-date]",
+	"[datetime]",
+}
 
-	selectors := []string{
-		"[itemtype*='schema.org/Event']",
-		"[class*='event']", "[class*='Event']",
-		"[class*='performance']", "[class*='Performance']",
-		"[class*='show']", "[class*='Show']",
-		"[class*='schedule']", "[class*='Schedule']",
-		"[class*='calendar']", "[class*='Calendar']",
-		"[class*='season']", "[class*='Season']",
-		"[class*='production']", "[class*='Production']",
-		"article",
-		"[data-date]",
-		"[datetime]",
+// parseHeuristicDOM scans the DOM for event-like patterns. Every selector is
+// evaluated; when both a container and elements inside it yield an event
+// (e.g. a calendar wrapper around event cards), only the innermost elements
+// are kept so the container's title doesn't absorb every card's dates.
+func parseHeuristicDOM(doc *goquery.Document, sourceURL string) []PerformanceEvent {
+	type candidate struct {
+		node  *html.Node
+		event PerformanceEvent
 	}
 
-	for _, sel := range selectors {
-		doc.Find(sel).Each(func(i int, s *goquery.Selection) {
-			text := strings.TrimSpace(s.Text())
-			if len(text) < 10 || len(text) > 2000 {
+	var candidates []candidate
+	visited := make(map[*html.Node]bool)
+	for _, sel := range heuristicSelectors {
+		doc.Find(sel).Each(func(_ int, s *goquery.Selection) {
+			node := s.Get(0)
+			if visited[node] {
 				return
 			}
-
-			dates := extractDates(text)
-			if len(dates) == 0 {
-				if dt, exists := s.Attr("datetime"); exists {
-					dates = append(dates, dt)
-				}
-				if dt, exists := s.Attr("data-date"); exists {
-					dates = append(dates, dt)
-				}
+			visited[node] = true
+			if ev, ok := heuristicEvent(s, sourceURL); ok {
+				candidates = append(candidates, candidate{node, ev})
 			}
+		})
+	}
 
-			title := ""
-			s.Find("h1, h2, h3, h4, h5, strong, b, .title, [class*='title'], [class*='name']").First().Each(func(_ int, t *goquery.Selection) {
-				title = strings.TrimSpace(t.Text())
-			})
-			if title == "" {
-				s.Find("a").First().Each(func(_ int, a *goquery.Selection) {
-					t := strings.TrimSpace(a.Text())
-					if len(t) > 3 && len(t) < 200 {
-						title = t
-					}
-				})
-			}
+	containers := make(map[*html.Node]bool)
+	for _, c := range candidates {
+		for p := c.node.Parent; p != nil; p = p.Parent {
+			containers[p] = true
+		}
+	}
 
-			if title == "" || len(dates) == 0 {
-				return
-			}
+	// Emit in document order rather than selector order.
+	order := make(map[*html.Node]int)
+	doc.Find("*").Each(func(i int, s *goquery.Selection) {
+		order[s.Get(0)] = i
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return order[candidates[i].node] < order[candidates[j].node]
+	})
 
-			id := fmt.Sprintf("%s|%s", title, strings.Join(dates, ","))
-			if seen[id] {
-				return
-			}
-			seen[id] = true
-
-			link := sourceURL
-			s.Find("a[href]").First().Each(func(_ int, a *goquery.Selection) {
-				if href, exists := a.Attr("href"); exists && href != "" && href != "#" {
-					if strings.HasPrefix(href, "/") && sourceURL != "" {
-						parts := strings.SplitN(sourceURL, "/", 4)
-						if len(parts) >= 3 {
-							link = parts[0] + "//" + parts[2] + href
-						}
-					} else if strings.HasPrefix(href, "http") {
-						link = href
-					}
-				}
-			})
+	var events []PerformanceEvent
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if containers[c.node] {
+			continue
+		}
+		id := fmt.Sprintf("%s|%s", c.event.Title, strings.Join(c.event.Dates, ","))
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		events = append(events, c.event)
+	}
 
-			events = append(events, PerformanceEvent{
-				EventID:   fmt.Sprintf("dom_%s_%d", sanitizeID(title), i),
-				Title:     title,
-				Dates:     dates,
-				SourceURL: link,
-				ScrapedAt: time.Now().Format(time.RFC3339),
-				Region:    "custom",
-			})
-		})
+	return events
+}
 
-		if len(events) > 0 {
-			break
+// heuristicEvent extracts a title, dates and link from one candidate element.
+func heuristicEvent(s *goquery.Selection, sourceURL string) (PerformanceEvent, bool) {
+	text := strings.TrimSpace(s.Text())
+	if len(text) < 10 || len(text) > 2000 {
+		return PerformanceEvent{}, false
+	}
+
+	dates := extractDates(text)
+	if len(dates) == 0 {
+		if dt, exists := s.Attr("datetime"); exists {
+			dates = append(dates, dt)
+		}
+		if dt, exists := s.Attr("data-date"); exists {
+			dates = append(dates, dt)
 		}
 	}
 
-	return events
+	title := ""
+	s.Find("h1, h2, h3, h4, h5, strong, b, .title, [class*='title'], [class*='name']").First().Each(func(_ int, t *goquery.Selection) {
+		title = strings.TrimSpace(t.Text())
+	})
+	if title == "" {
+		s.Find("a").First().Each(func(_ int, a *goquery.Selection) {
+			t := strings.TrimSpace(a.Text())
+			if len(t) > 3 && len(t) < 200 {
+				title = t
+			}
+		})
+	}
+
+	if title == "" || len(dates) == 0 {
+		return PerformanceEvent{}, false
+	}
+
+	link := sourceURL
+	s.Find("a[href]").First().Each(func(_ int, a *goquery.Selection) {
+		if href, exists := a.Attr("href"); exists && href != "" && href != "#" {
+			if strings.HasPrefix(href, "/") && sourceURL != "" {
+				parts := strings.SplitN(sourceURL, "/", 4)
+				if len(parts) >= 3 {
+					link = parts[0] + "//" + parts[2] + href
+				}
+			} else if strings.HasPrefix(href, "http") {
+				link = href
+			}
+		}
+	})
+
+	ev := PerformanceEvent{
+		EventID:   fmt.Sprintf("dom_%s_%s", sanitizeID(title), sanitizeID(strings.Join(dates, "_"))),
+		Title:     title,
+		Dates:     dates,
+		SourceURL: link,
+		ScrapedAt: time.Now().Format(time.RFC3339),
+		Region:    "custom",
+	}
+	addComposerSource(&ev, composerFromText, composerFromPageText(text))
+	resolveComposer(&ev)
+	return ev, true
 }
 
 // parseMetaFallback extracts page-level info from meta tags
@@ -370,14 +590,17 @@ func parseMetaFallback(doc *goquery.Document, sourceURL string) []PerformanceEve
 
 	dates := extractDates(title + " " + description)
 
-	return []PerformanceEvent{{
+	ev := PerformanceEvent{
 		EventID:   fmt.Sprintf("meta_%s", sanitizeID(title)),
 		Title:     title,
 		Dates:     dates,
 		SourceURL: sourceURL,
 		ScrapedAt: time.Now().Format(time.RFC3339),
 		Region:    "custom",
-	}}
+	}
+	addComposerSource(&ev, composerFromText, composerFromPageText(description))
+	resolveComposer(&ev)
+	return []PerformanceEvent{ev}
 }
 
 // extractDates finds date-like strings in text
@@ -397,84 +620,102 @@ func extractDates(text string) []string {
 	return dates
 }
 
-// FuzzyMatchTitle matches a scraped title against known opera titles using Levenshtein distance.
-func FuzzyMatchTitle(title string, knownOperas []string) (string, float64) {
-	normTitle := strings.ToLower(strings.TrimSpace(title))
-	bestMatch := ""
-	bestScore := 0.0
-
-	for _, opera := range knownOperas {
-		normOpera := strings.ToLower(strings.TrimSpace(opera))
-
-		if normTitle == normOpera {
-			return opera, 1.0
-		}
-
-		if strings.Contains(normTitle, normOpera) || strings.Contains(normOpera, normTitle) {
-			score := float64(minInt(len(normTitle), len(normOpera))) / float64(maxInt(len(normTitle), len(normOpera)))
-			if score > bestScore {
-				bestScore = score
-				bestMatch = opera
-			}
-			continue
-		}
+var eventDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"January 2, 2006",
+	"January 2 2006",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"2 January 2006",
+	"1/2/2006",
+}
 
-		dist := levenshtein(normTitle, normOpera)
-		maxLen := maxInt(utf8.RuneCountInString(normTitle), utf8.RuneCountInString(normOpera))
-		if maxLen == 0 {
-			continue
-		}
-		score := 1.0 - float64(dist)/float64(maxLen)
-		if score > bestScore {
-			bestScore = score
-			bestMatch = opera
+// parseEventDate parses a date string as produced by the parsers. Strings
+// carrying extra text (e.g. "2026-03-14 7:30 PM") are parsed from the first
+// date-like substring.
+func parseEventDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range eventDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
 		}
 	}
-
-	if bestScore < 0.6 {
-		return "", 0
+	if found := extractDates(s); len(found) > 0 && found[0] != s {
+		return parseEventDate(found[0])
 	}
-	return bestMatch, bestScore
+	return time.Time{}, false
 }
 
-func levenshtein(a, b string) int {
-	la := utf8.RuneCountInString(a)
-	lb := utf8.RuneCountInString(b)
-	ra := []rune(a)
-	rb := []rune(b)
+// FuzzyMatchTitle matches a scraped title against known opera titles. It is
+// a convenience wrapper around TitleMatcher for callers holding bare titles;
+// it indexes knownOperas on every call, so callers matching many titles
+// should build one TitleMatcher and reuse it.
+func FuzzyMatchTitle(title string, knownOperas []string) (string, float64) {
+	if tm, ok := newTitleMatcherFromTitles(knownOperas).Best(title); ok {
+		return tm.Title, tm.Score
+	}
+	return "", 0
+}
 
-	d := make([][]int, la+1)
-	for i := range d {
-		d[i] = make([]int, lb+1)
-		d[i][0] = i
+// levenshtein returns the edit distance between two rune slices using two
+// rows rather than a full matrix.
+func levenshtein(a, b []rune) int {
+	if len(a) < len(b) {
+		a, b = b, a
 	}
-	for j := 0; j <= lb; j++ {
-		d[0][j] = j
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
 	}
 
-	for i := 1; i <= la; i++ {
-		for j := 1; j <= lb; j++ {
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
 			cost := 1
-			if ra[i-1] == rb[j-1] {
+			if a[i-1] == b[j-1] {
 				cost = 0
 			}
-			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
 		}
+		prev, cur = cur, prev
 	}
 
-	return d[la][lb]
+	return prev[len(b)]
 }
 
+// sanitizeID lowercases s and replaces everything but ASCII letters and
+// digits with '_', keeping at most 40 runes. IDs already stored on disk were
+// made this way, so it must not change. Titles with no ASCII letters or
+// digits at all, such as "Русалка", keep their letters instead of collapsing
+// to underscores.
 func sanitizeID(s string) string {
 	s = strings.ToLower(strings.TrimSpace(s))
+	id := mapID(s, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+	})
+	if strings.Trim(id, "_") == "" {
+		id = mapID(s, func(r rune) bool {
+			return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+		})
+	}
+	return id
+}
+
+// mapID replaces the runes of s that keep rejects with '_' and truncates the
+// result to 40 runes.
+func mapID(s string, keep func(rune) bool) string {
 	result := strings.Map(func(r rune) rune {
-		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+		if keep(r) {
 			return r
 		}
 		return '_'
 	}, s)
-	if len(result) > 40 {
-		result = result[:40]
+	if utf8.RuneCountInString(result) > 40 {
+		result = string([]rune(result)[:40])
 	}
 	return result
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractDates(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"iso", "Opening night 2026-11-08, closing 2026-11-22", []string{"2026-11-08", "2026-11-22"}},
+		{"us long", "Saturday, November 8, 2026 at 7:30pm", []string{"November 8, 2026"}},
+		{"us short", "Nov 8 2026", []string{"Nov 8 2026"}},
+		{"euro", "8 November 2026", []string{"8 November 2026"}},
+		{"numeric", "11/08/2026", []string{"11/08/2026"}},
+		{"duplicates", "2026-11-08 and again 2026-11-08", []string{"2026-11-08"}},
+		{"none", "Tickets on sale now", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractDates(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractDates(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuzzyMatchTitle(t *testing.T) {
+	known := []string{"La traviata", "Tosca", "Madama Butterfly", "Die Zauberflöte", "Rigoletto"}
+
+	tests := []struct {
+		title     string
+		wantMatch string
+		minScore  float64
+	}{
+		{"La Traviata", "La traviata", 1.0},
+		{"  tosca ", "Tosca", 1.0},
+		{"Madame Butterfly", "Madama Butterfly", 0.8},
+		{"Rigolleto", "Rigoletto", 0.7},
+		{"Gift Cards", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			match, score := FuzzyMatchTitle(tt.title, known)
+			if match != tt.wantMatch {
+				t.Fatalf("FuzzyMatchTitle(%q) = %q, want %q", tt.title, match, tt.wantMatch)
+			}
+			if score < tt.minScore {
+				t.Errorf("FuzzyMatchTitle(%q) score = %.2f, want >= %.2f", tt.title, score, tt.minScore)
+			}
+		})
+	}
+}
+
+func TestSanitizeID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"La Traviata", "la_traviata"},
+		{"Русалка", "русалка"},
+		{"Die Zauberflöte", "die_zauberfl_te"},
+		{"Madama Butterfly “Un bel dì”", "madama_butterfly__un_bel_d__"},
+		{"Götterdämmerung: Der Ring des Nibelungen, Part Four", "g_tterd_mmerung__der_ring_des_nibelungen"},
+		{"Русалка 2026-11-08", "________2026_11_08"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeID(tt.in); got != tt.want {
+			t.Errorf("sanitizeID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseJSONLDNesting(t *testing.T) {
+	page := `<script type="application/ld+json">[{"@graph": [{"@type": ["Event", "MusicEvent"], "name": "Tosca", "startDate": "2027-01-01"}]}]</script>` +
+		`<script type="application/ld+json">` + strings.Repeat(`{"@graph":[`, 5000) + strings.Repeat(`]}`, 5000) + `</script>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := parseJSONLD(doc, "")
+	if len(events) != 1 || events[0].Title != "Tosca" {
+		t.Errorf("parseJSONLD() = %+v, want one Tosca event", events)
+	}
+}
+
+func TestMergeCandidates(t *testing.T) {
+	candidates := map[string][]PerformanceEvent{
+		"json-ld": {
+			{Title: "Tosca", Dates: []string{"2026-11-08"}, VenueName: "Dorothy Chandler Pavilion", SourceURL: "https://example.org/tosca"},
+		},
+		"heuristic": {
+			{Title: "La Bohème", Dates: []string{"2026-12-01"}, SourceURL: "https://example.org/boheme"},
+			{Title: "tosca", Dates: []string{"November 8, 2026", "2026-11-12"}, VenueName: "Main stage", City: "Los Angeles", SourceURL: "https://example.org/"},
+			{Title: "Rusalka", Dates: []string{"2027-02-14"}},
+		},
+		"meta": {
+			{Title: "La Bohème", City: "Los Angeles", SourceURL: "https://example.org/"},
+		},
+	}
+
+	got := mergeCandidates(candidates)
+
+	var titles []string
+	for _, ev := range got {
+		titles = append(titles, ev.Title)
+	}
+	if want := []string{"Tosca", "La Bohème", "Rusalka"}; !reflect.DeepEqual(titles, want) {
+		t.Fatalf("merged titles = %q, want %q", titles, want)
+	}
+
+	tosca := got[0]
+	if tosca.VenueName != "Dorothy Chandler Pavilion" || tosca.SourceURL != "https://example.org/tosca" {
+		t.Errorf("tosca venue and URL = %q, %q, want the json-ld ones", tosca.VenueName, tosca.SourceURL)
+	}
+	if tosca.City != "Los Angeles" {
+		t.Errorf("tosca city = %q, want it filled from heuristic", tosca.City)
+	}
+	if want := []string{"2026-11-08", "2026-11-12"}; !reflect.DeepEqual(tosca.Dates, want) {
+		t.Errorf("tosca dates = %q, want %q", tosca.Dates, want)
+	}
+	if tosca.Strategy != "json-ld" || !reflect.DeepEqual(tosca.Strategies, []string{"json-ld", "heuristic"}) {
+		t.Errorf("tosca strategy = %q %q, want json-ld from json-ld+heuristic", tosca.Strategy, tosca.Strategies)
+	}
+
+	boheme := got[1]
+	if boheme.Strategy != "heuristic" || !reflect.DeepEqual(boheme.Strategies, []string{"heuristic", "meta"}) {
+		t.Errorf("bohème strategy = %q %q, want heuristic from heuristic+meta", boheme.Strategy, boheme.Strategies)
+	}
+	if boheme.SourceURL != "https://example.org/boheme" || boheme.City != "Los Angeles" {
+		t.Errorf("bohème URL and city = %q, %q, want heuristic URL and meta city", boheme.SourceURL, boheme.City)
+	}
+}
+
+func TestParseHeuristicDOMInnermostInOrder(t *testing.T) {
+	page := `<section class="season">
+		<h2>Season 2026/27</h2>
+		<article class="event"><h3>Rusalka</h3><time datetime="2027-02-14">February 14, 2027</time></article>
+		<div class="performance"><h3>Tosca</h3><span>November 8, 2026</span></div>
+	</section>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, ev := range parseHeuristicDOM(doc, "") {
+		titles = append(titles, ev.Title)
+	}
+	if want := []string{"Rusalka", "Tosca"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("parseHeuristicDOM() titles = %q, want %q", titles, want)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import "sort"
+
+// EventSnapshot is one stored scrape of an event: the file it came from and
+// what the event looked like then.
+type EventSnapshot struct {
+	Event     string   `json:"event"`
+	File      string   `json:"file"` // relative to data/raw
+	ScrapedAt string   `json:"scraped_at"`
+	Title     string   `json:"opera_title"`
+	Dates     []string `json:"dates"`
+	SourceURL string   `json:"source_url"`
+}
+
+// EventDetail is the latest snapshot of one event with its scrape history,
+// as served by /api/events/{id}.
+type EventDetail struct {
+	PerformanceEvent
+	ID           string          `json:"id"`
+	ProductionID string          `json:"production_id"`
+	History      []EventSnapshot `json:"history"`
+}
+
+// Production groups the events of one work at one venue, e.g. a listing per
+// performance night, into a single staging with all its dates.
+type Production struct {
+	ID              string          `json:"id"`
+	VenueCode       string          `json:"venue_code"`
+	VenueName       string          `json:"venue_name"`
+	City            string          `json:"city"`
+	State           string          `json:"state"`
+	Region          string          `json:"region"`
+	Title           string          `json:"opera_title"`
+	Composer        string          `json:"composer"`
+	MatchedOperaKey string          `json:"matched_opera_key,omitempty"`
+	Dates           []string        `json:"dates"`
+	SourceURLs      []string        `json:"source_urls"`
+	FirstSeenAt     string          `json:"first_seen_at,omitempty"`
+	Events          []string        `json:"events"`
+	History         []EventSnapshot `json:"history"`
+	Opera           *GraphNode      `json:"opera,omitempty"`
+}
+
+// productionKey identifies the staging an event belongs to: its venue (or
+// custom source) and the matched graph opera, or failing that the title
+// without any production subtitle.
+func productionKey(ev PerformanceEvent) string {
+	work := ev.MatchedOperaKey
+	if work == "" {
+		variants := titleVariants(ev.Title)
+		work = sanitizeID(variants[len(variants)-1])
+	}
+	return eventScope(ev) + ":" + work
+}
+
+// newProduction aggregates the latest snapshots of a production's events
+// and their scrape history.
+func newProduction(id string, events []PerformanceEvent, history []EventSnapshot) Production {
+	p := Production{ID: id, Dates: []string{}, SourceURLs: []string{}, History: history}
+	if p.History == nil {
+		p.History = []EventSnapshot{}
+	}
+	seenDates := make(map[string]bool)
+	seenURLs := make(map[string]bool)
+	for _, ev := range events {
+		p.Events = append(p.Events, eventKey(ev))
+		if p.VenueCode == "" {
+			p.VenueCode, p.VenueName, p.City, p.State, p.Region = ev.VenueCode, ev.VenueName, ev.City, ev.State, ev.Region
+		}
+		// The shortest title is usually the plain work title rather than
+		// one night's "Tosca – Opening Night".
+		if p.Title == "" || len(ev.Title) < len(p.Title) {
+			p.Title = ev.Title
+		}
+		if p.Composer == "" {
+			p.Composer = ev.Composer
+		}
+		if p.MatchedOperaKey == "" {
+			p.MatchedOperaKey = ev.MatchedOperaKey
+		}
+		if ev.FirstSeenAt != "" && (p.FirstSeenAt == "" || storedTime(ev.FirstSeenAt).Before(storedTime(p.FirstSeenAt))) {
+			p.FirstSeenAt = ev.FirstSeenAt
+		}
+		for _, d := range ev.Dates {
+			if !seenDates[d] {
+				seenDates[d] = true
+				p.Dates = append(p.Dates, d)
+			}
+		}
+		if ev.SourceURL != "" && !seenURLs[ev.SourceURL] {
+			seenURLs[ev.SourceURL] = true
+			p.SourceURLs = append(p.SourceURLs, ev.SourceURL)
+		}
+	}
+	if len(events) > 0 {
+		sortDates(p.Dates, events[0])
+	}
+	sort.Strings(p.SourceURLs)
+	return p
+}
+
+// sortDates orders scraped date strings chronologically in ev's venue time
+// zone, leaving any that cannot be parsed at the end in their original
+// order.
+func sortDates(dates []string, ev PerformanceEvent) {
+	loc := eventLocation(ev)
+	keys := make(map[string]string, len(dates))
+	for _, d := range dates {
+		if start, _, ok := parseOccurrence(d, loc); ok {
+			keys[d] = start.Format("2006-01-02T15:04")
+		}
+	}
+	sort.SliceStable(dates, func(i, j int) bool {
+		ki, iok := keys[dates[i]]
+		kj, jok := keys[dates[j]]
+		if iok != jok {
+			return iok
+		}
+		return iok && ki < kj
+	})
+}
+
+// sortSnapshots orders scrape history oldest first.
+func sortSnapshots(history []EventSnapshot) {
+	sort.SliceStable(history, func(i, j int) bool {
+		ti, tj := storedTime(history[i].ScrapedAt), storedTime(history[j].ScrapedAt)
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		if history[i].File != history[j].File {
+			return history[i].File < history[j].File
+		}
+		return history[i].Event < history[j].Event
+	})
+}
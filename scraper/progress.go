@@ -0,0 +1,50 @@
+package main
+
+import "time"
+
+// Progress event types, in the order a venue goes through them.
+const (
+	ProgressJobStarted    = "job_started"
+	ProgressVenueStarted  = "venue_started"
+	ProgressRobots        = "robots"         // Robots is "allowed" or "blocked"
+	ProgressCache         = "cache"          // Cache is "hit" or "miss"
+	ProgressFetched       = "fetched"        // FetchMs
+	ProgressStrike        = "strike"         // Strikes so far; Error
+	ProgressParsed        = "parsed"         // Events parsed
+	ProgressVenueFinished = "venue_finished" // Events saved, Rejected, Error
+	ProgressJobFinished   = "job_finished"   // State of the job, Error
+)
+
+// ScrapeProgress is one step of a scrape. Seq and Job are set by the job
+// manager; the scraper fills in the rest.
+type ScrapeProgress struct {
+	Seq      int    `json:"seq"`
+	Job      string `json:"job,omitempty"`
+	Type     string `json:"type"`
+	Time     string `json:"time"`
+	Region   string `json:"region,omitempty"`
+	Venue    string `json:"venue,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Robots   string `json:"robots,omitempty"`
+	Cache    string `json:"cache,omitempty"`
+	FetchMs  int64  `json:"fetch_ms,omitempty"`
+	Strikes  int    `json:"strikes,omitempty"`
+	Events   int    `json:"events,omitempty"`
+	Rejected int    `json:"rejected,omitempty"`
+	State    string `json:"state,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ScrapeObserver is told about each step of a scrape as it happens.
+type ScrapeObserver interface {
+	Report(p ScrapeProgress)
+}
+
+// report timestamps p and passes it to observer, which may be nil.
+func report(observer ScrapeObserver, p ScrapeProgress) {
+	if observer == nil {
+		return
+	}
+	p.Time = time.Now().Format(time.RFC3339)
+	observer.Report(p)
+}
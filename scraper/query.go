@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 500
+	queryDateLayout    = "2006-01-02"
+)
+
+// eventSortKeys maps each ?sort= field to the value events are ordered by.
+// Values are compared as strings, so each is formatted to sort naturally.
+var eventSortKeys = map[string]func(ev PerformanceEvent, q *EventQuery) string{
+	"date":     func(ev PerformanceEvent, q *EventQuery) string { return q.nextDate(ev) },
+	"title":    func(ev PerformanceEvent, q *EventQuery) string { return normalizeTitle(ev.Title) },
+	"venue":    func(ev PerformanceEvent, q *EventQuery) string { return strings.ToLower(ev.VenueName) },
+	"composer": func(ev PerformanceEvent, q *EventQuery) string { return composerSurname(ev.Composer) },
+	"first_seen": func(ev PerformanceEvent, q *EventQuery) string {
+		return storedTime(ev.FirstSeenAt).UTC().Format(time.RFC3339)
+	},
+}
+
+// EventQuery is a parsed GET /api/events request.
+type EventQuery struct {
+	Filter EventFilter
+	Cities []string
+	States []string
+	Title  string // normalized substring of the title
+
+	// Inclusive venue-local date range as YYYY-MM-DD; empty is unbounded.
+	From, To string
+
+	Sort   string
+	Desc   bool
+	Cursor string
+	Limit  int
+}
+
+// EventPage is one page of query results.
+type EventPage struct {
+	Events     []PerformanceEvent `json:"events"`
+	Total      int                `json:"total"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// ParseEventQuery reads filters, sorting and pagination from query
+// parameters. Without from, to or past=true only events with a date from
+// today onwards are returned.
+func ParseEventQuery(q url.Values, now time.Time) (EventQuery, error) {
+	eq := EventQuery{
+		Filter: ParseEventFilter(q),
+		Cities: splitFilterValues(q["city"]),
+		States: splitFilterValues(q["state"]),
+		Title:  normalizeTitle(q.Get("title")),
+		Sort:   "date",
+		Cursor: q.Get("cursor"),
+		Limit:  defaultEventsLimit,
+	}
+
+	var err error
+	if eq.From, err = parseQueryDate(q.Get("from")); err != nil {
+		return eq, fmt.Errorf("from: %v", err)
+	}
+	if eq.To, err = parseQueryDate(q.Get("to")); err != nil {
+		return eq, fmt.Errorf("to: %v", err)
+	}
+	if eq.From == "" && eq.To == "" && q.Get("past") != "true" {
+		eq.From = now.Format(queryDateLayout)
+	}
+
+	if s := q.Get("sort"); s != "" {
+		eq.Desc = strings.HasPrefix(s, "-")
+		eq.Sort = strings.TrimPrefix(s, "-")
+		if _, ok := eventSortKeys[eq.Sort]; !ok {
+			return eq, fmt.Errorf("sort must be one of date, title, venue, composer, first_seen (prefix - to reverse)")
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		eq.Limit, err = strconv.Atoi(v)
+		if err != nil || eq.Limit < 1 || eq.Limit > maxEventsLimit {
+			return eq, fmt.Errorf("limit must be between 1 and %d", maxEventsLimit)
+		}
+	}
+	return eq, nil
+}
+
+// parseQueryDate accepts YYYY-MM-DD or an RFC 3339 time.
+func parseQueryDate(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(queryDateLayout, s); err == nil {
+		return t.Format(queryDateLayout), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Format(queryDateLayout), nil
+	}
+	return "", fmt.Errorf("%q is not a date (want YYYY-MM-DD)", s)
+}
+
+// Match reports whether ev passes every filter in the query.
+func (q *EventQuery) Match(ev PerformanceEvent) bool {
+	if !q.Filter.Match(ev) {
+		return false
+	}
+	if len(q.Cities) > 0 && !containsFold(q.Cities, ev.City) {
+		return false
+	}
+	if len(q.States) > 0 && !containsFold(q.States, ev.State) {
+		return false
+	}
+	if q.Title != "" && !strings.Contains(normalizeTitle(ev.Title), q.Title) {
+		return false
+	}
+	if (q.From != "" || q.To != "") && q.nextDate(ev) == "" {
+		return false
+	}
+	return true
+}
+
+// nextDate returns the earliest of ev's dates inside the query's range as a
+// sortable venue-local "YYYY-MM-DDTHH:MM", or "" if none is.
+func (q *EventQuery) nextDate(ev PerformanceEvent) string {
+	loc := eventLocation(ev)
+	next := ""
+	for _, d := range ev.Dates {
+		start, _, ok := parseOccurrence(d, loc)
+		if !ok {
+			continue
+		}
+		day := start.Format(queryDateLayout)
+		if (q.From != "" && day < q.From) || (q.To != "" && day > q.To) {
+			continue
+		}
+		if s := start.Format("2006-01-02T15:04"); next == "" || s < next {
+			next = s
+		}
+	}
+	return next
+}
+
+type sortedEvent struct {
+	ev   PerformanceEvent
+	sort string
+	key  string
+}
+
+// less orders by the sort value, then by event key so that every event has
+// a fixed position and cursors stay valid between requests.
+func (q *EventQuery) less(a, b sortedEvent) bool {
+	if a.sort != b.sort {
+		return (a.sort < b.sort) != q.Desc
+	}
+	return a.key < b.key
+}
+
+// Page filters, sorts and pages events that are already one snapshot per
+// event, as served by EventRepository.
+func (q *EventQuery) Page(events []PerformanceEvent) (EventPage, error) {
+	sortKey := eventSortKeys[q.Sort]
+	var matched []sortedEvent
+	for _, ev := range events {
+		if q.Match(ev) {
+			matched = append(matched, sortedEvent{ev: ev, sort: sortKey(ev, q), key: eventKey(ev)})
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return q.less(matched[i], matched[j]) })
+
+	start := 0
+	if q.Cursor != "" {
+		after, err := q.decodeCursor()
+		if err != nil {
+			return EventPage{}, err
+		}
+		start = sort.Search(len(matched), func(i int) bool { return q.less(after, matched[i]) })
+	}
+
+	page := EventPage{Events: []PerformanceEvent{}, Total: len(matched)}
+	end := minInt(start+q.Limit, len(matched))
+	for _, m := range matched[start:end] {
+		page.Events = append(page.Events, m.ev)
+	}
+	if end < len(matched) {
+		page.NextCursor = q.encodeCursor(matched[end-1])
+	}
+	return page, nil
+}
+
+// Cursors record the sort field and the position of the last event
+// returned, so the next page starts after it even if events were added.
+func (q *EventQuery) encodeCursor(last sortedEvent) string {
+	field := q.Sort
+	if q.Desc {
+		field = "-" + field
+	}
+	raw := strings.Join([]string{field, last.sort, last.key}, "\x00")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func (q *EventQuery) decodeCursor() (sortedEvent, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	parts := strings.Split(string(raw), "\x00")
+	if err != nil || len(parts) != 3 {
+		return sortedEvent{}, fmt.Errorf("invalid cursor")
+	}
+	field := q.Sort
+	if q.Desc {
+		field = "-" + field
+	}
+	if parts[0] != field {
+		return sortedEvent{}, fmt.Errorf("cursor was issued for sort=%s", parts[0])
+	}
+	return sortedEvent{sort: parts[1], key: parts[2]}, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func queryTestEvents() []PerformanceEvent {
+	return []PerformanceEvent{
+		{EventID: "tosca", VenueCode: "laopera", Region: "socal", Title: "Tosca", Composer: "Giacomo Puccini", VenueName: "Dorothy Chandler Pavilion", City: "Los Angeles", State: "CA", Dates: []string{"2026-09-20", "2026-11-08 7:30 PM"}, ScrapedAt: "2026-09-01T00:00:00Z"},
+		// An older snapshot of the same event is collapsed into the latest one.
+		{EventID: "tosca", VenueCode: "laopera", Region: "socal", Title: "Tosca", Dates: []string{"2026-11-08"}, ScrapedAt: "2026-08-01T00:00:00Z"},
+		{EventID: "traviata", VenueCode: "sandiegoopera", Region: "socal", Title: "La traviata", Composer: "Giuseppe Verdi", VenueName: "Civic Theatre", City: "San Diego", State: "CA", Dates: []string{"2026-10-24"}},
+		{EventID: "boheme", VenueCode: "santafeopera", Region: "nm", Title: "La bohème", Composer: "Giacomo Puccini", VenueName: "Crosby Theatre", City: "Santa Fe", State: "NM", Dates: []string{"2027-07-10"}, MatchedOperaKey: "Q187690"},
+		{EventID: "past", VenueCode: "laopera", Region: "socal", Title: "Carmen", City: "Los Angeles", State: "CA", Dates: []string{"2026-03-01"}},
+		{EventID: "undated", Region: "custom", Title: "Opera Ball"},
+	}
+}
+
+func runQuery(t *testing.T, query string) EventPage {
+	t.Helper()
+	q, _ := url.ParseQuery(query)
+	eq, err := ParseEventQuery(q, time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("%q: %v", query, err)
+	}
+	page, err := eq.Page(latestSnapshots(queryTestEvents()))
+	if err != nil {
+		t.Fatalf("%q: %v", query, err)
+	}
+	return page
+}
+
+func pageIDs(page EventPage) []string {
+	var ids []string
+	for _, ev := range page.Events {
+		ids = append(ids, ev.EventID)
+	}
+	return ids
+}
+
+func TestEventQueryFilters(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Upcoming only by default, ordered by next date.
+		{"", []string{"traviata", "tosca", "boheme"}},
+		// Leading articles are ignored when sorting by title.
+		{"past=true&sort=title", []string{"boheme", "past", "undated", "tosca", "traviata"}},
+		{"city=los angeles", []string{"tosca"}},
+		{"state=nm", []string{"boheme"}},
+		{"composer=puccini", []string{"tosca", "boheme"}},
+		{"title=travi", []string{"traviata"}},
+		{"title=boheme", []string{"boheme"}},
+		{"opera=Q187690", []string{"boheme"}},
+		{"venue=laopera&from=2026-01-01", []string{"past", "tosca"}},
+		{"from=2026-09-01&to=2026-10-31", []string{"tosca", "traviata"}},
+		{"sort=-date", []string{"boheme", "tosca", "traviata"}},
+		{"sort=venue", []string{"traviata", "boheme", "tosca"}},
+	}
+
+	for _, tt := range tests {
+		got := pageIDs(runQuery(t, tt.query))
+		if len(got) != len(tt.want) {
+			t.Errorf("%q = %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q = %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestEventQueryPastIncludesUndated(t *testing.T) {
+	page := runQuery(t, "past=true")
+	if page.Total != 5 {
+		t.Errorf("past=true total = %d, want 5 (every event, snapshots collapsed)", page.Total)
+	}
+}
+
+func TestEventQueryPagination(t *testing.T) {
+	var got []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		query := "past=true&sort=title&limit=2"
+		if cursor != "" {
+			query += "&cursor=" + cursor
+		}
+		page := runQuery(t, query)
+		if page.Total != 5 {
+			t.Errorf("total = %d, want 5", page.Total)
+		}
+		got = append(got, pageIDs(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := []string{"boheme", "past", "undated", "tosca", "traviata"}
+	if len(got) != len(want) {
+		t.Fatalf("paged through %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("paged through %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEventQueryErrors(t *testing.T) {
+	for _, query := range []string{"from=tomorrow", "sort=price", "limit=0", "limit=100000"} {
+		q, _ := url.ParseQuery(query)
+		if _, err := ParseEventQuery(q, time.Now()); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+
+	q, _ := url.ParseQuery("sort=title&limit=1")
+	eq, _ := ParseEventQuery(q, time.Now())
+	eq.Cursor = "not-a-cursor"
+	if _, err := eq.Page(latestSnapshots(queryTestEvents())); err == nil {
+		t.Error("invalid cursor: expected an error")
+	}
+
+	page := runQuery(t, "sort=title&limit=1")
+	q, _ = url.ParseQuery("sort=-title&cursor=" + page.NextCursor)
+	eq, _ = ParseEventQuery(q, time.Now())
+	if _, err := eq.Page(latestSnapshots(queryTestEvents())); err == nil {
+		t.Error("cursor from another sort order: expected an error")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig is server.rate_limit in config.yaml. Zero values take the
+// defaults below.
+type RateLimitConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	RequestsPerMinute int  `yaml:"requests_per_minute"`
+	Burst             int  `yaml:"burst"`
+	// Scrapes, venue tests and logins, which cost far more than a read.
+	ScrapesPerMinute int `yaml:"scrapes_per_minute"`
+	ScrapeBurst      int `yaml:"scrape_burst"`
+	// Pages the shared browser has open at once, and how many more
+	// requests may wait for one before getting 429.
+	BrowserPages int `yaml:"browser_pages"`
+	BrowserQueue int `yaml:"browser_queue"`
+	// Take the client address from X-Forwarded-For, when behind a proxy.
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers"`
+}
+
+const (
+	defaultRequestsPerMinute = 300
+	defaultBurst             = 60
+	defaultScrapesPerMinute  = 6
+	defaultScrapeBurst       = 3
+	defaultBrowserPages      = 2
+	defaultBrowserQueue      = 4
+	// What to tell clients turned away by a full browser queue.
+	browserRetryAfter = 30 * time.Second
+)
+
+func orDefault(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// RateLimiter is a token bucket per client: each holds up to burst
+// requests and refills at perMinute.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	return &RateLimiter{rate: float64(perMinute) / 60, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket, or returns how long until there
+// will be one.
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled, at most once a minute, so idle
+// clients do not pile up.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// apiLimits are the limiters in force, replaced whole when the config
+// changes.
+type apiLimits struct {
+	enabled    bool
+	trustProxy bool
+	requests   *RateLimiter
+	scrapes    *RateLimiter
+}
+
+func newAPILimits(c RateLimitConfig) *apiLimits {
+	return &apiLimits{
+		enabled:    c.Enabled,
+		trustProxy: c.TrustProxyHeaders,
+		requests:   NewRateLimiter(orDefault(c.RequestsPerMinute, defaultRequestsPerMinute), orDefault(c.Burst, defaultBurst)),
+		scrapes:    NewRateLimiter(orDefault(c.ScrapesPerMinute, defaultScrapesPerMinute), orDefault(c.ScrapeBurst, defaultScrapeBurst)),
+	}
+}
+
+// scrapeRequest reports whether r starts browser or scrape work, or tries
+// a password, and so counts against the stricter limit.
+func scrapeRequest(r *http.Request) bool {
+	if r.Method != "POST" {
+		return false
+	}
+	p := r.URL.Path
+	return p == "/api/scrape" || p == "/api/scrape-url" || p == "/api/auth/login" ||
+		strings.HasPrefix(p, "/api/venues/") && strings.HasSuffix(p, "/test") ||
+		strings.HasPrefix(p, "/api/sources/") && strings.HasSuffix(p, "/scrape")
+}
+
+// clientKey identifies who a request counts against: the API token if it
+// carries a valid one, else the client's address.
+func (s *Server) clientKey(r *http.Request, trustProxy bool) string {
+	if token := bearerToken(r); token != "" && s.auth.Identify(r).Role != RolePublic {
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:8])
+	}
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			// The last address is the one our proxy saw.
+			parts := strings.Split(fwd, ",")
+			return "ip:" + strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit turns away API requests from clients over their limit with
+// 429 and a Retry-After header.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.limitMu.RLock()
+		limits := s.limits
+		s.limitMu.RUnlock()
+		if !limits.enabled || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := s.clientKey(r, limits.trustProxy)
+		now := time.Now()
+		ok, wait := limits.requests.Allow(key, now)
+		if ok && scrapeRequest(r) {
+			ok, wait = limits.scrapes.Allow(key, now)
+		}
+		if !ok {
+			tooManyRequests(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many requests", 429)
+}
+
+var errBrowserBusy = errors.New("browser is busy")
+
+// BrowserQueue limits how many pages the shared browser has open at once
+// and how many requests may wait for one, so that no client can tie it up.
+type BrowserQueue struct {
+	slots   chan struct{}
+	mu      sync.Mutex
+	queued  int // holding or waiting for a slot
+	maxWait int
+}
+
+func NewBrowserQueue(pages, maxWait int) *BrowserQueue {
+	return &BrowserQueue{slots: make(chan struct{}, pages), maxWait: maxWait}
+}
+
+// BrowserTicket is a place in the queue.
+type BrowserTicket struct {
+	q       *BrowserQueue
+	holding bool
+	done    bool
+}
+
+// Join takes a place in the queue, or fails with errBrowserBusy if it is
+// full. Call Done on the ticket when finished.
+func (q *BrowserQueue) Join() (*BrowserTicket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queued >= cap(q.slots)+q.maxWait {
+		return nil, errBrowserBusy
+	}
+	q.queued++
+	return &BrowserTicket{q: q}, nil
+}
+
+// Wait blocks until the ticket holds a page slot or ctx ends.
+func (t *BrowserTicket) Wait(ctx context.Context) error {
+	select {
+	case t.q.slots <- struct{}{}:
+		t.holding = true
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done gives back the ticket's slot, if it holds one, and its place.
+func (t *BrowserTicket) Done() {
+	if t.done {
+		return
+	}
+	t.done = true
+	if t.holding {
+		<-t.q.slots
+	}
+	t.q.mu.Lock()
+	t.q.queued--
+	t.q.mu.Unlock()
+}
+
+// Depth returns how many requests hold or wait for a page.
+func (q *BrowserQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued
+}
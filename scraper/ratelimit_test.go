@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(60, 2) // one a second
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a", now); !ok {
+			t.Fatalf("request %d within burst refused", i)
+		}
+	}
+	ok, wait := l.Allow("a", now)
+	if ok || wait != time.Second {
+		t.Errorf("over burst: %v, wait %v; want refused, 1s", ok, wait)
+	}
+	if ok, _ := l.Allow("b", now); !ok {
+		t.Error("other client limited")
+	}
+	if ok, _ := l.Allow("a", now.Add(1500*time.Millisecond)); !ok {
+		t.Error("not refilled")
+	}
+
+	l.Allow("a", now.Add(2*time.Hour))
+	if len(l.buckets) != 1 {
+		t.Errorf("idle buckets kept: %d", len(l.buckets))
+	}
+}
+
+func TestBrowserQueue(t *testing.T) {
+	q := NewBrowserQueue(1, 1)
+	first, err := q.Join()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.Join()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Join(); err != errBrowserBusy {
+		t.Errorf("third Join: %v, want errBrowserBusy", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := second.Wait(ctx); err == nil {
+		t.Error("second got the only page")
+	}
+	second.Done()
+	first.Done()
+	first.Done() // twice is harmless
+	if q.Depth() != 0 {
+		t.Errorf("depth = %d after all done", q.Depth())
+	}
+	third, _ := q.Join()
+	if err := third.Wait(context.Background()); err != nil {
+		t.Errorf("page not given back: %v", err)
+	}
+	third.Done()
+}
+
+func TestHandlerRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configPath, []byte(testConfigYAML), 0644)
+	s := NewServer(configPath, dir, "")
+	var cfg Config
+	cfg.Server.RateLimit = RateLimitConfig{Enabled: true, RequestsPerMinute: 60, Burst: 5, ScrapesPerMinute: 1, ScrapeBurst: 2}
+	s.applyConfig(cfg)
+	handler := s.Handler()
+	do := func(method, path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := do("POST", "/api/scrape-url", "192.0.2.1:1234"); rec.Code == 429 {
+			t.Fatalf("scrape %d limited", i)
+		}
+	}
+	rec := do("POST", "/api/scrape-url", "192.0.2.1:1235")
+	if rec.Code != 429 {
+		t.Fatalf("third scrape: %d, want 429", rec.Code)
+	}
+	if after, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || after < 1 || after > 60 {
+		t.Errorf("Retry-After = %q", rec.Header().Get("Retry-After"))
+	}
+	if rec := do("GET", "/api/events", "192.0.2.1:1236"); rec.Code != 200 {
+		t.Errorf("read after scrape limit: %d", rec.Code)
+	}
+	if rec := do("POST", "/api/scrape-url", "192.0.2.2:1234"); rec.Code == 429 {
+		t.Error("other client limited")
+	}
+	for i := 0; i < 3; i++ {
+		do("GET", "/api/events", "192.0.2.1:1236")
+	}
+	if rec := do("GET", "/api/events", "192.0.2.1:1236"); rec.Code != 429 {
+		t.Errorf("reads over burst: %d, want 429", rec.Code)
+	}
+}
+
+func TestHandleScrapeURLBrowserBusy(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configPath, []byte(testConfigYAML), 0644)
+	s := NewServer(configPath, dir, "")
+	s.browser = &BrowserManager{} // never used: the queue is full
+	s.browserQueue = NewBrowserQueue(1, 0)
+	held, _ := s.browserQueue.Join()
+	defer held.Done()
+
+	rec := httptest.NewRecorder()
+	s.handleScrapeURL(rec, httptest.NewRequest("POST", "/api/scrape-url", strings.NewReader(`{"url": "http://93.184.216.34/"}`)))
+	if rec.Code != 429 || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("busy browser: %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
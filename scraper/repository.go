@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// refreshDebounce groups the burst of file events a scrape produces into
+// one refresh.
+const refreshDebounce = 500 * time.Millisecond
+
+// eventFile is one stored event file as last read.
+type eventFile struct {
+	modTime time.Time
+	size    int64
+	events  []PerformanceEvent
+}
+
+// EventRepository keeps the server's stored events in memory, indexed for
+// the common filters, so requests no longer re-read every file. Refresh
+// re-reads only files that changed since the last load.
+type EventRepository struct {
+	dataDir string
+
+	refreshMu sync.Mutex // serialises Refresh
+	files     map[string]eventFile
+
+	mu           sync.RWMutex
+	events       []PerformanceEvent // latest snapshot of each event
+	byKey        map[string]int
+	byRegion     map[string][]int
+	byVenue      map[string][]int
+	byProduction map[string][]int
+	history      map[string][]EventSnapshot // every snapshot, by event key
+	version      uint64
+}
+
+func NewEventRepository(dataDir string) *EventRepository {
+	return &EventRepository{dataDir: dataDir, files: make(map[string]eventFile)}
+}
+
+// eventDirs returns the directories holding event files, with the region
+// their events default to.
+func (repo *EventRepository) eventDirs() map[string]string {
+	dirs := make(map[string]string)
+	regionalDir := filepath.Join(repo.dataDir, "data", "raw", "regional")
+	if regions, err := os.ReadDir(regionalDir); err == nil {
+		for _, r := range regions {
+			if r.IsDir() {
+				dirs[filepath.Join(regionalDir, r.Name())] = r.Name()
+			}
+		}
+	}
+	dirs[filepath.Join(repo.dataDir, "data", "raw", "custom")] = "custom"
+	return dirs
+}
+
+// Refresh re-reads changed, new and deleted event files and rebuilds the
+// indexes if anything changed.
+func (repo *EventRepository) Refresh() {
+	repo.refreshMu.Lock()
+	defer repo.refreshMu.Unlock()
+
+	changed := false
+	seen := make(map[string]bool)
+	for dir, region := range repo.eventDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || entry.Name() == "sources.json" || !strings.HasSuffix(entry.Name(), ".json") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			seen[path] = true
+			if old, ok := repo.files[path]; ok && old.modTime.Equal(info.ModTime()) && old.size == info.Size() {
+				continue
+			}
+			events, err := readEventFile(path, region)
+			if err != nil {
+				log.Printf("Skipping %s: %v", path, err)
+			}
+			repo.files[path] = eventFile{modTime: info.ModTime(), size: info.Size(), events: events}
+			changed = true
+		}
+	}
+	for path := range repo.files {
+		if !seen[path] {
+			delete(repo.files, path)
+			changed = true
+		}
+	}
+
+	if changed || repo.version == 0 {
+		repo.rebuild()
+	}
+}
+
+// rebuild collapses all loaded files into the latest snapshot of each event
+// and re-indexes them. Paths are visited in order so the result does not
+// depend on map iteration.
+func (repo *EventRepository) rebuild() {
+	paths := make([]string, 0, len(repo.files))
+	for path := range repo.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	rawDir := filepath.Join(repo.dataDir, "data", "raw")
+	var all []PerformanceEvent
+	history := make(map[string][]EventSnapshot)
+	for _, path := range paths {
+		rel, err := filepath.Rel(rawDir, path)
+		if err != nil {
+			rel = path
+		}
+		for _, ev := range repo.files[path].events {
+			all = append(all, ev)
+			key := eventKey(ev)
+			history[key] = append(history[key], EventSnapshot{
+				Event:     key,
+				File:      filepath.ToSlash(rel),
+				ScrapedAt: ev.ScrapedAt,
+				Title:     ev.Title,
+				Dates:     ev.Dates,
+				SourceURL: ev.SourceURL,
+			})
+		}
+	}
+	for _, h := range history {
+		sortSnapshots(h)
+	}
+
+	events := latestSnapshots(all)
+	byKey := make(map[string]int, len(events))
+	byRegion := make(map[string][]int)
+	byVenue := make(map[string][]int)
+	byProduction := make(map[string][]int)
+	for i, ev := range events {
+		byKey[eventKey(ev)] = i
+		byRegion[strings.ToLower(ev.Region)] = append(byRegion[strings.ToLower(ev.Region)], i)
+		byVenue[strings.ToLower(ev.VenueCode)] = append(byVenue[strings.ToLower(ev.VenueCode)], i)
+		byProduction[productionKey(ev)] = append(byProduction[productionKey(ev)], i)
+	}
+
+	repo.mu.Lock()
+	repo.events = events
+	repo.byKey = byKey
+	repo.byRegion = byRegion
+	repo.byVenue = byVenue
+	repo.byProduction = byProduction
+	repo.history = history
+	repo.version++
+	repo.mu.Unlock()
+	log.Printf("Event repository: %d events from %d files", len(events), len(paths))
+}
+
+// readEventFile reads one stored event file, defaulting each event's region
+// and, for custom sources' files, its source.
+func readEventFile(path, region string) ([]PerformanceEvent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var events []PerformanceEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	source := ""
+	if region == "custom" {
+		source = fileSourceID(path)
+	}
+	for i := range events {
+		if events[i].Region == "" {
+			events[i].Region = region
+		}
+		if events[i].SourceID == "" && events[i].VenueCode == "" {
+			events[i].SourceID = source
+		}
+	}
+	return events, nil
+}
+
+// fileSourceIDRe matches the "<source ID>_<YYYYMMDD>_<HHMMSS>.json" names
+// custom sources' event files are saved under. Files saved before sources
+// had IDs are named after their label instead and get no source.
+var fileSourceIDRe = regexp.MustCompile(`^([0-9a-f]{12})_\d{8}_\d{6}\.json$`)
+
+func fileSourceID(path string) string {
+	if m := fileSourceIDRe.FindStringSubmatch(filepath.Base(path)); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Select returns the events passing filter, using the venue or region
+// index to avoid scanning everything.
+func (repo *EventRepository) Select(filter EventFilter) []PerformanceEvent {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var candidates []int
+	switch {
+	case len(filter.Venues) > 0:
+		candidates = indexLookup(repo.byVenue, filter.Venues)
+	case len(filter.Regions) > 0:
+		candidates = indexLookup(repo.byRegion, filter.Regions)
+	default:
+		out := make([]PerformanceEvent, 0, len(repo.events))
+		for _, ev := range repo.events {
+			if filter.Match(ev) {
+				out = append(out, ev)
+			}
+		}
+		return out
+	}
+
+	out := make([]PerformanceEvent, 0, len(candidates))
+	for _, i := range candidates {
+		if filter.Match(repo.events[i]) {
+			out = append(out, repo.events[i])
+		}
+	}
+	return out
+}
+
+// Event returns the latest snapshot of the event with the given key, as
+// built by eventKey, with its scrape history.
+func (repo *EventRepository) Event(id string) (EventDetail, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	i, ok := repo.byKey[id]
+	if !ok {
+		return EventDetail{}, false
+	}
+	ev := repo.events[i]
+	return EventDetail{
+		PerformanceEvent: ev,
+		ID:               id,
+		ProductionID:     productionKey(ev),
+		History:          repo.history[id],
+	}, true
+}
+
+// Production returns the production with the given key, as built by
+// productionKey, aggregated from its events.
+func (repo *EventRepository) Production(id string) (Production, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	indexes, ok := repo.byProduction[id]
+	if !ok {
+		return Production{}, false
+	}
+	events := make([]PerformanceEvent, len(indexes))
+	var history []EventSnapshot
+	for n, i := range indexes {
+		events[n] = repo.events[i]
+		history = append(history, repo.history[eventKey(repo.events[i])]...)
+	}
+	sortSnapshots(history)
+	return newProduction(id, events, history), true
+}
+
+func indexLookup(index map[string][]int, values []string) []int {
+	var out []int
+	for _, v := range values {
+		out = append(out, index[strings.ToLower(v)]...)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// Version changes whenever the stored events do.
+func (repo *EventRepository) Version() uint64 {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	return repo.version
+}
+
+// ETag identifies a response built from the repository's current events for
+// the given request parts (path, query, the date "upcoming" is relative to).
+func (repo *EventRepository) ETag(parts ...string) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d", repo.Version())
+	for _, p := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum64())
+}
+
+// Watch refreshes the repository whenever event files change, until stop is
+// closed. New region directories are watched as they appear.
+func (repo *EventRepository) Watch(stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	regionalDir := filepath.Join(repo.dataDir, "data", "raw", "regional")
+	for _, dir := range []string{regionalDir, filepath.Join(repo.dataDir, "data", "raw", "custom")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := watcher.Add(regionalDir); err != nil {
+		return err
+	}
+	for dir := range repo.eventDirs() {
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("Not watching %s: %v", dir, err)
+		}
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Dir(ev.Name) == regionalDir && ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					watcher.Add(ev.Name)
+				}
+			}
+			if debounce == nil {
+				debounce = time.After(refreshDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Event watcher: %v", err)
+		case <-debounce:
+			debounce = nil
+			repo.Refresh()
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeEventFile(t *testing.T, dataDir, rel string, events []PerformanceEvent) {
+	t.Helper()
+	path := filepath.Join(dataDir, "data", "raw", rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(events)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventRepositoryRefresh(t *testing.T) {
+	dataDir := t.TempDir()
+	writeEventFile(t, dataDir, "regional/socal/laopera_20260901.json", []PerformanceEvent{
+		{EventID: "tosca", VenueCode: "laopera", Title: "Tosca", ScrapedAt: "2026-09-01T00:00:00Z"},
+	})
+	writeEventFile(t, dataDir, "regional/nm/santafeopera_20260901.json", []PerformanceEvent{
+		{EventID: "boheme", VenueCode: "santafeopera", Title: "La bohème"},
+	})
+
+	repo := NewEventRepository(dataDir)
+	repo.Refresh()
+	if got := repo.Select(EventFilter{}); len(got) != 2 {
+		t.Fatalf("loaded %d events, want 2", len(got))
+	}
+	v := repo.Version()
+
+	repo.Refresh()
+	if repo.Version() != v {
+		t.Error("refresh without changes rebuilt the repository")
+	}
+
+	// A newer snapshot of the same event replaces it rather than adding one.
+	writeEventFile(t, dataDir, "regional/socal/laopera_20260902.json", []PerformanceEvent{
+		{EventID: "tosca", VenueCode: "laopera", Title: "Tosca (new cast)", ScrapedAt: "2026-09-02T00:00:00Z"},
+	})
+	repo.Refresh()
+	got := repo.Select(EventFilter{Venues: []string{"laopera"}})
+	if len(got) != 1 || got[0].Title != "Tosca (new cast)" || got[0].Region != "socal" {
+		t.Errorf("laopera events = %+v", got)
+	}
+	if repo.Version() == v {
+		t.Error("version did not change after a new file")
+	}
+
+	os.Remove(filepath.Join(dataDir, "data", "raw", "regional", "nm", "santafeopera_20260901.json"))
+	repo.Refresh()
+	if got := repo.Select(EventFilter{Regions: []string{"nm"}}); len(got) != 0 {
+		t.Errorf("deleted file's events still served: %+v", got)
+	}
+}
+
+func TestEventRepositoryWatch(t *testing.T) {
+	dataDir := t.TempDir()
+	repo := NewEventRepository(dataDir)
+	repo.Refresh()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	watching := make(chan error, 1)
+	go func() { watching <- repo.Watch(stop) }()
+	// Give the watcher time to register its directories.
+	time.Sleep(100 * time.Millisecond)
+
+	writeEventFile(t, dataDir, "regional/atl/atlantaopera_20260901.json", []PerformanceEvent{
+		{EventID: "carmen", VenueCode: "atlantaopera", Title: "Carmen"},
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(repo.Select(EventFilter{Regions: []string{"atl"}})) == 0 {
+		select {
+		case err := <-watching:
+			t.Fatalf("watcher stopped: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not pick up the new region's events")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestHandleEventsETag(t *testing.T) {
+	dataDir := t.TempDir()
+	writeEventFile(t, dataDir, "regional/socal/laopera.json", []PerformanceEvent{
+		{EventID: "tosca", VenueCode: "laopera", Title: "Tosca", Dates: []string{"2099-01-01"}},
+	})
+	s := NewServer("", dataDir, "")
+	s.events.Refresh()
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/events?region=socal", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		s.handleEvents(rec, req)
+		return rec
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first response: %d, etag %q", first.Code, etag)
+	}
+	var page EventPage
+	if err := json.Unmarshal(first.Body.Bytes(), &page); err != nil || page.Total != 1 {
+		t.Fatalf("page = %+v, %v", page, err)
+	}
+
+	if rec := get(etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("matching If-None-Match: %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+
+	writeEventFile(t, dataDir, "regional/socal/sandiegoopera.json", []PerformanceEvent{
+		{EventID: "traviata", VenueCode: "sandiegoopera", Title: "La traviata", Dates: []string{"2099-02-01"}},
+	})
+	s.events.Refresh()
+	if rec := get(etag); rec.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match after new events: %d", rec.Code)
+	}
+}
+
+func TestEventRepositoryKeepsEachDate(t *testing.T) {
+	dataDir := t.TempDir()
+	// ParseLAOpera stores one event per night, without event IDs.
+	for _, day := range []string{"01", "02"} {
+		writeEventFile(t, dataDir, "regional/socal/laopera_202609"+day+".json", []PerformanceEvent{
+			{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-08 7:30 PM"}, ScrapedAt: "2026-09-" + day + "T00:00:00Z"},
+			{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-12 7:30 PM"}, ScrapedAt: "2026-09-" + day + "T00:00:00Z"},
+		})
+	}
+	// The same generic-parser event ID from two custom sources.
+	writeEventFile(t, dataDir, "custom/aaaaaaaaaaaa_20260901_100000.json", []PerformanceEvent{
+		{EventID: "ld_tosca_2026_11_08", Title: "Tosca", Dates: []string{"2026-11-08"}, SourceURL: "https://a.example/tosca"},
+	})
+	writeEventFile(t, dataDir, "custom/bbbbbbbbbbbb_20260901_100000.json", []PerformanceEvent{
+		{EventID: "ld_tosca_2026_11_08", Title: "Tosca", Dates: []string{"2026-11-08"}, SourceURL: "https://b.example/tosca"},
+	})
+
+	repo := NewEventRepository(dataDir)
+	repo.Refresh()
+	if got := repo.Select(EventFilter{Venues: []string{"laopera"}}); len(got) != 2 {
+		t.Errorf("laopera events = %+v, want one per night", got)
+	}
+	if got := repo.Select(EventFilter{Regions: []string{"custom"}}); len(got) != 2 {
+		t.Errorf("custom events = %+v, want one per source", got)
+	}
+
+	detail, ok := repo.Event("laopera:la_boh_me_2026_11_12_7_30_pm")
+	if !ok {
+		t.Fatal("second night not found")
+	}
+	if len(detail.History) != 2 {
+		t.Fatalf("history = %+v, want the night's two snapshots", detail.History)
+	}
+	for _, snap := range detail.History {
+		if len(snap.Dates) != 1 || snap.Dates[0] != "2026-11-12 7:30 PM" {
+			t.Errorf("history mixes in another night: %+v", snap)
+		}
+	}
+	if detail, ok := repo.Event("source-bbbbbbbbbbbb:ld_tosca_2026_11_08"); !ok || detail.SourceURL != "https://b.example/tosca" {
+		t.Errorf("custom event = %+v, %v", detail, ok)
+	}
+
+	s := NewServer("", dataDir, "")
+	s.events.Refresh()
+	rec := httptest.NewRecorder()
+	s.handleEventsICS(rec, httptest.NewRequest("GET", "/api/events.ics?venue=laopera", nil))
+	if n := strings.Count(rec.Body.String(), "BEGIN:VEVENT"); rec.Code != 200 || n != 2 {
+		t.Errorf("events.ics: %d with %d events, want 200 with 2", rec.Code, n)
+	}
+}
+
+func TestEventRepositoryProduction(t *testing.T) {
+	dataDir := t.TempDir()
+	writeEventFile(t, dataDir, "regional/socal/laopera_20260901.json", []PerformanceEvent{
+		{EventID: "tosca-1", VenueCode: "laopera", Title: "Tosca", Dates: []string{"2026-11-08T14:00"}, SourceURL: "https://laopera.org/tosca", ScrapedAt: "2026-09-01T00:00:00Z", State: "CA"},
+	})
+	writeEventFile(t, dataDir, "regional/socal/laopera_20260902.json", []PerformanceEvent{
+		{EventID: "tosca-1", VenueCode: "laopera", Title: "Tosca", Dates: []string{"2026-11-08T14:00", "2026-11-01T19:30"}, SourceURL: "https://laopera.org/tosca", ScrapedAt: "2026-09-02T00:00:00Z", State: "CA"},
+		{EventID: "tosca-gala", VenueCode: "laopera", Title: "Tosca – Opening Night Gala", Dates: []string{"2026-10-30T19:00"}, SourceURL: "https://laopera.org/gala", ScrapedAt: "2026-09-02T00:00:00Z", State: "CA"},
+		{EventID: "carmen", VenueCode: "laopera", Title: "Carmen", ScrapedAt: "2026-09-02T00:00:00Z"},
+	})
+	repo := NewEventRepository(dataDir)
+	repo.Refresh()
+
+	detail, ok := repo.Event("laopera:tosca-1")
+	if !ok {
+		t.Fatal("event laopera:tosca-1 not found")
+	}
+	if len(detail.Dates) != 2 || detail.ProductionID != "laopera:tosca" {
+		t.Errorf("detail = %+v", detail)
+	}
+	if len(detail.History) != 2 || detail.History[0].File != "regional/socal/laopera_20260901.json" || len(detail.History[0].Dates) != 1 {
+		t.Errorf("history = %+v", detail.History)
+	}
+	if _, ok := repo.Event("laopera:nope"); ok {
+		t.Error("found a missing event")
+	}
+
+	p, ok := repo.Production("laopera:tosca")
+	if !ok {
+		t.Fatal("production laopera:tosca not found")
+	}
+	if p.Title != "Tosca" || len(p.Events) != 2 || len(p.History) != 3 {
+		t.Errorf("production = %+v", p)
+	}
+	wantDates := []string{"2026-10-30T19:00", "2026-11-01T19:30", "2026-11-08T14:00"}
+	if strings.Join(p.Dates, ",") != strings.Join(wantDates, ",") {
+		t.Errorf("dates = %v, want %v", p.Dates, wantDates)
+	}
+	if strings.Join(p.SourceURLs, ",") != "https://laopera.org/gala,https://laopera.org/tosca" {
+		t.Errorf("source urls = %v", p.SourceURLs)
+	}
+}
+
+func TestEventRepositoryProductionWithoutEventIDs(t *testing.T) {
+	dataDir := t.TempDir()
+	writeEventFile(t, dataDir, "regional/socal/laopera_20260901.json", []PerformanceEvent{
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-12 7:30 PM"}, State: "CA", SourceURL: "https://laopera.org/boheme", ScrapedAt: "2026-09-01T00:00:00Z"},
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-08 7:30 PM"}, State: "CA", SourceURL: "https://laopera.org/boheme", ScrapedAt: "2026-09-01T00:00:00Z"},
+		{VenueCode: "laopera", Title: "La Bohème", Dates: []string{"2026-11-15 2:00 PM"}, State: "CA", SourceURL: "https://laopera.org/boheme", ScrapedAt: "2026-09-01T00:00:00Z"},
+	})
+	repo := NewEventRepository(dataDir)
+	repo.Refresh()
+
+	p, ok := repo.Production("laopera:boheme")
+	if !ok {
+		t.Fatal("production laopera:boheme not found")
+	}
+	if len(p.Events) != 3 || len(p.History) != 3 {
+		t.Errorf("production has %d events and %d snapshots, want 3 of each", len(p.Events), len(p.History))
+	}
+	wantDates := []string{"2026-11-08 7:30 PM", "2026-11-12 7:30 PM", "2026-11-15 2:00 PM"}
+	if strings.Join(p.Dates, ",") != strings.Join(wantDates, ",") {
+		t.Errorf("dates = %v, want %v", p.Dates, wantDates)
+	}
+}
+
+func TestHandleEventAndProduction(t *testing.T) {
+	dataDir := t.TempDir()
+	writeEventFile(t, dataDir, "regional/socal/laopera.json", []PerformanceEvent{
+		{EventID: "a/b", VenueCode: "laopera", Title: "Tosca", MatchedOperaKey: "Q213593"},
+	})
+	graph := `{"nodes": [{"key": "Q213593", "attributes": {"label": "Tosca", "type": "opera"}}], "edges": []}`
+	os.MkdirAll(filepath.Join(dataDir, "data", "processed"), 0755)
+	os.WriteFile(graphPath(dataDir), []byte(graph), 0644)
+
+	s := NewServer("", dataDir, "")
+	s.events.Refresh()
+
+	rec := httptest.NewRecorder()
+	s.handleEvent(rec, httptest.NewRequest("GET", "/api/events/laopera:a%2Fb", nil))
+	var detail EventDetail
+	if err := json.Unmarshal(rec.Body.Bytes(), &detail); rec.Code != 200 || err != nil {
+		t.Fatalf("event: %d %s", rec.Code, rec.Body)
+	}
+	if detail.ID != "laopera:a/b" || detail.Title != "Tosca" || detail.ProductionID != "laopera:Q213593" {
+		t.Errorf("detail = %+v", detail)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleProduction(rec, httptest.NewRequest("GET", "/api/productions/"+detail.ProductionID, nil))
+	var p Production
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); rec.Code != 200 || err != nil {
+		t.Fatalf("production: %d %s", rec.Code, rec.Body)
+	}
+	if p.Opera == nil || p.Opera.Attributes.Label != "Tosca" {
+		t.Errorf("production opera = %+v", p.Opera)
+	}
+
+	for _, path := range []string{"/api/events/laopera:missing", "/api/events/", "/api/productions/laopera:missing"} {
+		rec = httptest.NewRecorder()
+		if strings.HasPrefix(path, "/api/events/") {
+			s.handleEvent(rec, httptest.NewRequest("GET", path, nil))
+		} else {
+			s.handleProduction(rec, httptest.NewRequest("GET", path, nil))
+		}
+		if rec.Code != 404 {
+			t.Errorf("%s: %d, want 404", path, rec.Code)
+		}
+	}
+}
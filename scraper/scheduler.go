@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// SchedulerConfig controls scheduled scrapes in --server mode. The
+// schedules themselves are cron expressions on regions and venues.
+type SchedulerConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Timezone cron expressions and quiet hours are read in, e.g.
+	// "America/Los_Angeles"; the server's local time zone if empty.
+	Timezone string `yaml:"timezone,omitempty"`
+	// Each run starts up to this many minutes after its scheduled time, so
+	// venues are not all hit on the hour.
+	JitterMinutes int `yaml:"jitter_minutes,omitempty"`
+	// Runs falling between start and end ("HH:MM", may wrap midnight) are
+	// moved to the end of the quiet hours.
+	QuietHours struct {
+		Start string `yaml:"start,omitempty"`
+		End   string `yaml:"end,omitempty"`
+	} `yaml:"quiet_hours,omitempty"`
+}
+
+// ScheduleEntry is one cron schedule and what it last did.
+type ScheduleEntry struct {
+	Name       string   `json:"name"` // "region:<code>", "venue:<code>" or "source:<id>"
+	Cron       string   `json:"cron"`
+	Regions    []string `json:"regions,omitempty"`
+	Venues     []string `json:"venues,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	NextRun    string   `json:"next_run,omitempty"`
+	LastRun    string   `json:"last_run,omitempty"`
+	LastJob    string   `json:"last_job,omitempty"`
+	LastResult string   `json:"last_result,omitempty"`
+
+	schedule cron.Schedule
+	next     time.Time
+}
+
+// SchedulerStatus is the scheduler's part of /api/status.
+type SchedulerStatus struct {
+	Enabled  bool            `json:"enabled"`
+	Timezone string          `json:"timezone"`
+	Entries  []ScheduleEntry `json:"entries"`
+}
+
+// quietHours is a daily window, in minutes after midnight, that may wrap
+// past midnight.
+type quietHours struct {
+	start, end int
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day (want HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (q quietHours) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if q.start <= q.end {
+		return m >= q.start && m < q.end
+	}
+	return m >= q.start || m < q.end
+}
+
+// after returns t, or the end of the quiet hours t falls in.
+func (q quietHours) after(t time.Time) time.Time {
+	if !q.contains(t) {
+		return t
+	}
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.end/60, q.end%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// checkSchedule returns an error if expr is neither empty nor a cron
+// expression the scheduler accepts.
+func checkSchedule(expr string) error {
+	if expr == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(expr); err != nil {
+		return fmt.Errorf("schedule %q: %v", expr, err)
+	}
+	return nil
+}
+
+// Scheduler starts scrape jobs on the cron schedules of regions, venues and
+// custom sources.
+type Scheduler struct {
+	mu      sync.Mutex
+	enabled bool
+	loc     *time.Location
+	jitter  time.Duration
+	quiet   *quietHours
+	entries []*ScheduleEntry // from config.yaml
+	sources []*ScheduleEntry // from custom sources
+
+	start func(req ScrapeRequest) (Job, error)
+	wake  chan struct{}
+}
+
+// NewScheduler returns a scheduler that runs due schedules with start.
+// It does nothing until configured.
+func NewScheduler(start func(req ScrapeRequest) (Job, error)) *Scheduler {
+	return &Scheduler{loc: time.Local, start: start, wake: make(chan struct{}, 1)}
+}
+
+// parseSchedules validates the scheduler settings and every region and
+// venue schedule in cfg.
+func parseSchedules(cfg Config) (loc *time.Location, quiet *quietHours, entries []*ScheduleEntry, err error) {
+	sc := cfg.Scheduler
+	loc = time.Local
+	if sc.Timezone != "" {
+		if loc, err = time.LoadLocation(sc.Timezone); err != nil {
+			return nil, nil, nil, fmt.Errorf("scheduler.timezone: %v", err)
+		}
+	}
+	if sc.JitterMinutes < 0 {
+		return nil, nil, nil, errors.New("scheduler.jitter_minutes must not be negative")
+	}
+	if sc.QuietHours.Start != "" || sc.QuietHours.End != "" {
+		q := &quietHours{}
+		if q.start, err = parseClock(sc.QuietHours.Start); err != nil {
+			return nil, nil, nil, fmt.Errorf("scheduler.quiet_hours.start: %v", err)
+		}
+		if q.end, err = parseClock(sc.QuietHours.End); err != nil {
+			return nil, nil, nil, fmt.Errorf("scheduler.quiet_hours.end: %v", err)
+		}
+		if q.start != q.end {
+			quiet = q
+		}
+	}
+
+	add := func(name, expr string, req ScrapeRequest) error {
+		schedule, err := cron.ParseStandard(expr)
+		if err != nil {
+			return fmt.Errorf("%s schedule %q: %v", name, expr, err)
+		}
+		entries = append(entries, &ScheduleEntry{Name: name, Cron: expr, Regions: req.Regions, Venues: req.Venues, schedule: schedule})
+		return nil
+	}
+	for _, region := range cfg.RegionalVenues.Regions {
+		if region.Schedule != "" {
+			if err := add("region:"+region.Code, region.Schedule, ScrapeRequest{Regions: []string{region.Code}}); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		for _, venue := range region.Venues {
+			if venue.Schedule != "" {
+				if err := add("venue:"+venue.Code, venue.Schedule, ScrapeRequest{Venues: []string{venue.Code}}); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+		}
+	}
+	return loc, quiet, entries, nil
+}
+
+// Configure replaces the schedules with those in cfg, keeping the last run
+// of schedules that are still there. On error the old schedules stay.
+func (s *Scheduler) Configure(cfg Config, now time.Time) error {
+	loc, quiet, entries, err := parseSchedules(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := make(map[string]*ScheduleEntry)
+	for _, e := range s.entries {
+		old[e.Name] = e
+	}
+	s.enabled = cfg.Scheduler.Enabled
+	s.loc = loc
+	s.quiet = quiet
+	s.jitter = time.Duration(cfg.Scheduler.JitterMinutes) * time.Minute
+	for _, e := range entries {
+		if prev, ok := old[e.Name]; ok {
+			e.LastRun, e.LastJob, e.LastResult = prev.LastRun, prev.LastJob, prev.LastResult
+		}
+		s.schedule(e, now)
+	}
+	s.entries = entries
+	for _, e := range s.sources {
+		s.schedule(e, now)
+	}
+	s.wakeUp()
+	return nil
+}
+
+// SetSources replaces the schedules of custom sources with those of
+// sources, keeping the last run of schedules that are still there.
+func (s *Scheduler) SetSources(sources []CustomSource, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := make(map[string]*ScheduleEntry)
+	for _, e := range s.sources {
+		old[e.Name] = e
+	}
+	s.sources = nil
+	for _, src := range sources {
+		if src.Schedule == "" {
+			continue
+		}
+		schedule, err := cron.ParseStandard(src.Schedule)
+		if err != nil {
+			log.Printf("Source %s has an invalid schedule %q: %v", src.ID, src.Schedule, err)
+			continue
+		}
+		e := &ScheduleEntry{Name: "source:" + src.ID, Cron: src.Schedule, Source: src.ID, schedule: schedule}
+		if prev, ok := old[e.Name]; ok {
+			e.LastRun, e.LastJob, e.LastResult = prev.LastRun, prev.LastJob, prev.LastResult
+		}
+		s.schedule(e, now)
+		s.sources = append(s.sources, e)
+	}
+	s.wakeUp()
+}
+
+// wakeUp makes Run recompute when the next schedule is due. Callers hold
+// s.mu.
+func (s *Scheduler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// all returns every schedule. Callers hold s.mu.
+func (s *Scheduler) all() []*ScheduleEntry {
+	return append(append([]*ScheduleEntry(nil), s.entries...), s.sources...)
+}
+
+// Restore fills in the last run of each schedule from the job history, so
+// /api/status still shows it after a restart.
+func (s *Scheduler) Restore(jobs []Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.all() {
+		if e.LastRun != "" {
+			continue
+		}
+		for _, j := range jobs { // newest first
+			if j.Schedule == e.Name {
+				e.LastRun, e.LastJob, e.LastResult = j.StartedAt, j.ID, j.State
+				break
+			}
+		}
+	}
+}
+
+// Finished records the outcome of a job as the last result of the
+// schedule that started it, unless the schedule has come due since.
+func (s *Scheduler) Finished(job Job) {
+	if job.Schedule == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.all() {
+		if e.LastJob == job.ID && e.LastResult == "started" {
+			e.LastResult = job.State
+		}
+	}
+}
+
+// schedule sets e's next run after now. Callers hold s.mu.
+func (s *Scheduler) schedule(e *ScheduleEntry, now time.Time) {
+	next := e.schedule.Next(now.In(s.loc))
+	if s.jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+	if s.quiet != nil {
+		next = s.quiet.after(next)
+	}
+	e.next = next
+	e.NextRun = next.Format(time.RFC3339)
+}
+
+// Run starts due schedules until stop is closed.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	for {
+		var timer *time.Timer
+		var due <-chan time.Time
+		if next := s.nextDue(); !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-s.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-due:
+			s.RunDue(time.Now())
+		}
+	}
+}
+
+func (s *Scheduler) nextDue() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	if !s.enabled {
+		return next
+	}
+	for _, e := range s.all() {
+		if next.IsZero() || e.next.Before(next) {
+			next = e.next
+		}
+	}
+	return next
+}
+
+// RunDue starts every schedule due at now. One that comes due while a job
+// is running, including one started by another schedule due at the same
+// time, is skipped until its next time.
+func (s *Scheduler) RunDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled {
+		return
+	}
+	for _, e := range s.all() {
+		if e.next.After(now) {
+			continue
+		}
+		e.LastRun = now.Format(time.RFC3339)
+		job, err := s.start(ScrapeRequest{Regions: e.Regions, Venues: e.Venues, Schedule: e.Name, Source: e.Source})
+		switch {
+		case err == errJobRunning:
+			e.LastResult = "skipped: a job was running"
+			log.Printf("Scheduled scrape %s skipped: a job is already running", e.Name)
+		case err != nil:
+			e.LastResult = "failed: " + err.Error()
+			log.Printf("Scheduled scrape %s failed to start: %v", e.Name, err)
+		default:
+			e.LastJob = job.ID
+			e.LastResult = "started"
+			log.Printf("Scheduled scrape %s started job %s", e.Name, job.ID)
+		}
+		s.schedule(e, now)
+	}
+}
+
+// Status returns the schedules in order of their next run.
+func (s *Scheduler) Status() SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := SchedulerStatus{Enabled: s.enabled, Timezone: s.loc.String(), Entries: []ScheduleEntry{}}
+	for _, e := range s.all() {
+		st.Entries = append(st.Entries, *e)
+	}
+	sort.SliceStable(st.Entries, func(i, j int) bool { return st.Entries[i].next.Before(st.Entries[j].next) })
+	return st
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHours(t *testing.T) {
+	day := func(h, m int) time.Time { return time.Date(2026, 3, 2, h, m, 0, 0, time.UTC) }
+	tests := []struct {
+		start, end string
+		at, want   time.Time
+	}{
+		{"01:00", "06:00", day(3, 30), day(6, 0)},
+		{"01:00", "06:00", day(6, 0), day(6, 0)},
+		{"01:00", "06:00", day(12, 0), day(12, 0)},
+		// Wrapping midnight: late evening moves to the next morning.
+		{"22:00", "07:00", day(23, 15), day(7, 0).AddDate(0, 0, 1)},
+		{"22:00", "07:00", day(2, 0), day(7, 0)},
+		{"22:00", "07:00", day(21, 59), day(21, 59)},
+	}
+	for _, tt := range tests {
+		start, _ := parseClock(tt.start)
+		end, _ := parseClock(tt.end)
+		if got := (quietHours{start, end}).after(tt.at); !got.Equal(tt.want) {
+			t.Errorf("quiet %s-%s after(%s) = %s, want %s", tt.start, tt.end, tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParseSchedules(t *testing.T) {
+	cfg := testScrapeConfig()
+	cfg.RegionalVenues.Regions[0].Schedule = "0 3 * * *"
+	cfg.RegionalVenues.Regions[1].Venues[0].Schedule = "@weekly"
+	_, _, entries, err := parseSchedules(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "region:socal" || entries[1].Name != "venue:santafeopera" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if entries[1].Venues[0] != "santafeopera" || len(entries[1].Regions) != 0 {
+		t.Errorf("venue entry selects %v/%v", entries[1].Regions, entries[1].Venues)
+	}
+
+	bad := []func(*Config){
+		func(c *Config) { c.RegionalVenues.Regions[0].Schedule = "every day" },
+		func(c *Config) { c.Scheduler.Timezone = "Mars/Olympus" },
+		func(c *Config) { c.Scheduler.JitterMinutes = -5 },
+		func(c *Config) { c.Scheduler.QuietHours.Start = "25:00"; c.Scheduler.QuietHours.End = "06:00" },
+		func(c *Config) { c.Scheduler.QuietHours.Start = "01:00" },
+	}
+	for i, mutate := range bad {
+		c := testScrapeConfig()
+		mutate(&c)
+		if _, _, _, err := parseSchedules(c); err == nil {
+			t.Errorf("bad config %d: expected an error", i)
+		}
+	}
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	cfg := testScrapeConfig()
+	cfg.Scheduler.Enabled = true
+	cfg.Scheduler.Timezone = "UTC"
+	cfg.Scheduler.QuietHours.Start = "02:00"
+	cfg.Scheduler.QuietHours.End = "05:00"
+	cfg.RegionalVenues.Regions[0].Schedule = "0 * * * *"
+	cfg.RegionalVenues.Regions[1].Schedule = "0 3 * * *"
+
+	busy := false
+	var started []ScrapeRequest
+	s := NewScheduler(func(req ScrapeRequest) (Job, error) {
+		if busy {
+			return Job{}, errJobRunning
+		}
+		started = append(started, req)
+		return Job{ID: "job-" + req.Schedule}, nil
+	})
+	now := time.Date(2026, 3, 2, 0, 30, 0, 0, time.UTC)
+	if err := s.Configure(cfg, now); err != nil {
+		t.Fatal(err)
+	}
+
+	next := map[string]string{}
+	for _, e := range s.Status().Entries {
+		next[e.Name] = e.NextRun
+	}
+	if next["region:socal"] != "2026-03-02T01:00:00Z" {
+		t.Errorf("socal next run = %s", next["region:socal"])
+	}
+	// 03:00 falls in the quiet hours, so the run waits until they end.
+	if next["region:nm"] != "2026-03-02T05:00:00Z" {
+		t.Errorf("nm next run = %s", next["region:nm"])
+	}
+
+	s.RunDue(now) // nothing due yet
+	if len(started) != 0 {
+		t.Fatalf("started %v before anything was due", started)
+	}
+
+	s.RunDue(now.Add(30 * time.Minute))
+	if len(started) != 1 || started[0].Schedule != "region:socal" || started[0].Regions[0] != "socal" {
+		t.Fatalf("started = %+v", started)
+	}
+	socal := s.Status().Entries[0]
+	if socal.LastJob != "job-region:socal" || socal.LastResult != "started" || socal.NextRun != "2026-03-02T05:00:00Z" {
+		t.Errorf("after run: %+v", socal)
+	}
+	s.Finished(Job{ID: "job-region:socal", Schedule: "region:socal", State: JobSucceeded})
+	if socal := s.Status().Entries[0]; socal.LastResult != JobSucceeded {
+		t.Errorf("after the job finished: last result = %q, want %q", socal.LastResult, JobSucceeded)
+	}
+
+	busy = true
+	s.RunDue(time.Date(2026, 3, 2, 5, 0, 0, 0, time.UTC))
+	for _, e := range s.Status().Entries {
+		if e.LastResult != "skipped: a job was running" {
+			t.Errorf("%s: last result = %q, want skipped", e.Name, e.LastResult)
+		}
+	}
+
+	// Reconfiguring keeps the last run of schedules that remain.
+	cfg.RegionalVenues.Regions[1].Schedule = ""
+	if err := s.Configure(cfg, now); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Status().Entries
+	if len(entries) != 1 || entries[0].LastJob != "job-region:socal" {
+		t.Errorf("after reconfigure: %+v", entries)
+	}
+}
+
+func TestSchedulerRestore(t *testing.T) {
+	cfg := testScrapeConfig()
+	cfg.RegionalVenues.Regions[0].Schedule = "@daily"
+	s := NewScheduler(func(ScrapeRequest) (Job, error) { return Job{}, nil })
+	if err := s.Configure(cfg, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s.Restore([]Job{
+		{ID: "b", Schedule: "region:socal", State: JobFailed, StartedAt: "2026-03-02T03:00:00Z"},
+		{ID: "a", Schedule: "region:socal", State: JobSucceeded, StartedAt: "2026-03-01T03:00:00Z"},
+	})
+	e := s.Status().Entries[0]
+	if e.LastJob != "b" || e.LastResult != JobFailed || e.LastRun != "2026-03-02T03:00:00Z" {
+		t.Errorf("restored %+v", e)
+	}
+}
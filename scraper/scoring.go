@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Signal weights for ConfidenceScorer. The opera-match weight is dropped
+// (and the rest renormalised) when no known opera titles are available.
+const (
+	weightStructure  = 0.30
+	weightTitle      = 0.30
+	weightDates      = 0.25
+	weightOperaMatch = 0.15
+)
+
+// strategyBase is the structural confidence of each generic-parser strategy.
+var strategyBase = map[string]float64{
+	"json-ld":   1.0,
+	"heuristic": 0.5,
+	"meta":      0.1,
+}
+
+// navigationTitles are link and heading texts that heuristic selectors
+// commonly pick up from site chrome rather than from an event.
+var navigationTitles = map[string]bool{
+	"home": true, "menu": true, "search": true, "login": true, "log in": true,
+	"sign in": true, "subscribe": true, "donate": true, "support us": true,
+	"contact": true, "contact us": true, "about": true, "about us": true,
+	"tickets": true, "buy tickets": true, "buy now": true, "book now": true,
+	"read more": true, "learn more": true, "more info": true, "view all": true,
+	"see all": true, "details": true, "calendar": true, "events": true,
+	"upcoming events": true, "season": true, "skip to content": true,
+	"skip to main content": true, "newsletter": true, "gift cards": true,
+}
+
+// ConfidenceScorer rates events produced by the generic parser so that
+// navigation junk and page-title fallbacks can be told apart from real
+// performances.
+type ConfidenceScorer struct {
+	Matcher   *TitleMatcher
+	Threshold float64
+	now       func() time.Time
+}
+
+func NewConfidenceScorer(matcher *TitleMatcher, threshold float64) *ConfidenceScorer {
+	return &ConfidenceScorer{
+		Matcher:   matcher,
+		Threshold: threshold,
+		now:       time.Now,
+	}
+}
+
+// ScoreAll scores every event that came from the generic parser. Events from
+// venue-specific parsers carry no strategy and are left untouched.
+func (sc *ConfidenceScorer) ScoreAll(events []PerformanceEvent) {
+	for i := range events {
+		if events[i].Strategy != "" {
+			sc.Score(&events[i])
+		}
+	}
+}
+
+// Score sets ev.Confidence in [0, 1] and records the reasons behind it.
+// Navigation text and dateless events found only in page meta tags score 0
+// whatever their other signals, since they are never performances.
+func (sc *ConfidenceScorer) Score(ev *PerformanceEvent) {
+	if reason := rejectReason(ev); reason != "" {
+		ev.Confidence = 0
+		ev.ConfidenceReasons = []string{reason}
+		return
+	}
+
+	var reasons []string
+	total, weights := 0.0, 0.0
+
+	add := func(weight, score float64, reason string) {
+		total += weight * score
+		weights += weight
+		reasons = append(reasons, fmt.Sprintf("%s (%.2f)", reason, score))
+	}
+
+	s, r := sc.structureScore(ev)
+	add(weightStructure, s, r)
+	s, r = sc.titleScore(ev.Title)
+	add(weightTitle, s, r)
+	s, r = sc.datesScore(ev.Dates)
+	add(weightDates, s, r)
+	if sc.Matcher != nil && sc.Matcher.Len() > 0 {
+		s, r = sc.operaMatchScore(ev.Title)
+		add(weightOperaMatch, s, r)
+	}
+
+	ev.Confidence = math.Round(total/weights*100) / 100
+	ev.ConfidenceReasons = reasons
+}
+
+// rejectReason says why ev is rejected outright, or returns "".
+func rejectReason(ev *PerformanceEvent) string {
+	title := strings.TrimSpace(ev.Title)
+	if navigationTitles[strings.ToLower(strings.Join(strings.Fields(title), " "))] {
+		return fmt.Sprintf("rejected: title %q looks like navigation text", title)
+	}
+	metaOnly := ev.Strategy == "meta" && len(ev.Strategies) <= 1
+	if metaOnly && len(ev.Dates) == 0 {
+		return "rejected: only a page meta tag, with no dates"
+	}
+	return ""
+}
+
+// Split partitions events into those at or above the threshold and those
+// below it. Unscored events are always accepted.
+func (sc *ConfidenceScorer) Split(events []PerformanceEvent) (accepted, rejected []PerformanceEvent) {
+	for _, ev := range events {
+		if ev.Strategy != "" && ev.Confidence < sc.Threshold {
+			rejected = append(rejected, ev)
+		} else {
+			accepted = append(accepted, ev)
+		}
+	}
+	return accepted, rejected
+}
+
+func (sc *ConfidenceScorer) structureScore(ev *PerformanceEvent) (float64, string) {
+	score := strategyBase[ev.Strategy]
+	reason := fmt.Sprintf("structure: extracted by %s strategy", ev.Strategy)
+	if len(ev.Strategies) > 1 {
+		score = math.Min(1, score+0.15*float64(len(ev.Strategies)-1))
+		reason = fmt.Sprintf("structure: extracted by %s strategies", strings.Join(ev.Strategies, "+"))
+	}
+	if ev.VenueName != "" || ev.City != "" {
+		score = math.Min(1, score+0.2)
+		reason += " with venue details"
+	}
+	return score, reason
+}
+
+func (sc *ConfidenceScorer) titleScore(title string) (float64, string) {
+	title = strings.TrimSpace(title)
+
+	switch {
+	case utf8.RuneCountInString(title) < 3:
+		return 0, "title: too short"
+	case !strings.ContainsFunc(title, unicode.IsLetter):
+		return 0, "title: contains no letters"
+	}
+
+	score := 1.0
+	var problems []string
+	if utf8.RuneCountInString(title) > 120 {
+		score -= 0.6
+		problems = append(problems, "unusually long")
+	}
+	if strings.ContainsAny(title, "\n\t") {
+		score -= 0.3
+		problems = append(problems, "spans multiple lines")
+	}
+	if strings.Contains(title, " | ") {
+		score -= 0.3
+		problems = append(problems, "contains a page-title separator")
+	}
+	if len(problems) == 0 {
+		return score, "title: well-formed"
+	}
+	return math.Max(0, score), "title: " + strings.Join(problems, ", ")
+}
+
+func (sc *ConfidenceScorer) datesScore(dates []string) (float64, string) {
+	if len(dates) == 0 {
+		return 0, "dates: none found"
+	}
+
+	now := sc.now()
+	earliest := now.AddDate(-1, 0, 0)
+	latest := now.AddDate(3, 0, 0)
+
+	plausible, unparsed := 0, 0
+	for _, d := range dates {
+		t, ok := parseEventDate(d)
+		if !ok {
+			unparsed++
+			continue
+		}
+		if !t.Before(earliest) && !t.After(latest) {
+			plausible++
+		}
+	}
+
+	reason := fmt.Sprintf("dates: %d of %d within a plausible season window", plausible, len(dates))
+	if unparsed > 0 {
+		reason += fmt.Sprintf(", %d unparseable", unparsed)
+	}
+	return float64(plausible) / float64(len(dates)), reason
+}
+
+func (sc *ConfidenceScorer) operaMatchScore(title string) (float64, string) {
+	tm, ok := sc.Matcher.Best(title)
+	if !ok {
+		return 0, "opera: no match among known operas"
+	}
+	if tm.Via != "" {
+		return tm.Score, fmt.Sprintf("opera: matches %q as %q", tm.Title, tm.Via)
+	}
+	return tm.Score, fmt.Sprintf("opera: matches %q", tm.Title)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfidenceScorer(t *testing.T) {
+	sc := NewConfidenceScorer(nil, 0.45)
+	sc.now = func() time.Time { return time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name   string
+		ev     PerformanceEvent
+		accept bool
+	}{
+		{
+			name:   "json-ld performance",
+			ev:     PerformanceEvent{Title: "La Traviata", Dates: []string{"2026-11-08"}, VenueName: "Dorothy Chandler Pavilion", Strategy: "json-ld", Strategies: []string{"json-ld"}},
+			accept: true,
+		},
+		{
+			name:   "heuristic performance",
+			ev:     PerformanceEvent{Title: "Tosca", Dates: []string{"2026-11-08"}, Strategy: "heuristic", Strategies: []string{"heuristic"}},
+			accept: true,
+		},
+		{
+			name: "navigation title with a date",
+			ev:   PerformanceEvent{Title: "Buy Tickets", Dates: []string{"2026-11-08"}, Strategy: "heuristic", Strategies: []string{"heuristic"}},
+		},
+		{
+			name: "navigation title from two strategies",
+			ev:   PerformanceEvent{Title: "Read more", Strategy: "heuristic", Strategies: []string{"heuristic", "meta"}},
+		},
+		{
+			name: "dateless meta title",
+			ev:   PerformanceEvent{Title: "La Traviata", VenueName: "LA Opera", Strategy: "meta", Strategies: []string{"meta"}},
+		},
+		{
+			name:   "meta title with a date",
+			ev:     PerformanceEvent{Title: "La Traviata", Dates: []string{"2026-11-08"}, VenueName: "LA Opera", Strategy: "meta", Strategies: []string{"meta"}},
+			accept: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := tt.ev
+			sc.Score(&ev)
+			accepted, _ := sc.Split([]PerformanceEvent{ev})
+			if got := len(accepted) == 1; got != tt.accept {
+				t.Errorf("accepted = %v with confidence %.2f %q, want %v", got, ev.Confidence, ev.ConfidenceReasons, tt.accept)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	// minPrefixRunes is the shortest query word matched as a prefix; a
+	// single letter would match half the index.
+	minPrefixRunes = 2
+)
+
+// Field weights: a hit in a title or label counts for more than one in a
+// venue's city.
+var searchFieldWeights = map[string]float64{
+	"title":    1.0,
+	"label":    1.0,
+	"composer": 0.8,
+	"cast":     0.7,
+	"venue":    0.7,
+	"city":     0.5,
+}
+
+// searchTypeRank breaks ties between equally good results: graph nodes
+// (rank 0) before venues before individual events.
+var searchTypeRank = map[string]int{"venue": 1, "event": 2}
+
+// Term weights by how a query word matched an indexed word.
+const (
+	exactTermWeight  = 1.0
+	prefixTermWeight = 0.8
+	typo1TermWeight  = 0.6
+	typo2TermWeight  = 0.4
+)
+
+// SearchResult is one typed hit: an event, a venue, or a graph node typed
+// by its node type ("opera", "composer", ...).
+type SearchResult struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id"`
+	Label   string   `json:"label"`
+	Detail  string   `json:"detail,omitempty"`
+	NodeKey string   `json:"node_key,omitempty"` // graph node to select, if any
+	URL     string   `json:"url,omitempty"`
+	Score   float64  `json:"score"`
+	Fields  []string `json:"fields"` // which fields matched
+}
+
+type searchDoc struct {
+	result SearchResult
+	norm   string // normalised label, to boost exact matches
+}
+
+type posting struct {
+	doc   int
+	field string
+}
+
+// SearchIndex is an inverted index from normalised words to the events,
+// venues and graph nodes containing them.
+type SearchIndex struct {
+	docs     []searchDoc
+	postings map[string][]posting
+	terms    []string // sorted, for prefix lookups
+}
+
+// NewSearchIndex indexes the latest snapshot of each event, the venues
+// they are at, and graph's nodes. graph may be nil.
+func NewSearchIndex(events []PerformanceEvent, graph *GraphIndex) *SearchIndex {
+	idx := &SearchIndex{postings: make(map[string][]posting)}
+
+	venues := make(map[string]bool)
+	for _, ev := range events {
+		detail := joinNonEmpty(", ", ev.VenueName, ev.City, ev.State)
+		if len(ev.Dates) > 0 {
+			detail = joinNonEmpty(" · ", detail, ev.Dates[0])
+		}
+		doc := idx.add(SearchResult{
+			Type:    "event",
+			ID:      eventKey(ev),
+			Label:   ev.Title,
+			Detail:  detail,
+			NodeKey: ev.MatchedOperaKey,
+			URL:     ev.SourceURL,
+		})
+		idx.addField(doc, "title", ev.Title)
+		idx.addField(doc, "composer", ev.Composer)
+		idx.addField(doc, "venue", ev.VenueName)
+		idx.addField(doc, "city", ev.City)
+		for _, name := range ev.Cast {
+			idx.addField(doc, "cast", name)
+		}
+
+		if ev.VenueCode == "" || venues[ev.VenueCode] {
+			continue
+		}
+		venues[ev.VenueCode] = true
+		label := ev.VenueName
+		if label == "" {
+			label = ev.VenueCode
+		}
+		doc = idx.add(SearchResult{
+			Type:   "venue",
+			ID:     ev.VenueCode,
+			Label:  label,
+			Detail: joinNonEmpty(", ", ev.City, ev.State),
+		})
+		idx.addField(doc, "label", label)
+		idx.addField(doc, "city", ev.City)
+	}
+
+	if graph != nil {
+		keys := make([]string, 0, len(graph.Nodes))
+		for key := range graph.Nodes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			n := graph.Nodes[key]
+			if n.Attributes.Label == "" {
+				continue
+			}
+			doc := idx.add(SearchResult{
+				Type:    n.Attributes.Type,
+				ID:      key,
+				Label:   n.Attributes.Label,
+				Detail:  n.Attributes.ComposerName,
+				NodeKey: key,
+			})
+			idx.addField(doc, "label", n.Attributes.Label)
+			for _, alias := range n.Attributes.Aliases {
+				idx.addField(doc, "label", alias)
+			}
+			for _, label := range n.Attributes.Labels {
+				idx.addField(doc, "label", label)
+			}
+			idx.addField(doc, "composer", n.Attributes.ComposerName)
+		}
+	}
+
+	idx.terms = make([]string, 0, len(idx.postings))
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+	}
+	sort.Strings(idx.terms)
+	return idx
+}
+
+func (idx *SearchIndex) add(r SearchResult) int {
+	idx.docs = append(idx.docs, searchDoc{result: r, norm: strings.Join(searchTokens(r.Label), " ")})
+	return len(idx.docs) - 1
+}
+
+func (idx *SearchIndex) addField(doc int, field, text string) {
+	for _, term := range searchTokens(text) {
+		postings := idx.postings[term]
+		if n := len(postings); n > 0 && postings[n-1] == (posting{doc, field}) {
+			continue
+		}
+		idx.postings[term] = append(postings, posting{doc, field})
+	}
+}
+
+// searchTokens splits text into lowercase words with diacritics and
+// ligatures folded, as in normalizeTitle but keeping articles.
+func searchTokens(s string) []string {
+	s = strings.ToLower(s)
+	if folded, _, err := transform.String(foldDiacritics, s); err == nil {
+		s = folded
+	}
+	s = titleLigatures.Replace(s)
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Search returns up to limit results containing every word of q, each
+// matched exactly, as a prefix or with a typo, best first. types restricts
+// the result types if not empty.
+func (idx *SearchIndex) Search(q string, types []string, limit int) []SearchResult {
+	words := searchTokens(q)
+	if len(words) == 0 {
+		return []SearchResult{}
+	}
+
+	scores := make(map[int]float64)
+	fields := make(map[int]map[string]bool)
+	for n, word := range words {
+		best := make(map[int]float64)
+		for term, weight := range idx.matchTerms(word) {
+			for _, p := range idx.postings[term] {
+				if w := weight * searchFieldWeights[p.field]; w > best[p.doc] {
+					best[p.doc] = w
+				}
+				if fields[p.doc] == nil {
+					fields[p.doc] = make(map[string]bool)
+				}
+				fields[p.doc][p.field] = true
+			}
+		}
+		// Every word must match somewhere in a result.
+		for doc := range scores {
+			if _, ok := best[doc]; !ok {
+				delete(scores, doc)
+			}
+		}
+		for doc, w := range best {
+			if n == 0 {
+				scores[doc] = w
+			} else if _, ok := scores[doc]; ok {
+				scores[doc] += w
+			}
+		}
+	}
+
+	query := strings.Join(words, " ")
+	results := make([]SearchResult, 0, len(scores))
+	for doc, score := range scores {
+		d := idx.docs[doc]
+		if len(types) > 0 && !containsFold(types, d.result.Type) {
+			continue
+		}
+		r := d.result
+		r.Score = score / float64(len(words))
+		if d.norm == query {
+			r.Score += 0.5
+		}
+		for field := range fields[doc] {
+			r.Fields = append(r.Fields, field)
+		}
+		sort.Strings(r.Fields)
+		results = append(results, r)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.Label) != len(b.Label) {
+			return len(a.Label) < len(b.Label)
+		}
+		if ra, rb := searchTypeRank[a.Type], searchTypeRank[b.Type]; ra != rb {
+			return ra < rb
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.ID < b.ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// matchTerms returns the indexed words matching a query word, with the
+// weight of the best way each matched.
+func (idx *SearchIndex) matchTerms(word string) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := idx.postings[word]; ok {
+		matches[word] = exactTermWeight
+	}
+
+	wordLen := utf8.RuneCountInString(word)
+	if wordLen >= minPrefixRunes {
+		for i := sort.SearchStrings(idx.terms, word); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], word); i++ {
+			if _, ok := matches[idx.terms[i]]; !ok {
+				matches[idx.terms[i]] = prefixTermWeight
+			}
+		}
+	}
+
+	maxEdits := maxTypos(wordLen)
+	if maxEdits == 0 {
+		return matches
+	}
+	for _, term := range idx.terms {
+		if _, ok := matches[term]; ok {
+			continue
+		}
+		termLen := utf8.RuneCountInString(term)
+		if termLen < wordLen-maxEdits || termLen > wordLen+maxEdits {
+			continue
+		}
+		switch d := editDistance(word, term, maxEdits); {
+		case d > maxEdits:
+		case d == 1:
+			matches[term] = typo1TermWeight
+		case d == 2:
+			matches[term] = typo2TermWeight
+		}
+	}
+	return matches
+}
+
+// maxTypos is how many edits a query word of n letters may be off by:
+// none for short words, where a typo is as likely another word.
+func maxTypos(n int) int {
+	switch {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance returns the Damerau–Levenshtein (optimal string alignment)
+// distance between a and b, or max+1 once it is known to exceed max.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+			rowMin = minInt(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+)
+
+func testSearchIndex() *SearchIndex {
+	events := []PerformanceEvent{
+		{EventID: "tosca", VenueCode: "laopera", VenueName: "Dorothy Chandler Pavilion", City: "Los Angeles", State: "CA",
+			Title: "Tosca", Composer: "Giacomo Puccini", MatchedOperaKey: "Q213593", Dates: []string{"2026-11-01"},
+			Cast: []string{"Sondra Radvanovsky", "Russell Thomas"}},
+		{EventID: "gala", VenueCode: "sdopera", VenueName: "San Diego Civic Theatre", City: "San Diego", State: "CA",
+			Title: "Opening Night Gala"},
+		{EventID: "traviata", VenueCode: "sdopera", VenueName: "San Diego Civic Theatre", City: "San Diego", State: "CA",
+			Title: "La traviata", Composer: "Giuseppe Verdi"},
+	}
+	graph := &GraphIndex{Nodes: map[string]GraphNode{}}
+	for _, n := range []struct{ key, label, typ, composer string }{
+		{"Q213593", "Tosca", "opera", "Giacomo Puccini"},
+		{"Q7314", "Giacomo Puccini", "composer", ""},
+		{"Q7317", "Giuseppe Verdi", "composer", ""},
+	} {
+		var node GraphNode
+		node.Key = n.key
+		node.Attributes.Label = n.label
+		node.Attributes.Type = n.typ
+		node.Attributes.ComposerName = n.composer
+		graph.Nodes[n.key] = node
+	}
+	return NewSearchIndex(events, graph)
+}
+
+func searchIDs(results []SearchResult) []string {
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.Type+":"+r.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	idx := testSearchIndex()
+	tests := []struct {
+		q     string
+		types []string
+		want  []string // leading results, in order
+		none  bool
+	}{
+		// Exact label match ranks the opera node first.
+		{q: "tosca", want: []string{"opera:Q213593", "event:laopera:tosca"}},
+		// Prefix of the last word.
+		{q: "puc", want: []string{"composer:Q7314"}},
+		// One typo, accents and case ignored.
+		{q: "Pucini", want: []string{"composer:Q7314"}},
+		{q: "TRAVIÀTA", want: []string{"event:sdopera:traviata"}},
+		// Cast names and cities find events; every word must match.
+		{q: "radvanovsky", want: []string{"event:laopera:tosca"}},
+		{q: "san diego", types: []string{"venue"}, want: []string{"venue:sdopera"}},
+		{q: "tosca diego", none: true},
+		// Short words are not typo-matched.
+		{q: "la x", none: true},
+	}
+	for _, tt := range tests {
+		got := searchIDs(idx.Search(tt.q, tt.types, 10))
+		if tt.none {
+			if len(got) != 0 {
+				t.Errorf("Search(%q) = %v, want nothing", tt.q, got)
+			}
+			continue
+		}
+		if len(got) < len(tt.want) {
+			t.Errorf("Search(%q) = %v, want %v first", tt.q, got, tt.want)
+			continue
+		}
+		for i, id := range tt.want {
+			if got[i] != id {
+				t.Errorf("Search(%q) = %v, want %v first", tt.q, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSearchTypeFilterAndLimit(t *testing.T) {
+	idx := testSearchIndex()
+	for _, r := range idx.Search("giacomo", []string{"composer"}, 10) {
+		if r.Type != "composer" {
+			t.Errorf("type filter returned %s:%s", r.Type, r.ID)
+		}
+	}
+	if got := idx.Search("san", nil, 1); len(got) != 1 {
+		t.Errorf("limit 1 returned %d results", len(got))
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"puccini", "puccini", 0},
+		{"pucini", "puccini", 1},
+		{"tsoca", "tosca", 1}, // transposition
+		{"travaita", "traviata", 1},
+		{"verdi", "wagner", 3}, // capped at max+1
+	} {
+		if got := editDistance(tt.a, tt.b, 2); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,21 +23,78 @@ type Server struct {
 	configPath string
 	dataDir    string
 	staticDir  string
-	status     string
-	mu         sync.Mutex
 	browser    *BrowserManager
+	jobs       *JobManager
+	logs       *LogTail
+	scheduler  *Scheduler
+	sources    *SourceStore
+	auth       *Auth
+
+	configMu sync.Mutex // serialises config writes
+
+	// Server settings given as flags, which win over config.yaml.
+	serverFlags ServerConfig
+	corsMu      sync.RWMutex
+	origins     []string
+
+	limitMu      sync.RWMutex
+	limits       *apiLimits
+	browserQueue *BrowserQueue
+
+	events *EventRepository
+
+	// lookup replaces the URL guards' resolver in tests.
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+
+	graphMu      sync.Mutex
+	graph        *GraphIndex
+	graphModTime time.Time
+
+	searchMu      sync.Mutex
+	search        *SearchIndex
+	searchVersion uint64
+	searchGraph   *GraphIndex
 }
 
 func NewServer(configPath, dataDir, staticDir string) *Server {
-	return &Server{
+	s := &Server{
 		configPath: configPath,
 		dataDir:    dataDir,
 		staticDir:  staticDir,
-		status:     "Idle",
+		jobs:       NewJobManager(dataDir),
+		logs:       NewLogTail(),
+		events:     NewEventRepository(dataDir),
+		sources:    NewSourceStore(dataDir),
+		auth:       NewAuth(),
+		limits:     newAPILimits(RateLimitConfig{}),
 	}
+	s.browserQueue = NewBrowserQueue(defaultBrowserPages, defaultBrowserQueue)
+	s.scheduler = NewScheduler(s.startScheduledScrape)
+	s.jobs.onFinish = s.scheduler.Finished
+	return s
 }
 
-func (s *Server) Start(port int) {
+func (s *Server) Start(flags ServerConfig) {
+	log.SetOutput(io.MultiWriter(os.Stderr, s.logs))
+	s.serverFlags = flags
+
+	s.events.Refresh()
+	go func() {
+		if err := s.events.Watch(nil); err != nil {
+			log.Printf("Warning: not watching event files: %v (events refresh only after API scrapes)", err)
+		}
+	}()
+
+	cfg, err := LoadConfig(s.configPath)
+	if err != nil {
+		log.Printf("Warning: config not applied: %v", err)
+	} else if err := s.applyConfig(cfg); err != nil {
+		log.Printf("Warning: scheduler not configured: %v", err)
+	}
+	s.scheduler.SetSources(s.sources.List(), time.Now())
+	s.scheduler.Restore(s.jobs.List())
+	go s.scheduler.Run(nil)
+
 	// Initialize browser for scrape-url endpoint
 	bm, err := NewBrowserManager()
 	if err != nil {
@@ -44,13 +107,69 @@ func (s *Server) Start(port int) {
 		}
 	}
 
+	sc := cfg.Server.override(flags)
+	s.browserQueue = NewBrowserQueue(orDefault(sc.RateLimit.BrowserPages, defaultBrowserPages), orDefault(sc.RateLimit.BrowserQueue, defaultBrowserQueue))
+	srv, err := httpServer(sc, s.Handler())
+	if err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+	l, err := listen(sc)
+	if err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+
+	addr := serverURL(sc, l)
+	log.Printf("Starting Violetta server on %s", addr)
+	if s.staticDir != "" {
+		log.Printf("  Web UI: %s", addr)
+	}
+	log.Printf("  API:    %s/api/", addr)
+	if sc.TLS.SelfSigned {
+		log.Printf("  Using a self-signed certificate; browsers will warn about it")
+	}
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(l, "", "")
+	} else {
+		err = srv.Serve(l)
+	}
+	if err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+// Handler routes the API and, if there is a static dir, the web UI. With
+// auth enabled each API route needs the role given for reading (GET and
+// HEAD) or for everything else.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/config", s.handleConfig)
-	mux.HandleFunc("/api/status", s.handleStatus)
-	mux.HandleFunc("/api/scrape", s.handleScrape)
-	mux.HandleFunc("/api/scrape-url", s.handleScrapeURL)
-	mux.HandleFunc("/api/events", s.handleEvents)
-	mux.HandleFunc("/api/sources", s.handleSources)
+	route := func(pattern string, read, write Role, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, s.auth.Require(read, write, h))
+	}
+	mux.HandleFunc("/api/auth/login", s.handleLogin)
+	mux.HandleFunc("/api/auth/logout", s.handleLogout)
+	mux.HandleFunc("/api/auth/me", s.handleWhoAmI)
+	route("/api/config", RoleAdmin, RoleAdmin, s.handleConfig)
+	route("/api/config/validate", RoleAdmin, RoleAdmin, s.handleConfigValidate)
+	route("/api/regions", RolePublic, RoleAdmin, s.handleRegions)
+	route("/api/regions/", RolePublic, RoleAdmin, s.handleRegion)
+	route("/api/venues", RolePublic, RoleAdmin, s.handleVenues)
+	route("/api/venues/", RolePublic, RoleAdmin, s.handleVenue)
+	route("/api/status", RoleViewer, RoleAdmin, s.handleStatus)
+	route("/api/scrape", RoleViewer, RoleAdmin, s.handleScrape)
+	route("/api/scrape-url", RoleAdmin, RoleAdmin, s.handleScrapeURL)
+	route("/api/jobs", RoleViewer, RoleAdmin, s.handleJobs)
+	route("/api/jobs/", RoleViewer, RoleAdmin, s.handleJob)
+	route("/api/logs", RoleAdmin, RoleAdmin, s.handleLogs)
+	route("/api/events", RolePublic, RoleAdmin, s.handleEvents)
+	route("/api/events/", RolePublic, RoleAdmin, s.handleEvent)
+	route("/api/events.ics", RolePublic, RoleAdmin, s.handleEventsICS)
+	route("/api/productions/", RolePublic, RoleAdmin, s.handleProduction)
+	route("/api/feed.atom", RolePublic, RoleAdmin, s.handleFeedAtom)
+	route("/api/sources", RoleViewer, RoleAdmin, s.handleSources)
+	route("/api/sources/", RoleViewer, RoleAdmin, s.handleSource)
+	route("/api/health/venues", RoleViewer, RoleAdmin, s.handleVenueHealth)
+	route("/api/match", RolePublic, RoleAdmin, s.handleMatch)
+	route("/api/search", RolePublic, RoleAdmin, s.handleSearch)
 
 	// Static file serving for SPA
 	if s.staticDir != "" {
@@ -72,272 +191,1693 @@ func (s *Server) Start(port int) {
 		}
 	}
 
-	handler := corsMiddleware(mux)
+	return s.cors(s.rateLimit(mux))
+}
 
-	addr := fmt.Sprintf(":%d", port)
-	log.Printf("Starting Violetta server on http://localhost%s", addr)
-	if s.staticDir != "" {
-		log.Printf("  Web UI: http://localhost%s", addr)
+// handleLogin checks a username and password and starts a session held in
+// an HTTP-only cookie.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
 	}
-	log.Printf("  API:    http://localhost%s/api/", addr)
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", 400)
+		return
+	}
+	id, sess, err := s.auth.Login(req.Username, req.Password)
+	if err == errBadCredentials {
+		log.Printf("[auth] Failed login for %q from %s", req.Username, r.RemoteAddr)
+		http.Error(w, "Invalid username or password", 401)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	log.Printf("[auth] %s logged in as %s", sess.Name, sess.Role)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  sess.expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":    sess.Name,
+		"role":    sess.Role.String(),
+		"expires": sess.expires.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.auth.Logout(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	w.WriteHeader(204)
+}
+
+// handleWhoAmI tells the web UI whether auth is on and who it is signed in
+// as.
+func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
 	}
+	p := s.auth.Identify(r)
+	resp := map[string]interface{}{"auth_enabled": s.auth.Enabled(), "role": p.Role.String()}
+	if !s.auth.Enabled() {
+		resp["role"] = RoleAdmin.String()
+	}
+	if p.Name != "" {
+		resp["user"] = p.Name
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
+// handleConfig returns config.yaml, or on PUT replaces it with the YAML in
+// the body once it validates, keeping the previous version as a backup, and
+// applies it to the running server. An If-Match header with the ETag from
+// GET guards against overwriting someone else's edit.
 func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "GET" {
+	switch r.Method {
+	case "GET":
 		data, err := os.ReadFile(s.configPath)
 		if err != nil {
 			http.Error(w, "Failed to read config", 500)
 			return
 		}
 		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("ETag", configETag(data))
 		w.Write(data)
-	} else if r.Method == "POST" {
-		http.Error(w, "Config editing via API not yet implemented", 501)
+	case "PUT":
+		s.handleConfigPut(w, r)
+	default:
+		http.Error(w, "Method not allowed", 405)
 	}
 }
 
-func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": s.status,
-	})
-}
-
-func (s *Server) handleScrape(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", 405)
+func (s *Server) handleConfigPut(w http.ResponseWriter, r *http.Request) {
+	data, ok := readConfigBody(w, r)
+	if !ok {
 		return
 	}
-	s.mu.Lock()
-	if s.status == "Running" {
-		s.mu.Unlock()
-		http.Error(w, "Scraper already running", 409)
+	cfg, problems := ParseConfig(data)
+	if len(problems) > 0 {
+		writeConfigValidation(w, 422, problems)
+		return
+	}
+	guard := s.urlGuard(cfg)
+	for i, region := range cfg.RegionalVenues.Regions {
+		for j, venue := range region.Venues {
+			for _, problem := range urlProblems(r.Context(), guard, venue) {
+				problems = append(problems, fmt.Sprintf("regional_venues.regions[%d].venues[%d] (%s): %s", i, j, venue.Code, problem))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		writeConfigValidation(w, 422, problems)
 		return
 	}
-	s.status = "Running"
-	s.mu.Unlock()
-
-	go func() {
-		log.Println("Scrape triggered via API")
-		region := "socal"
-		err := RunScrape(s.configPath, s.dataDir, region, false)
 
-		s.mu.Lock()
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	if match := r.Header.Get("If-Match"); match != "" {
+		current, err := os.ReadFile(s.configPath)
 		if err != nil {
-			log.Printf("Scrape failed: %v", err)
-			s.status = "Error"
-		} else {
-			s.status = "Idle"
+			http.Error(w, "Failed to read config", 500)
+			return
 		}
-		s.mu.Unlock()
-	}()
+		if strings.TrimSpace(match) != configETag(current) {
+			http.Error(w, "Config was changed since it was loaded", 412)
+			return
+		}
+	}
+	if err := s.saveConfig(data, cfg); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"message": "Scrape started"}`))
+	w.Header().Set("ETag", configETag(data))
+	writeConfigValidation(w, 200, nil)
 }
 
-func (s *Server) handleScrapeURL(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", 405)
-		return
+// saveConfig writes validated config YAML and applies it. Callers hold
+// s.configMu.
+func (s *Server) saveConfig(data []byte, cfg Config) error {
+	if err := WriteConfig(s.configPath, data); err != nil {
+		log.Printf("[config] %v", err)
+		return err
 	}
-
-	if s.browser == nil {
-		http.Error(w, "Browser not available. Restart server to retry.", 503)
-		return
+	if err := s.applyConfig(cfg); err != nil {
+		log.Printf("[config] Saved but not applied: %v", err)
+		return fmt.Errorf("config saved but not applied: %v", err)
 	}
+	log.Printf("[config] Updated via API and reloaded")
+	return nil
+}
 
-	body, err := io.ReadAll(r.Body)
+// editConfig makes one change to the regions and venues in config.yaml and
+// saves it as PUT /api/config would. A change leaving the config invalid is
+// not saved and its problems are returned instead.
+func (s *Server) editConfig(edit func(doc *ConfigDoc) error) (problems []string, err error) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	current, err := os.ReadFile(s.configPath)
 	if err != nil {
-		http.Error(w, "Failed to read request body", 400)
-		return
+		return nil, fmt.Errorf("failed to read config: %v", err)
 	}
-	defer r.Body.Close()
-
-	var req struct {
-		URL   string `json:"url"`
-		Label string `json:"label"`
+	doc, err := ParseConfigDoc(current)
+	if err != nil {
+		return nil, err
 	}
-	if err := json.Unmarshal(body, &req); err != nil {
+	if err := edit(doc); err != nil {
+		return nil, err
+	}
+	data, err := doc.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	cfg, problems := ParseConfig(data)
+	if len(problems) > 0 {
+		return problems, nil
+	}
+	return nil, s.saveConfig(data, cfg)
+}
+
+// decodeJSONBody decodes a request body of at most maxJSONBodyBytes into
+// v, answering 413 or 400 and returning false if it cannot.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", 413)
+			return false
+		}
 		http.Error(w, "Invalid JSON body", 400)
-		return
+		return false
 	}
+	return true
+}
 
-	if req.URL == "" {
-		http.Error(w, "URL is required", 400)
-		return
+// writeConfigEdit answers a region or venue change made with editConfig,
+// returning v on success.
+func writeConfigEdit(w http.ResponseWriter, problems []string, err error, code int, v interface{}) {
+	switch {
+	case len(problems) > 0:
+		writeConfigValidation(w, 422, problems)
+	case errors.Is(err, errRegionNotFound) || errors.Is(err, errVenueNotFound):
+		http.Error(w, err.Error(), 404)
+	case errors.Is(err, errRegionExists) || errors.Is(err, errVenueExists) || errors.Is(err, errRegionNotEmpty):
+		http.Error(w, err.Error(), 409)
+	case errors.Is(err, errCodeChange):
+		http.Error(w, err.Error(), 400)
+	case err != nil:
+		http.Error(w, err.Error(), 500)
+	case v == nil:
+		w.WriteHeader(code)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
 	}
-	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
-		req.URL = "https://" + req.URL
+}
+
+// handleRegions lists the configured regions with their venues, or on POST
+// adds the region in the body.
+func (s *Server) handleRegions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		cfg, err := LoadConfig(s.configPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		regions := cfg.RegionalVenues.Regions
+		if regions == nil {
+			regions = []RegionConfig{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(regions)
+	case "POST":
+		var region RegionConfig
+		if !decodeJSONBody(w, r, &region) {
+			return
+		}
+		problems, err := s.editConfig(func(doc *ConfigDoc) error { return doc.AddRegion(region) })
+		if err == nil && len(problems) == 0 {
+			w.Header().Set("Location", "/api/regions/"+url.PathEscape(region.Code))
+			log.Printf("[config] Added region %s via API", region.Code)
+		}
+		writeConfigEdit(w, problems, err, 201, region)
+	default:
+		http.Error(w, "Method not allowed", 405)
 	}
+}
 
-	s.mu.Lock()
-	s.status = "Running"
-	s.mu.Unlock()
+// handleRegion returns, updates or deletes one region. PUT replaces its
+// name and schedule; its venues are managed through /api/venues, and a
+// region must be empty to be deleted.
+func (s *Server) handleRegion(w http.ResponseWriter, r *http.Request) {
+	code, ok := pathID(r, "/api/regions/")
+	if !ok {
+		http.Error(w, "Region not found", 404)
+		return
+	}
 
-	events, strategy, err := ScrapeURL(req.URL, s.browser)
+	switch r.Method {
+	case "GET":
+		cfg, err := LoadConfig(s.configPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		region, ok := findRegion(cfg, code)
+		if !ok {
+			http.Error(w, "Region not found", 404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(region)
+	case "PUT":
+		var region RegionConfig
+		if !decodeJSONBody(w, r, &region) {
+			return
+		}
+		problems, err := s.editConfig(func(doc *ConfigDoc) error { return doc.UpdateRegion(code, region) })
+		if err != nil || len(problems) > 0 {
+			writeConfigEdit(w, problems, err, 0, nil)
+			return
+		}
+		cfg, _ := LoadConfig(s.configPath)
+		updated, _ := findRegion(cfg, code)
+		writeConfigEdit(w, nil, nil, 200, updated)
+	case "DELETE":
+		problems, err := s.editConfig(func(doc *ConfigDoc) error { return doc.DeleteRegion(code) })
+		if err == nil && len(problems) == 0 {
+			log.Printf("[config] Deleted region %s via API", code)
+		}
+		writeConfigEdit(w, problems, err, 204, nil)
+	default:
+		http.Error(w, "Method not allowed", 405)
+	}
+}
 
-	s.mu.Lock()
-	s.status = "Idle"
-	s.mu.Unlock()
+// handleVenues lists the configured venues (?region= for one region), or
+// on POST adds the venue in the body to its region.
+func (s *Server) handleVenues(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		cfg, err := LoadConfig(s.configPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(listVenues(cfg, r.URL.Query().Get("region")))
+	case "POST":
+		var venue ManagedVenue
+		if !decodeJSONBody(w, r, &venue) {
+			return
+		}
+		if venue.Region == "" {
+			http.Error(w, "region is required", 400)
+			return
+		}
+		problems, err := s.venueURLProblems(r.Context(), venue.VenueConfig)
+		if err == nil && len(problems) == 0 {
+			problems, err = s.editConfig(func(doc *ConfigDoc) error { return doc.AddVenue(venue.Region, venue.VenueConfig) })
+		}
+		if err == nil && len(problems) == 0 {
+			w.Header().Set("Location", "/api/venues/"+url.PathEscape(venue.Code))
+			log.Printf("[config] Added venue %s to %s via API", venue.Code, venue.Region)
+		}
+		writeConfigEdit(w, problems, err, 201, venue)
+	default:
+		http.Error(w, "Method not allowed", 405)
+	}
+}
 
+// venueURLProblems checks the pages a venue added or changed through the API
+// would be scraped from against the URL guard.
+func (s *Server) venueURLProblems(ctx context.Context, venue VenueConfig) ([]string, error) {
+	cfg, err := LoadConfig(s.configPath)
 	if err != nil {
-		log.Printf("[scrape-url] Error: %v", err)
-		http.Error(w, fmt.Sprintf("Scrape failed: %v", err), 500)
-		return
+		return nil, err
 	}
+	return urlProblems(ctx, s.urlGuard(cfg), venue), nil
+}
 
-	// Save events to custom directory
-	customDir := filepath.Join(s.dataDir, "data", "raw", "custom")
-	os.MkdirAll(customDir, 0755)
+// urlProblems lists the pages venue would be scraped from that guard
+// refuses. A host that does not resolve counts too, as the guard would
+// refuse it when scraping.
+func urlProblems(ctx context.Context, guard *URLGuard, venue VenueConfig) []string {
+	var problems []string
+	for _, u := range []struct{ field, url string }{{"calendar_url", venue.CalendarURL}, {"official_url", venue.OfficialURL}} {
+		if u.url == "" || !validHTTPURL(u.url) {
+			continue
+		}
+		if err := guard.Check(ctx, u.url); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q: %v", u.field, u.url, err))
+		}
+	}
+	return problems
+}
 
-	timestamp := time.Now().Format("20060102_150405")
-	label := req.Label
-	if label == "" {
-		label = "custom"
+// urlGuard returns a URL guard for cfg.
+func (s *Server) urlGuard(cfg Config) *URLGuard {
+	g := NewURLGuard(cfg)
+	if s.lookup != nil {
+		g.lookup = s.lookup
 	}
-	safeLabel := strings.Map(func(r rune) rune {
-		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
-			return r
-		}
-		return '_'
-	}, label)
+	return g
+}
 
-	eventsFile := filepath.Join(customDir, fmt.Sprintf("%s_%s.json", safeLabel, timestamp))
-	data, _ := json.MarshalIndent(events, "", "  ")
-	os.WriteFile(eventsFile, data, 0644)
-
-	// Update sources.json
-	sourcesFile := filepath.Join(customDir, "sources.json")
-	var sources []CustomSource
-	if existing, err := os.ReadFile(sourcesFile); err == nil {
-		json.Unmarshal(existing, &sources)
-	}
-	sources = append(sources, CustomSource{
-		URL:        req.URL,
-		Label:      req.Label,
-		ScrapedAt:  time.Now().Format(time.RFC3339),
-		EventCount: len(events),
-	})
-	sourcesData, _ := json.MarshalIndent(sources, "", "  ")
-	os.WriteFile(sourcesFile, sourcesData, 0644)
+// handleVenue returns, updates or deletes one venue. PUT replaces its
+// settings and moves it if the body names another region. POST to
+// /api/venues/{code}/test previews a scrape of it.
+func (s *Server) handleVenue(w http.ResponseWriter, r *http.Request) {
+	code, ok := pathID(r, "/api/venues/")
+	if !ok {
+		http.Error(w, "Venue not found", 404)
+		return
+	}
+	if strings.HasSuffix(code, "/test") {
+		s.handleVenueTest(w, r, strings.TrimSuffix(code, "/test"))
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"events":   events,
-		"strategy": strategy,
-		"count":    len(events),
-		"saved_to": eventsFile,
-	})
+	switch r.Method {
+	case "GET":
+		cfg, err := LoadConfig(s.configPath)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		venue, ok := findVenue(cfg, code)
+		if !ok {
+			http.Error(w, "Venue not found", 404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(venue)
+	case "PUT":
+		var venue ManagedVenue
+		if !decodeJSONBody(w, r, &venue) {
+			return
+		}
+		problems, err := s.venueURLProblems(r.Context(), venue.VenueConfig)
+		if err == nil && len(problems) == 0 {
+			problems, err = s.editConfig(func(doc *ConfigDoc) error { return doc.UpdateVenue(code, venue.Region, venue.VenueConfig) })
+		}
+		if err != nil || len(problems) > 0 {
+			writeConfigEdit(w, problems, err, 0, nil)
+			return
+		}
+		cfg, _ := LoadConfig(s.configPath)
+		updated, _ := findVenue(cfg, code)
+		writeConfigEdit(w, nil, nil, 200, updated)
+	case "DELETE":
+		problems, err := s.editConfig(func(doc *ConfigDoc) error { return doc.DeleteVenue(code) })
+		if err == nil && len(problems) == 0 {
+			log.Printf("[config] Deleted venue %s via API", code)
+		}
+		writeConfigEdit(w, problems, err, 204, nil)
+	default:
+		http.Error(w, "Method not allowed", 405)
+	}
 }
 
-func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
+// VenuePreview is what a test scrape of a venue found, none of it saved.
+type VenuePreview struct {
+	Venue     ManagedVenue       `json:"venue"`
+	URL       string             `json:"url"`
+	Run       VenueRun           `json:"run"`
+	Events    []PerformanceEvent `json:"events"`
+	Rejected  []PerformanceEvent `json:"rejected"`
+	Threshold float64            `json:"threshold"`
+}
+
+// handleVenueTest fetches a venue's calendar page, runs its parser and
+// returns what would be saved, without saving it. A venue in the body is
+// tried in place of the configured one, so a venue can be tried before it
+// is added. ?fresh=true bypasses the HTML cache.
+func (s *Server) handleVenueTest(w http.ResponseWriter, r *http.Request, code string) {
+	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
+	if s.browser == nil {
+		http.Error(w, "Browser not available. Restart server to retry.", 503)
+		return
+	}
 
-	regionFilter := r.URL.Query().Get("region")
-	var allEvents []PerformanceEvent
-
-	// Scan regional directories
-	regionalDir := filepath.Join(s.dataDir, "data", "raw", "regional")
-	if regions, err := os.ReadDir(regionalDir); err == nil {
-		for _, region := range regions {
-			if !region.IsDir() {
-				continue
-			}
-			if regionFilter != "" && region.Name() != regionFilter {
-				continue
-			}
-			regionPath := filepath.Join(regionalDir, region.Name())
-			files, _ := os.ReadDir(regionPath)
-			for _, f := range files {
-				if !strings.HasSuffix(f.Name(), ".json") {
-					continue
-				}
-				data, err := os.ReadFile(filepath.Join(regionPath, f.Name()))
-				if err != nil {
-					continue
-				}
-				var events []PerformanceEvent
-				if err := json.Unmarshal(data, &events); err != nil {
-					continue
-				}
-				for i := range events {
-					if events[i].Region == "" {
-						events[i].Region = region.Name()
-					}
-				}
-				allEvents = append(allEvents, events...)
-			}
+	cfg, err := LoadConfig(s.configPath)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", 413)
+			return
+		}
+		http.Error(w, "Failed to read request body", 400)
+		return
+	}
+	venue, found := findVenue(cfg, code)
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &venue); err != nil {
+			http.Error(w, "Invalid JSON body", 400)
+			return
 		}
+		venue.Code = code
+	} else if !found {
+		http.Error(w, "Venue not found", 404)
+		return
+	}
+	targetURL := venue.CalendarURL
+	if targetURL == "" {
+		targetURL = venue.OfficialURL
+	}
+	if !validHTTPURL(targetURL) {
+		http.Error(w, "Venue needs an http(s) calendar_url or official_url", 400)
+		return
+	}
+	guard := s.urlGuard(cfg)
+	if err := guard.Check(r.Context(), targetURL); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
 	}
 
-	// Scan custom directory
-	if regionFilter == "" || regionFilter == "custom" {
-		customDir := filepath.Join(s.dataDir, "data", "raw", "custom")
-		if files, err := os.ReadDir(customDir); err == nil {
-			for _, f := range files {
-				if f.Name() == "sources.json" || !strings.HasSuffix(f.Name(), ".json") {
-					continue
-				}
-				data, err := os.ReadFile(filepath.Join(customDir, f.Name()))
-				if err != nil {
-					continue
-				}
-				var events []PerformanceEvent
-				if err := json.Unmarshal(data, &events); err != nil {
-					continue
-				}
-				for i := range events {
-					if events[i].Region == "" {
-						events[i].Region = "custom"
-					}
-				}
-				allEvents = append(allEvents, events...)
-			}
-		}
+	ttl := cfg.Scraping.Cache.TTLHours
+	if r.URL.Query().Get("fresh") == "true" {
+		ttl = 0
 	}
+	cacheDir := filepath.Join(s.dataDir, "data", "raw", "html")
+	os.MkdirAll(cacheDir, 0755)
+	cache := NewHTMLCache(cacheDir, ttl)
+	graph := s.graphIndex()
+	scorer := NewConfidenceScorer(graph.Matcher, cfg.Scraping.GenericParser.MinConfidence)
 
-	if allEvents == nil {
-		allEvents = []PerformanceEvent{}
+	ticket, err := s.browserQueue.Join()
+	if err != nil {
+		tooManyRequests(w, browserRetryAfter)
+		return
+	}
+	defer ticket.Done()
+	liftWriteTimeout(w)
+	if err := ticket.Wait(r.Context()); err != nil {
+		return
+	}
+	log.Printf("[%s] Test scrape via API", venue.Code)
+	run := newVenueRun()
+	events, err := scrapeVenue(venue.VenueConfig, venue.Region, NewDomainLimiter(cfg), cache, NewRobotsGuard(cfg.Scraping.RobotsRespect), s.browser, guard, false, s.dataDir, &run, nil)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	scorer.ScoreAll(events)
+	events, rejected := scorer.Split(events)
+	annotateMatches(events, graph.Matcher)
+	graph.Composers.ResolveComposers(events)
+	run.Events, run.Rejected = len(events), len(rejected)
+	run.Strategy = runStrategy(run.Parser, events)
+	if events == nil {
+		events = []PerformanceEvent{}
+	}
+	if rejected == nil {
+		rejected = []PerformanceEvent{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(allEvents)
+	json.NewEncoder(w).Encode(VenuePreview{
+		Venue:     venue,
+		URL:       targetURL,
+		Run:       run,
+		Events:    events,
+		Rejected:  rejected,
+		Threshold: scorer.Threshold,
+	})
 }
 
-func (s *Server) handleSources(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
+// handleConfigValidate checks the YAML in the body as PUT /api/config
+// would, without saving it.
+func (s *Server) handleConfigValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
-
-	sourcesFile := filepath.Join(s.dataDir, "data", "raw", "custom", "sources.json")
-	data, err := os.ReadFile(sourcesFile)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte("[]"))
+	data, ok := readConfigBody(w, r)
+	if !ok {
 		return
 	}
+	_, problems := ParseConfig(data)
+	writeConfigValidation(w, 200, problems)
+}
+
+func readConfigBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxConfigBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read request body", 400)
+		return nil, false
+	}
+	if len(data) > maxConfigBytes {
+		http.Error(w, "Config too large", 413)
+		return nil, false
+	}
+	return data, true
+}
+
+func writeConfigValidation(w http.ResponseWriter, code int, problems []string) {
+	if problems == nil {
+		problems = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(ConfigValidation{Valid: len(problems) == 0, Errors: problems})
+}
+
+// applyConfig brings the parts of the server that hold on to the config up
+// to date. Everything else reads config.yaml afresh for each scrape.
+func (s *Server) applyConfig(cfg Config) error {
+	s.auth.Configure(cfg.Auth, filepath.Dir(s.configPath))
+	s.corsMu.Lock()
+	s.origins = cfg.Server.override(s.serverFlags).AllowedOrigins
+	s.corsMu.Unlock()
+	s.limitMu.Lock()
+	s.limits = newAPILimits(cfg.Server.RateLimit)
+	s.limitMu.Unlock()
+	if err := s.scheduler.Configure(cfg, time.Now()); err != nil {
+		return err
+	}
+	if cfg.Scheduler.Enabled {
+		log.Printf("Scheduler enabled with %d schedules", len(s.scheduler.Status().Entries))
+	}
+	return nil
+}
+
+// handleStatus reports "Running" while a job runs, "Error" if the last job
+// failed, and "Idle" otherwise, with the job in question and the next and
+// last run of each schedule.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := "Idle"
+	job, ok := s.jobs.Active()
+	if ok {
+		status = "Running"
+	} else if job, ok = s.jobs.Latest(); ok && (job.State == JobFailed || job.State == JobInterrupted) {
+		status = "Error"
+	}
+
+	resp := map[string]interface{}{"status": status, "scheduler": s.scheduler.Status(), "browser_queue": s.browserQueue.Depth()}
+	if ok {
+		resp["job"] = job
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleScrape starts a scrape job for the regions and venues in the
+// request body (all of them if it is empty) and returns the job.
+func (s *Server) handleScrape(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	var req ScrapeRequest
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", 413)
+			return
+		}
+		http.Error(w, "Failed to read request body", 400)
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "Invalid JSON body", 400)
+			return
+		}
+	}
+
+	cfg, err := LoadConfig(s.configPath)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	targets, err := scrapeTargets(cfg, req)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if len(targets) == 0 {
+		http.Error(w, "No venues selected", 400)
+		return
+	}
+
+	job, err := s.startScrape(req, targets)
+	if err != nil {
+		http.Error(w, "Scraper already running", 409)
+		return
+	}
+	log.Printf("Scrape job %s started via API (%d venues)", job.ID, len(targets))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(202)
+	json.NewEncoder(w).Encode(job)
+}
+
+// startScrape starts a scrape job over targets in the background.
+func (s *Server) startScrape(req ScrapeRequest, targets []scrapeTarget) (Job, error) {
+	job, ctx, err := s.jobs.Start("scrape", req, "", targets)
+	if err != nil {
+		return Job{}, err
+	}
+	go func() {
+		err := RunScrapeContext(ctx, s.configPath, s.dataDir, req, false, s.jobs.Observer(job.ID))
+		s.events.Refresh()
+		if err != nil {
+			log.Printf("Scrape job %s: %v", job.ID, err)
+		}
+		s.jobs.Finish(job.ID, err)
+	}()
+	return job, nil
+}
+
+// startScheduledScrape is how the scheduler starts a scrape, reading the
+// config afresh as an API scrape would.
+func (s *Server) startScheduledScrape(req ScrapeRequest) (Job, error) {
+	if req.Source != "" {
+		return s.rescrapeSource(req.Source, req.Schedule)
+	}
+	cfg, err := LoadConfig(s.configPath)
+	if err != nil {
+		return Job{}, err
+	}
+	targets, err := scrapeTargets(cfg, req)
+	if err != nil {
+		return Job{}, err
+	}
+	if len(targets) == 0 {
+		return Job{}, fmt.Errorf("no venues selected")
+	}
+	return s.startScrape(req, targets)
+}
+
+// handleJobs lists scrape jobs, newest first.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.jobs.List())
+}
+
+// handleJob returns one job, or cancels it on DELETE.
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "/api/jobs/")
+	if !ok {
+		http.Error(w, "Job not found", 404)
+		return
+	}
+	if strings.HasSuffix(id, "/events") {
+		s.handleJobEvents(w, r, strings.TrimSuffix(id, "/events"))
+		return
+	}
+
+	var job Job
+	switch r.Method {
+	case "GET":
+		if job, ok = s.jobs.Get(id); !ok {
+			http.Error(w, "Job not found", 404)
+			return
+		}
+	case "DELETE":
+		var err error
+		job, err = s.jobs.Cancel(id)
+		if err == errJobNotFound {
+			http.Error(w, "Job not found", 404)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Job is %s", job.State), 409)
+			return
+		}
+		log.Printf("Scrape job %s cancelled via API", id)
+		w.WriteHeader(202)
+	default:
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// sseHeartbeat is how often an idle event stream sends a comment so
+// proxies do not time it out.
+const sseHeartbeat = 15 * time.Second
+
+// startSSE sets up w for a Server-Sent Events stream.
+func startSSE(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", 500)
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	liftWriteTimeout(w)
+	flusher.Flush()
+	return flusher, true
+}
+
+// liftWriteTimeout exempts a response from the server's write timeout, for
+// streams and for handlers that wait on the browser.
+func liftWriteTimeout(w http.ResponseWriter) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
+
+func writeSSE(w io.Writer, id, event, data string) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+func writeProgressSSE(w io.Writer, p ScrapeProgress) {
+	data, _ := json.Marshal(p)
+	writeSSE(w, strconv.Itoa(p.Seq), p.Type, string(data))
+}
+
+// handleJobEvents streams a job's progress as Server-Sent Events, one event
+// per step named by its type, ending with job_finished. Reconnecting
+// clients resume after their Last-Event-ID.
+func (s *Server) handleJobEvents(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	after := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		after, _ = strconv.Atoi(v)
+	}
+	backlog, events, unsubscribe, err := s.jobs.Subscribe(id, after)
+	if err != nil {
+		http.Error(w, "Job not found", 404)
+		return
+	}
+	defer unsubscribe()
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+	for _, p := range backlog {
+		writeProgressSSE(w, p)
+	}
+	flusher.Flush()
+	if events == nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case p, ok := <-events:
+			if !ok {
+				// Finished, or this client fell behind and should reconnect.
+				return
+			}
+			writeProgressSSE(w, p)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleLogs returns the server's recent log lines (?lines=, default 200),
+// or with ?follow=true streams them and every new line as Server-Sent
+// Events named "log".
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	n := defaultLogLines
+	if v := r.URL.Query().Get("lines"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 || parsed > maxLogLines {
+			http.Error(w, fmt.Sprintf("lines must be between 0 and %d", maxLogLines), 400)
+			return
+		}
+		n = parsed
+	}
+
+	if r.URL.Query().Get("follow") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"lines": s.logs.Lines(n)})
+		return
+	}
+
+	tail, lines, unfollow := s.logs.Follow(n)
+	defer unfollow()
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+	for _, line := range tail {
+		writeSSE(w, "", "log", line)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			writeSSE(w, "", "log", line)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Limits on what /api/scrape-url accepts.
+const (
+	maxJSONBodyBytes = 64 << 10
+	maxURLLength     = 2048
+)
+
+// handleScrapeURL scrapes one URL with the generic parser as a job and
+// returns what it found. The URL is kept as a custom source, one per
+// canonical URL, so it can be re-scraped, scheduled or promoted later.
+func (s *Server) handleScrapeURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", 413)
+			return
+		}
+		http.Error(w, "Failed to read request body", 400)
+		return
+	}
+	defer r.Body.Close()
+
+	var req struct {
+		URL           string   `json:"url"`
+		Label         string   `json:"label"`
+		MinConfidence *float64 `json:"min_confidence"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON body", 400)
+		return
+	}
+
+	if req.URL == "" {
+		http.Error(w, "URL is required", 400)
+		return
+	}
+	if len(req.URL) > maxURLLength {
+		http.Error(w, "URL is too long", 400)
+		return
+	}
+	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
+		req.URL = "https://" + req.URL
+	}
+	cfg, err := LoadConfig(s.configPath)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if err := s.urlGuard(cfg).Check(r.Context(), req.URL); err != nil {
+		log.Printf("[scrape-url] Refused %s: %v", req.URL, err)
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if s.browser == nil {
+		http.Error(w, "Browser not available. Restart server to retry.", 503)
+		return
+	}
+	ticket, err := s.browserQueue.Join()
+	if err != nil {
+		tooManyRequests(w, browserRetryAfter)
+		return
+	}
+	defer ticket.Done()
+	liftWriteTimeout(w)
+	if err := ticket.Wait(r.Context()); err != nil {
+		return
+	}
+
+	job, ctx, err := s.startSourceJob(ScrapeRequest{}, req.URL, req.Label)
+	if err != nil {
+		http.Error(w, "Scraper already running", 409)
+		return
+	}
+	result, err := s.scrapeSource(ctx, job, req.URL, req.Label, req.MinConfidence)
+	s.jobs.Finish(job.ID, err)
+	if err != nil {
+		if err == context.Canceled {
+			http.Error(w, "Scrape cancelled", 409)
+			return
+		}
+		log.Printf("[scrape-url] Error: %v", err)
+		http.Error(w, fmt.Sprintf("Scrape failed: %v", err), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events":    result.Events,
+		"rejected":  result.Rejected,
+		"threshold": result.Threshold,
+		"strategy":  result.Strategy,
+		"count":     len(result.Events),
+		"saved_to":  result.SavedTo,
+		"job_id":    job.ID,
+		"source":    result.Source,
+	})
+}
+
+// sourceLabel is the name a source's scrapes go by in jobs and progress.
+func sourceLabel(label string) string {
+	if label == "" {
+		return "custom"
+	}
+	return label
+}
+
+// startSourceJob registers a scrape-url job for one URL.
+func (s *Server) startSourceJob(req ScrapeRequest, rawURL, label string) (Job, context.Context, error) {
+	target := scrapeTarget{Region: RegionConfig{Code: "custom"}, Venue: VenueConfig{Code: sourceLabel(label)}}
+	return s.jobs.Start("scrape-url", req, rawURL, []scrapeTarget{target})
+}
+
+// SourceScrape is what one scrape of a custom source found.
+type SourceScrape struct {
+	Source    CustomSource
+	Events    []PerformanceEvent
+	Rejected  []PerformanceEvent
+	Threshold float64
+	Strategy  string
+	SavedTo   string
+}
+
+// scrapeSource scrapes rawURL as the given job, saves the events scoring at
+// least the confidence threshold (minConfidence if not nil, else the
+// configured one) and records the scrape on the URL's source. The caller
+// finishes the job.
+func (s *Server) scrapeSource(ctx context.Context, job Job, rawURL, label string, minConfidence *float64) (SourceScrape, error) {
+	canonical, err := canonicalURL(rawURL)
+	if err != nil {
+		return SourceScrape{}, fmt.Errorf("invalid URL: %s", rawURL)
+	}
+	cfg, err := LoadConfig(s.configPath)
+	if err != nil {
+		return SourceScrape{}, err
+	}
+	graph := s.graphIndex()
+	scorer := NewConfidenceScorer(graph.Matcher, cfg.Scraping.GenericParser.MinConfidence)
+	if minConfidence != nil {
+		scorer.Threshold = *minConfidence
+	}
+
+	observer := s.jobs.Observer(job.ID)
+	venue := sourceLabel(label)
+	report(observer, ScrapeProgress{Type: ProgressVenueStarted, Region: "custom", Venue: venue})
+
+	events, strategy, err := ScrapeURL(rawURL, s.browser, s.urlGuard(cfg), scorer, graph.Composers)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		report(observer, ScrapeProgress{Type: ProgressVenueFinished, Region: "custom", Venue: venue, Error: err.Error()})
+		return SourceScrape{}, err
+	}
+
+	// Only events at or above the threshold are saved; the rest are
+	// returned so the caller can review them.
+	events, rejected := scorer.Split(events)
+	if events == nil {
+		events = []PerformanceEvent{}
+	}
+	if rejected == nil {
+		rejected = []PerformanceEvent{}
+	}
+
+	id := sourceID(canonical)
+	if src, ok := s.sources.Get(id); ok {
+		if label == "" {
+			label = src.Label
+		}
+		src.apply(events)
+	}
+	for i := range events {
+		events[i].SourceID = id
+	}
+	NewFirstSeenStore(s.dataDir).Stamp(events)
+
+	// Save events to custom directory, named after the source
+	customDir := filepath.Join(s.dataDir, "data", "raw", "custom")
+	now := time.Now()
+	eventsFile := filepath.Join(customDir, fmt.Sprintf("%s_%s.json", id, now.Format("20060102_150405")))
+	data, _ := json.MarshalIndent(events, "", "  ")
+	err = os.MkdirAll(customDir, 0755)
+	if err == nil {
+		err = os.WriteFile(eventsFile, data, 0644)
+	}
+	if err != nil {
+		err = fmt.Errorf("saving events: %w", err)
+		report(observer, ScrapeProgress{Type: ProgressVenueFinished, Region: "custom", Venue: venue, Error: err.Error()})
+		return SourceScrape{}, err
+	}
+
+	src, err := s.sources.Record(rawURL, label, len(events), filepath.Base(eventsFile), now.Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Failed to save sources: %v", err)
+	}
+	s.events.Refresh()
+
+	report(observer, ScrapeProgress{Type: ProgressVenueFinished, Region: "custom", Venue: venue, Events: len(events), Rejected: len(rejected)})
+	return SourceScrape{
+		Source:    src,
+		Events:    events,
+		Rejected:  rejected,
+		Threshold: scorer.Threshold,
+		Strategy:  strategy,
+		SavedTo:   eventsFile,
+	}, nil
+}
+
+// rescrapeSource starts a background job re-scraping a custom source.
+func (s *Server) rescrapeSource(id, schedule string) (Job, error) {
+	src, ok := s.sources.Get(id)
+	if !ok {
+		return Job{}, errSourceNotFound
+	}
+	if s.browser == nil {
+		return Job{}, errors.New("browser not available")
+	}
+	ticket, err := s.browserQueue.Join()
+	if err != nil {
+		return Job{}, err
+	}
+	job, ctx, err := s.startSourceJob(ScrapeRequest{Schedule: schedule, Source: id}, src.URL, src.Label)
+	if err != nil {
+		ticket.Done()
+		return Job{}, err
+	}
+	go func() {
+		defer ticket.Done()
+		err := ticket.Wait(ctx)
+		if err == nil {
+			_, err = s.scrapeSource(ctx, job, src.URL, src.Label, nil)
+		}
+		if err != nil {
+			log.Printf("Scrape job %s: %v", job.ID, err)
+		}
+		s.jobs.Finish(job.ID, err)
+	}()
+	return job, nil
+}
+
+// handleEvents returns one page of stored events, filtered and sorted as
+// described by ParseEventQuery, or an export when ?format= is given.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	if format := r.URL.Query().Get("format"); format != "" && format != "json" {
+		s.handleEventsExport(w, r, format)
+		return
+	}
+
+	query, err := ParseEventQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if s.notModified(w, r) {
+		return
+	}
+	page, err := query.Page(s.events.Select(query.Filter))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// notModified sets the ETag of an event response and answers 304 if the
+// client already has it. The tag covers the stored events, the request and
+// today's date, since "upcoming" moves with it.
+func (s *Server) notModified(w http.ResponseWriter, r *http.Request) bool {
+	etag := s.events.ETag(r.URL.Path, r.URL.RawQuery, time.Now().Format(queryDateLayout))
+	w.Header().Set("ETag", etag)
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "W/")); tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// handleEvent returns one stored event by the ID in its URL, e.g.
+// /api/events/laopera:tosca-2026, with its scrape history.
+func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	id, ok := pathID(r, "/api/events/")
+	if !ok {
+		http.Error(w, "Event not found", 404)
+		return
+	}
+	if s.notModified(w, r) {
+		return
+	}
+	detail, ok := s.events.Event(id)
+	if !ok {
+		http.Error(w, "Event not found", 404)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// handleProduction returns all dates of one production, as named by an
+// event's production_id, with its matched graph node, source pages and
+// scrape history.
+func (s *Server) handleProduction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	id, ok := pathID(r, "/api/productions/")
+	if !ok {
+		http.Error(w, "Production not found", 404)
+		return
+	}
+	production, ok := s.events.Production(id)
+	if !ok {
+		http.Error(w, "Production not found", 404)
+		return
+	}
+	if node, ok := s.graphIndex().Nodes[production.MatchedOperaKey]; ok {
+		production.Opera = &node
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(production)
+}
+
+// pathID returns the unescaped remainder of the request path after prefix,
+// so IDs may contain escaped slashes.
+func pathID(r *http.Request, prefix string) (string, bool) {
+	id, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), prefix))
+	if err != nil || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// handleEventsExport serves the latest snapshot of each stored event as a
+// CSV (one row per performance date), Parquet or iCalendar download.
+func (s *Server) handleEventsExport(w http.ResponseWriter, r *http.Request, format string) {
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("format must be one of %v", exportFormats), 400)
+		return
+	}
+
+	if s.notModified(w, r) {
+		return
+	}
+	filter := ParseEventFilter(r.URL.Query())
+	events := s.events.Select(filter)
+
+	// Buffer so that a failed export is a 500 rather than a truncated file.
+	var buf bytes.Buffer
+	if err := WriteEvents(&buf, format, filter, events); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="events.%s"`, format))
+	w.Write(buf.Bytes())
+}
+
+// handleEventsICS serves stored events as an iCalendar feed, filtered by
+// region, venue, composer and matched opera.
+func (s *Server) handleEventsICS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	if s.notModified(w, r) {
+		return
+	}
+	filter := ParseEventFilter(r.URL.Query())
+	events := s.events.Select(filter)
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = filter.CalendarName()
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="events.ics"`)
+	if err := WriteICalendar(w, name, events); err != nil {
+		log.Printf("[events.ics] Write failed: %v", err)
+	}
+}
+
+// handleFeedAtom serves newly announced events, newest first, as an Atom
+// feed. The same filters as /api/events.ics select per-region or per-venue
+// variants.
+func (s *Server) handleFeedAtom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	limit := defaultFeedLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxFeedLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxFeedLimit), 400)
+			return
+		}
+		limit = parsed
+	}
+
+	if s.notModified(w, r) {
+		return
+	}
+	filter := ParseEventFilter(r.URL.Query())
+	events := newlyAnnounced(s.events.Select(filter), limit)
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	selfURL := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.RequestURI())
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if err := WriteAtomFeed(w, feedVariant(filter), filter.CalendarName()+" – newly announced", selfURL, events); err != nil {
+		log.Printf("[feed.atom] Write failed: %v", err)
+	}
+}
+
+// handleSources lists the custom sources, most recently scraped first.
+func (s *Server) handleSources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.sources.List())
+}
+
+// SourceUpdate is the body of PUT /api/sources/{id}.
+type SourceUpdate struct {
+	Label    string `json:"label"`
+	Region   string `json:"region"`
+	City     string `json:"city"`
+	State    string `json:"state"`
+	Schedule string `json:"schedule"`
+}
+
+// handleSource returns, updates or deletes one custom source. PUT replaces
+// its label, region, location and refresh schedule; DELETE also removes the
+// events scraped from it. POST to /api/sources/{id}/scrape re-scrapes it
+// and to /api/sources/{id}/promote turns it into a configured venue.
+func (s *Server) handleSource(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "/api/sources/")
+	if !ok {
+		http.Error(w, "Source not found", 404)
+		return
+	}
+	if strings.HasSuffix(id, "/scrape") {
+		s.handleSourceScrape(w, r, strings.TrimSuffix(id, "/scrape"))
+		return
+	}
+	if strings.HasSuffix(id, "/promote") {
+		s.handleSourcePromote(w, r, strings.TrimSuffix(id, "/promote"))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		src, ok := s.sources.Get(id)
+		if !ok {
+			http.Error(w, "Source not found", 404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(src)
+	case "PUT":
+		var update SourceUpdate
+		if !decodeJSONBody(w, r, &update) {
+			return
+		}
+		if update.Region != "" {
+			cfg, err := LoadConfig(s.configPath)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			region, ok := findRegion(cfg, update.Region)
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown region %q", update.Region), 400)
+				return
+			}
+			update.Region = region.Code
+		}
+		if err := checkSchedule(update.Schedule); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		src, err := s.sources.Update(id, func(src *CustomSource) error {
+			src.Label, src.Region, src.City, src.State, src.Schedule = update.Label, update.Region, update.City, update.State, update.Schedule
+			return nil
+		})
+		if err == errSourceNotFound {
+			http.Error(w, "Source not found", 404)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		s.scheduler.SetSources(s.sources.List(), time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(src)
+	case "DELETE":
+		src, err := s.sources.Delete(id)
+		if err == errSourceNotFound {
+			http.Error(w, "Source not found", 404)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		s.events.Refresh()
+		s.scheduler.SetSources(s.sources.List(), time.Now())
+		log.Printf("Deleted source %s (%s) and %d event files via API", src.ID, src.URL, len(src.Files))
+		w.WriteHeader(204)
+	default:
+		http.Error(w, "Method not allowed", 405)
+	}
+}
+
+// handleSourceScrape re-scrapes a custom source as a background job and
+// returns the job.
+func (s *Server) handleSourceScrape(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	job, err := s.rescrapeSource(id, "")
+	switch {
+	case err == errSourceNotFound:
+		http.Error(w, "Source not found", 404)
+		return
+	case err == errJobRunning:
+		http.Error(w, "Scraper already running", 409)
+		return
+	case err == errBrowserBusy:
+		tooManyRequests(w, browserRetryAfter)
+		return
+	case err != nil:
+		http.Error(w, "Browser not available. Restart server to retry.", 503)
+		return
+	}
+	log.Printf("Scrape job %s started via API for source %s", job.ID, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(202)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleSourcePromote adds a custom source to config.yaml as a venue in the
+// region given in the body (or the source's region), scraping its URL as
+// the calendar page. The code is required; the name, city and state
+// default to the source's. The source keeps its events but loses its
+// refresh schedule, since the venue is scraped from then on.
+func (s *Server) handleSourcePromote(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	src, ok := s.sources.Get(id)
+	if !ok {
+		http.Error(w, "Source not found", 404)
+		return
+	}
+	var venue ManagedVenue
+	if !decodeJSONBody(w, r, &venue) {
+		return
+	}
+	if venue.Region == "" {
+		venue.Region = src.Region
+	}
+	if venue.Region == "" {
+		http.Error(w, "region is required", 400)
+		return
+	}
+	if venue.Code == "" {
+		http.Error(w, "code is required", 400)
+		return
+	}
+	if venue.Name == "" {
+		venue.Name = src.Label
+	}
+	if venue.City == "" {
+		venue.City = src.City
+	}
+	if venue.State == "" {
+		venue.State = src.State
+	}
+	if venue.CalendarURL == "" {
+		venue.CalendarURL = src.URL
+	}
+	if venue.OfficialURL == "" {
+		if u, err := url.Parse(src.URL); err == nil {
+			venue.OfficialURL = u.Scheme + "://" + u.Host
+		}
+	}
+
+	problems, err := s.venueURLProblems(r.Context(), venue.VenueConfig)
+	if err == nil && len(problems) == 0 {
+		problems, err = s.editConfig(func(doc *ConfigDoc) error { return doc.AddVenue(venue.Region, venue.VenueConfig) })
+	}
+	if err != nil || len(problems) > 0 {
+		writeConfigEdit(w, problems, err, 0, nil)
+		return
+	}
+	if _, err := s.sources.Update(id, func(src *CustomSource) error {
+		src.PromotedTo = venue.Code
+		src.Schedule = ""
+		return nil
+	}); err != nil {
+		log.Printf("Failed to mark source %s promoted: %v", id, err)
+	}
+	s.scheduler.SetSources(s.sources.List(), time.Now())
+	log.Printf("[config] Promoted source %s to venue %s in %s via API", id, venue.Code, venue.Region)
+
+	w.Header().Set("Location", "/api/venues/"+url.PathEscape(venue.Code))
+	writeConfigEdit(w, nil, nil, 201, venue)
+}
+
+func (s *Server) handleVenueHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	statusFilter := r.URL.Query().Get("status")
+	venues := []VenueHealth{}
+	for _, vh := range loadVenueHealth(s.dataDir) {
+		if statusFilter != "" && vh.Status != statusFilter {
+			continue
+		}
+		venues = append(venues, vh)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(venues)
+}
+
+// maxMatchResults caps ?n= on /api/match.
+const maxMatchResults = 50
+
+// handleMatch returns the top-N known operas for ?title=, e.g. to let a user
+// pick the right graph node for a scraped event.
+func (s *Server) handleMatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	title := r.URL.Query().Get("title")
+	if title == "" {
+		http.Error(w, "title is required", 400)
+		return
+	}
+	n := 5
+	if v := r.URL.Query().Get("n"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxMatchResults {
+			http.Error(w, fmt.Sprintf("n must be between 1 and %d", maxMatchResults), 400)
+			return
+		}
+		n = parsed
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"title":      title,
+		"normalized": normalizeTitle(title),
+		"matches":    s.graphIndex().Matcher.Match(title, n),
+	})
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+// handleSearch finds events, venues and graph nodes matching ?q=, with
+// prefix and typo-tolerant matching. ?type= restricts the result types.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		http.Error(w, "q is required", 400)
+		return
+	}
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit), 400)
+			return
+		}
+		limit = parsed
+	}
+	types := splitFilterValues(r.URL.Query()["type"])
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   q,
+		"results": s.searchIndex().Search(q, types, limit),
+	})
+}
+
+// searchIndex returns the search index, rebuilding it when the stored
+// events or the graph have changed since it was built.
+func (s *Server) searchIndex() *SearchIndex {
+	graph := s.graphIndex()
+	version := s.events.Version()
+
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+	if s.search == nil || s.searchVersion != version || s.searchGraph != graph {
+		s.search = NewSearchIndex(s.events.Select(EventFilter{}), graph)
+		s.searchVersion = version
+		s.searchGraph = graph
+	}
+	return s.search
+}
+
+// graphIndex returns the lookups over graph.json, rebuilding them only when
+// the graph file has changed since they were last built.
+func (s *Server) graphIndex() *GraphIndex {
+	s.graphMu.Lock()
+	defer s.graphMu.Unlock()
+
+	var modTime time.Time
+	if info, err := os.Stat(graphPath(s.dataDir)); err == nil {
+		modTime = info.ModTime()
+	}
+	if s.graph == nil || !modTime.Equal(s.graphModTime) {
+		s.graph = LoadGraphIndex(s.dataDir)
+		s.graphModTime = modTime
+	}
+	return s.graph
+}
+
+// cors lets the origins in server.allowed_origins call the API from the
+// browser. Requests from other origins get no CORS headers, so browsers
+// only let the server's own pages read the responses.
+func (s *Server) cors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		s.corsMu.RLock()
+		allow := corsOrigin(s.origins, r.Header.Get("Origin"))
+		s.corsMu.RUnlock()
+		if allow != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allow)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Last-Event-ID, If-Match, Authorization")
+			if allow != "*" {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		w.Header().Add("Vary", "Origin")
 		if r.Method == "OPTIONS" {
-			w.WriteHeader(200)
+			w.WriteHeader(204)
 			return
 		}
 		next.ServeHTTP(w, r)
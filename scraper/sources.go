@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var errSourceNotFound = errors.New("source not found")
+
+// CustomSource is a user-provided URL scraped through /api/scrape-url. One
+// source is kept per canonical URL however often it is scraped.
+type CustomSource struct {
+	ID           string `json:"id"`
+	URL          string `json:"url"`
+	CanonicalURL string `json:"canonical_url"`
+	Label        string `json:"label"`
+	// Given to the source's events from its next scrape on.
+	Region string `json:"region,omitempty"`
+	City   string `json:"city,omitempty"`
+	State  string `json:"state,omitempty"`
+	// Cron expression for scheduled re-scrapes, if any.
+	Schedule       string   `json:"schedule,omitempty"`
+	ScrapedAt      string   `json:"scraped_at"`
+	FirstScrapedAt string   `json:"first_scraped_at,omitempty"`
+	EventCount     int      `json:"event_count"`
+	ScrapeCount    int      `json:"scrape_count"`
+	Files          []string `json:"files,omitempty"` // event files in data/raw/custom
+	PromotedTo     string   `json:"promoted_to,omitempty"`
+}
+
+// apply fills in the region, location and venue name the source was given
+// on events scraped from it.
+func (src CustomSource) apply(events []PerformanceEvent) {
+	for i := range events {
+		if src.Region != "" {
+			events[i].Region = src.Region
+		}
+		if events[i].City == "" {
+			events[i].City = src.City
+		}
+		if events[i].State == "" {
+			events[i].State = src.State
+		}
+		if events[i].VenueName == "" {
+			events[i].VenueName = src.Label
+		}
+	}
+}
+
+// trackingParams are query parameters that do not change the page.
+var trackingParams = map[string]bool{"fbclid": true, "gclid": true, "mc_cid": true, "mc_eid": true, "ref": true}
+
+// canonicalURL normalises a URL so that the same page given slightly
+// differently maps to one source: the scheme and host are lowercased, "www."
+// and default ports dropped, tracking parameters and the fragment removed,
+// the query sorted and a trailing slash trimmed. http and https are treated
+// as the same page.
+func canonicalURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", errors.New("not an http(s) URL")
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") || trackingParams[strings.ToLower(key)] {
+			query.Del(key)
+		}
+	}
+	path := strings.TrimRight(u.EscapedPath(), "/")
+
+	canonical := "https://" + host + path
+	if len(query) > 0 {
+		canonical += "?" + query.Encode() // Encode sorts by key
+	}
+	return canonical, nil
+}
+
+// sourceID is a short stable ID for a canonical URL.
+func sourceID(canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:6])
+}
+
+// SourceStore keeps the custom sources in data/raw/custom/sources.json.
+type SourceStore struct {
+	mu   sync.Mutex
+	dir  string
+	path string
+}
+
+func NewSourceStore(dataDir string) *SourceStore {
+	dir := filepath.Join(dataDir, "data", "raw", "custom")
+	return &SourceStore{dir: dir, path: filepath.Join(dir, "sources.json")}
+}
+
+// List returns the sources, most recently scraped first.
+func (st *SourceStore) List() []CustomSource {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sources := st.load()
+	sort.SliceStable(sources, func(i, j int) bool {
+		return storedTime(sources[i].ScrapedAt).After(storedTime(sources[j].ScrapedAt))
+	})
+	return sources
+}
+
+func (st *SourceStore) Get(id string) (CustomSource, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, src := range st.load() {
+		if src.ID == id {
+			return src, true
+		}
+	}
+	return CustomSource{}, false
+}
+
+// Lookup returns the source for a URL, if it has been scraped before.
+func (st *SourceStore) Lookup(rawURL string) (CustomSource, bool) {
+	canonical, err := canonicalURL(rawURL)
+	if err != nil {
+		return CustomSource{}, false
+	}
+	return st.Get(sourceID(canonical))
+}
+
+// Update changes the source with the given ID with fn and saves it, unless
+// fn fails.
+func (st *SourceStore) Update(id string, fn func(src *CustomSource) error) (CustomSource, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sources := st.load()
+	for i := range sources {
+		if sources[i].ID == id {
+			if err := fn(&sources[i]); err != nil {
+				return CustomSource{}, err
+			}
+			return sources[i], st.save(sources)
+		}
+	}
+	return CustomSource{}, errSourceNotFound
+}
+
+// Record notes a scrape of rawURL that saved eventCount events to file,
+// adding the source if it is new. A non-empty label renames it.
+func (st *SourceStore) Record(rawURL, label string, eventCount int, file, scrapedAt string) (CustomSource, error) {
+	canonical, err := canonicalURL(rawURL)
+	if err != nil {
+		return CustomSource{}, err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sources := st.load()
+
+	id := sourceID(canonical)
+	i := 0
+	for i < len(sources) && sources[i].ID != id {
+		i++
+	}
+	if i == len(sources) {
+		sources = append(sources, CustomSource{ID: id, CanonicalURL: canonical, FirstScrapedAt: scrapedAt})
+	}
+	src := &sources[i]
+	src.URL = rawURL
+	if label != "" {
+		src.Label = label
+	}
+	src.ScrapedAt = scrapedAt
+	src.EventCount = eventCount
+	src.ScrapeCount++
+	if file != "" {
+		src.Files = append(src.Files, file)
+	}
+	return *src, st.save(sources)
+}
+
+// Delete removes a source and the event files scraped from it.
+func (st *SourceStore) Delete(id string) (CustomSource, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sources := st.load()
+	for i, src := range sources {
+		if src.ID != id {
+			continue
+		}
+		for _, file := range src.Files {
+			if err := os.Remove(filepath.Join(st.dir, filepath.Base(file))); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to delete %s: %v", file, err)
+			}
+		}
+		return src, st.save(append(sources[:i], sources[i+1:]...))
+	}
+	return CustomSource{}, errSourceNotFound
+}
+
+// load reads the sources, merging the duplicate entries older versions
+// appended for every scrape of the same URL. Callers hold st.mu.
+func (st *SourceStore) load() []CustomSource {
+	data, err := os.ReadFile(st.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read sources: %v", err)
+		}
+		return []CustomSource{}
+	}
+	var stored []CustomSource
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("Failed to parse sources: %v", err)
+		return []CustomSource{}
+	}
+
+	sources := []CustomSource{}
+	index := make(map[string]int)
+	for _, src := range stored {
+		if src.ID == "" {
+			canonical, err := canonicalURL(src.URL)
+			if err != nil {
+				canonical = src.URL
+			}
+			src.CanonicalURL = canonical
+			src.ID = sourceID(canonical)
+			src.FirstScrapedAt = src.ScrapedAt
+			src.ScrapeCount = 1
+		}
+		i, ok := index[src.ID]
+		if !ok {
+			index[src.ID] = len(sources)
+			sources = append(sources, src)
+			continue
+		}
+		cur := &sources[i]
+		cur.ScrapeCount += src.ScrapeCount
+		cur.Files = append(cur.Files, src.Files...)
+		if storedTime(src.FirstScrapedAt).Before(storedTime(cur.FirstScrapedAt)) {
+			cur.FirstScrapedAt = src.FirstScrapedAt
+		}
+		if storedTime(src.ScrapedAt).After(storedTime(cur.ScrapedAt)) {
+			cur.URL, cur.ScrapedAt, cur.EventCount = src.URL, src.ScrapedAt, src.EventCount
+			if src.Label != "" {
+				cur.Label = src.Label
+			}
+		}
+	}
+	return sources
+}
+
+// save writes the sources atomically. Callers hold st.mu.
+func (st *SourceStore) save(sources []CustomSource) error {
+	if err := os.MkdirAll(st.dir, 0755); err != nil {
+		return err
+	}
+	data, _ := json.MarshalIndent(sources, "", "  ")
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"https://www.LAOpera.org/whats-on/", "https://laopera.org/whats-on"},
+		{"http://laopera.org:80/whats-on#season", "https://laopera.org/whats-on"},
+		{"https://laopera.org/whats-on?utm_source=mail&b=2&a=1&fbclid=x", "https://laopera.org/whats-on?a=1&b=2"},
+		{"https://laopera.org:8443/", "https://laopera.org:8443"},
+	}
+	for _, tt := range tests {
+		got, err := canonicalURL(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("canonicalURL(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := canonicalURL("ftp://laopera.org"); err == nil {
+		t.Error("ftp URL accepted")
+	}
+}
+
+func TestSourceStore(t *testing.T) {
+	dataDir := t.TempDir()
+	customDir := filepath.Join(dataDir, "data", "raw", "custom")
+	os.MkdirAll(customDir, 0755)
+	// Older versions appended an entry per scrape.
+	legacy := `[
+  {"url": "https://www.example.org/events/", "label": "", "scraped_at": "2026-01-01T10:00:00Z", "event_count": 3},
+  {"url": "https://example.org/events", "label": "Example", "scraped_at": "2026-02-01T10:00:00Z", "event_count": 5},
+  {"url": "https://other.org/", "label": "Other", "scraped_at": "2026-01-15T10:00:00Z", "event_count": 1}
+]`
+	os.WriteFile(filepath.Join(customDir, "sources.json"), []byte(legacy), 0644)
+	store := NewSourceStore(dataDir)
+
+	sources := store.List()
+	if len(sources) != 2 {
+		t.Fatalf("sources = %+v", sources)
+	}
+	src := sources[0]
+	if src.Label != "Example" || src.EventCount != 5 || src.ScrapeCount != 2 || src.FirstScrapedAt != "2026-01-01T10:00:00Z" || src.CanonicalURL != "https://example.org/events" {
+		t.Errorf("merged source = %+v", src)
+	}
+
+	os.WriteFile(filepath.Join(customDir, "x_1.json"), []byte("[]"), 0644)
+	recorded, err := store.Record("http://example.org/events?utm_campaign=spring", "", 7, "x_1.json", "2026-03-01T10:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.ID != src.ID || recorded.Label != "Example" || recorded.ScrapeCount != 3 || recorded.EventCount != 7 {
+		t.Errorf("recorded = %+v", recorded)
+	}
+	if found, ok := store.Lookup("https://example.org/events/"); !ok || found.ID != src.ID {
+		t.Errorf("Lookup = %+v, %v", found, ok)
+	}
+	if len(store.List()) != 2 {
+		t.Errorf("re-scrape added a source")
+	}
+
+	if _, err := store.Delete(src.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(customDir, "x_1.json")); !os.IsNotExist(err) {
+		t.Error("event file of deleted source kept")
+	}
+	if _, ok := store.Get(src.ID); ok {
+		t.Error("deleted source still there")
+	}
+	if _, err := store.Delete(src.ID); err != errSourceNotFound {
+		t.Errorf("second delete: %v", err)
+	}
+}
+
+func TestCustomSourceApply(t *testing.T) {
+	src := CustomSource{Label: "Opera Parallèle", Region: "norcal", City: "San Francisco", State: "CA"}
+	events := []PerformanceEvent{{Title: "Tosca", Region: "custom"}, {Title: "Carmen", Region: "custom", City: "Oakland", VenueName: "Paramount"}}
+	src.apply(events)
+	if events[0].Region != "norcal" || events[0].City != "San Francisco" || events[0].VenueName != "Opera Parallèle" {
+		t.Errorf("event 0 = %+v", events[0])
+	}
+	if events[1].City != "Oakland" || events[1].VenueName != "Paramount" || events[1].State != "CA" {
+		t.Errorf("event 1 = %+v", events[1])
+	}
+}
+
+func TestHandleSources(t *testing.T) {
+	dataDir := t.TempDir()
+	configPath := filepath.Join(dataDir, "config.yaml")
+	os.WriteFile(configPath, []byte(testConfigYAML), 0644)
+	s := NewServer(configPath, dataDir, "")
+	s.lookup = publicLookup
+	src, err := s.sources.Record("https://operaparallele.org/season", "Opera Parallele", 2, "", "2026-03-01T10:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if path == "/api/sources" {
+			s.handleSources(rec, req)
+		} else {
+			s.handleSource(rec, req)
+		}
+		return rec
+	}
+
+	rec := do("GET", "/api/sources", "")
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `"id":"`+src.ID+`"`) {
+		t.Errorf("GET sources: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("PUT", "/api/sources/"+src.ID, `{"label": "OP", "region": "atl"}`); rec.Code != 400 {
+		t.Errorf("PUT unknown region: %d, want 400", rec.Code)
+	}
+	if rec := do("PUT", "/api/sources/"+src.ID, `{"label": "`+strings.Repeat("x", maxJSONBodyBytes)+`"}`); rec.Code != 413 {
+		t.Errorf("PUT oversized: %d, want 413", rec.Code)
+	}
+	if rec := do("POST", "/api/sources/"+src.ID+"/promote", `{"code": "operaparallele", "name": "`+strings.Repeat("x", maxJSONBodyBytes)+`"}`); rec.Code != 413 {
+		t.Errorf("promote oversized: %d, want 413", rec.Code)
+	}
+	if rec := do("PUT", "/api/sources/"+src.ID, `{"label": "OP", "schedule": "often"}`); rec.Code != 400 {
+		t.Errorf("PUT bad schedule: %d, want 400", rec.Code)
+	}
+	rec = do("PUT", "/api/sources/"+src.ID, `{"label": "Opera Parallèle", "region": "SOCAL", "city": "San Francisco", "state": "CA", "schedule": "@weekly"}`)
+	var updated CustomSource
+	json.NewDecoder(rec.Body).Decode(&updated)
+	if rec.Code != 200 || updated.Region != "socal" || updated.Schedule != "@weekly" {
+		t.Errorf("PUT source: %d %+v", rec.Code, updated)
+	}
+	if st := s.scheduler.Status(); len(st.Entries) != 1 || st.Entries[0].Name != "source:"+src.ID {
+		t.Errorf("source schedule not picked up: %+v", st.Entries)
+	}
+	if rec := do("POST", "/api/sources/"+src.ID+"/scrape", ""); rec.Code != 503 {
+		t.Errorf("re-scrape without a browser: %d, want 503", rec.Code)
+	}
+
+	if rec := do("POST", "/api/sources/"+src.ID+"/promote", `{"code": "operaparallele", "calendar_url": "http://127.0.0.1/"}`); rec.Code != 422 {
+		t.Errorf("promote to a loopback calendar: %d, want 422", rec.Code)
+	}
+	if rec := do("POST", "/api/sources/"+src.ID+"/promote", `{}`); rec.Code != 400 {
+		t.Errorf("promote without code: %d, want 400", rec.Code)
+	}
+	rec = do("POST", "/api/sources/"+src.ID+"/promote", `{"code": "operaparallele"}`)
+	if rec.Code != 201 {
+		t.Fatalf("promote: %d %s", rec.Code, rec.Body)
+	}
+	cfg, _ := LoadConfig(configPath)
+	venue, ok := findVenue(cfg, "operaparallele")
+	if !ok || venue.Region != "socal" || venue.Name != "Opera Parallèle" || venue.City != "San Francisco" ||
+		venue.CalendarURL != "https://operaparallele.org/season" || venue.OfficialURL != "https://operaparallele.org" {
+		t.Errorf("promoted venue = %+v", venue)
+	}
+	if got, _ := s.sources.Get(src.ID); got.PromotedTo != "operaparallele" || got.Schedule != "" {
+		t.Errorf("source after promotion = %+v", got)
+	}
+	if rec := do("POST", "/api/sources/"+src.ID+"/promote", `{"code": "operaparallele"}`); rec.Code != 409 {
+		t.Errorf("promote twice: %d, want 409", rec.Code)
+	}
+
+	if rec := do("DELETE", "/api/sources/"+src.ID, ""); rec.Code != 204 {
+		t.Errorf("DELETE: %d", rec.Code)
+	}
+	if rec := do("GET", "/api/sources/"+src.ID, ""); rec.Code != 404 {
+		t.Errorf("GET deleted: %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// maxResponseBytes caps each response the browser receives while scraping
+// a URL given through the API.
+const maxResponseBytes = 20 << 20
+
+var errURLNotAllowed = errors.New("URL not allowed")
+
+// deniedHosts are refused whatever the config says: they name the machine
+// itself or a cloud metadata service.
+var deniedHosts = []string{"localhost", "metadata.google.internal", "metadata.goog", "instance-data.ec2.internal"}
+
+// blockedPrefixes are ranges, besides the private, loopback, link-local,
+// multicast and unspecified ones netip knows about, that are not on the
+// public internet.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, and broadcast
+}
+
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour   = netip.MustParsePrefix("2002::/16")
+)
+
+// URLGuard decides which URLs the browser may fetch, so that neither an API
+// caller nor a venue URL can point it at the server itself, the local
+// network or a cloud metadata endpoint. A URL must be http(s), its host
+// must not be denied and must be allowed if an allowlist is configured, and
+// every address it resolves to must be public.
+type URLGuard struct {
+	allow  []string
+	deny   []string
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+	client *http.Client
+}
+
+func NewURLGuard(cfg Config) *URLGuard {
+	g := &URLGuard{
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+		client: newGuardedClient(),
+	}
+	for _, h := range cfg.Scraping.URLPolicy.AllowHosts {
+		g.allow = append(g.allow, normalizeHost(h))
+	}
+	for _, h := range append(deniedHosts, cfg.Scraping.URLPolicy.DenyHosts...) {
+		g.deny = append(g.deny, normalizeHost(h))
+	}
+	return g
+}
+
+// normalizeHost lowercases a host name and drops a trailing dot.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// hostMatches reports whether host is one of patterns or a subdomain of one.
+func hostMatches(host string, patterns []string) bool {
+	for _, p := range patterns {
+		if host == p || strings.HasSuffix(host, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error wrapping errURLNotAllowed if rawURL may not be
+// fetched, or one from the resolver if its host cannot be resolved.
+func (g *URLGuard) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: not an http(s) URL", errURLNotAllowed)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials in URL", errURLNotAllowed)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%w: bad port %q", errURLNotAllowed, port)
+		}
+	}
+	host := normalizeHost(u.Hostname())
+	if hostMatches(host, g.deny) {
+		return fmt.Errorf("%w: host %s is denied", errURLNotAllowed, host)
+	}
+	if len(g.allow) > 0 && !hostMatches(host, g.allow) {
+		return fmt.Errorf("%w: host %s is not in scraping.url_policy.allow_hosts", errURLNotAllowed, host)
+	}
+
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if addrs, err = g.lookup(ctx, host); err != nil {
+			return fmt.Errorf("resolving %s: %w", host, err)
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("resolving %s: no addresses", host)
+		}
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			if addr.String() == host {
+				return fmt.Errorf("%w: %s is not a public address", errURLNotAllowed, host)
+			}
+			return fmt.Errorf("%w: %s resolves to non-public address %s", errURLNotAllowed, host, addr)
+		}
+	}
+	return nil
+}
+
+// publicAddr reports whether addr is on the public internet. IPv6
+// addresses that carry an IPv4 one (mapped, NAT64, 6to4) are judged by it.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.Is6() {
+		b := addr.As16()
+		switch {
+		case nat64Prefix.Contains(addr):
+			addr = netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]})
+		case sixToFour.Contains(addr):
+			addr = netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]})
+		}
+	}
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// newGuardedClient returns the client Route fetches with. Its dialer
+// refuses non-public addresses at connect time, so a host that resolved to
+// a public address for Check and to a private one a moment later is still
+// refused. Redirects are handed back to the browser, which requests the
+// next hop through Route again.
+func newGuardedClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: publicDialControl}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 4,
+		},
+		Timeout: 60 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicDialControl is a net.Dialer Control func that refuses to connect
+// to a non-public address.
+func publicDialControl(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: cannot parse address %s", errURLNotAllowed, address)
+	}
+	if !publicAddr(ap.Addr()) {
+		return fmt.Errorf("%w: connecting to non-public address %s", errURLNotAllowed, ap.Addr())
+	}
+	return nil
+}
+
+// Route makes page fetch everything, including sub-requests and frames,
+// through the guard: each request is checked, then sent by the guard's own
+// client rather than the browser, and responses over maxResponseBytes are
+// dropped. WebSockets are refused outright.
+func (g *URLGuard) Route(page playwright.Page) error {
+	if err := page.RouteWebSocket("**/*", func(ws playwright.WebSocketRoute) {
+		log.Printf("[scrape] Blocked WebSocket %s", ws.URL())
+		ws.Close()
+	}); err != nil {
+		return err
+	}
+	return page.Route("**/*", func(route playwright.Route) {
+		req := route.Request()
+		if strings.HasPrefix(req.URL(), "data:") || strings.HasPrefix(req.URL(), "blob:") {
+			route.Continue()
+			return
+		}
+		if err := g.Check(context.Background(), req.URL()); err != nil {
+			log.Printf("[scrape] Blocked %s: %v", req.URL(), err)
+			route.Abort("blockedbyclient")
+			return
+		}
+		status, headers, body, err := g.fetch(req)
+		if err != nil {
+			log.Printf("[scrape] Dropped %s: %v", req.URL(), err)
+			route.Abort("blockedbyclient")
+			return
+		}
+		route.Fulfill(playwright.RouteFulfillOptions{Status: playwright.Int(status), Headers: headers, Body: body})
+	})
+}
+
+// fetch sends the browser's request with the guard's client and reads at
+// most maxResponseBytes of the response.
+func (g *URLGuard) fetch(req playwright.Request) (int, map[string]string, []byte, error) {
+	postData, err := req.PostDataBuffer()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	var reqBody io.Reader
+	if len(postData) > 0 {
+		reqBody = bytes.NewReader(postData)
+	}
+	httpReq, err := http.NewRequest(req.Method(), req.URL(), reqBody)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	reqHeaders, err := req.AllHeaders()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	for name, value := range reqHeaders {
+		switch strings.ToLower(name) {
+		// The client sets these itself, and decompresses what it asked
+		// to be compressed.
+		case "host", "connection", "content-length", "accept-encoding":
+			continue
+		}
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if len(body) > maxResponseBytes {
+		return 0, nil, nil, fmt.Errorf("response over %d bytes", maxResponseBytes)
+	}
+
+	headers := make(map[string]string, len(resp.Header))
+	for name, values := range resp.Header {
+		sep := ", "
+		if strings.EqualFold(name, "Set-Cookie") {
+			sep = "\n"
+		}
+		headers[strings.ToLower(name)] = strings.Join(values, sep)
+	}
+	return resp.StatusCode, headers, body, nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errRegionNotFound = errors.New("region not found")
+	errVenueNotFound  = errors.New("venue not found")
+	errRegionExists   = errors.New("a region with this code already exists")
+	errVenueExists    = errors.New("a venue with this code already exists")
+	errRegionNotEmpty = errors.New("region still has venues; move or delete them first")
+	// Event files are named after region and venue codes, so renaming one
+	// would orphan its history.
+	errCodeChange = errors.New("code cannot be changed")
+)
+
+// ManagedVenue is a configured venue together with the region it is in.
+type ManagedVenue struct {
+	Region string `json:"region"`
+	VenueConfig
+}
+
+// listVenues returns every configured venue in config order, optionally
+// only those in region.
+func listVenues(cfg Config, region string) []ManagedVenue {
+	venues := []ManagedVenue{}
+	for _, r := range cfg.RegionalVenues.Regions {
+		if region != "" && !strings.EqualFold(r.Code, region) {
+			continue
+		}
+		for _, v := range r.Venues {
+			venues = append(venues, ManagedVenue{Region: r.Code, VenueConfig: v})
+		}
+	}
+	return venues
+}
+
+func findRegion(cfg Config, code string) (RegionConfig, bool) {
+	for _, r := range cfg.RegionalVenues.Regions {
+		if strings.EqualFold(r.Code, code) {
+			return r, true
+		}
+	}
+	return RegionConfig{}, false
+}
+
+func findVenue(cfg Config, code string) (ManagedVenue, bool) {
+	for _, v := range listVenues(cfg, "") {
+		if strings.EqualFold(v.Code, code) {
+			return v, true
+		}
+	}
+	return ManagedVenue{}, false
+}
+
+// ConfigDoc is config.yaml as a YAML tree. Regions and venues are edited in
+// place, so comments and settings the scraper does not read survive.
+type ConfigDoc struct {
+	root *yaml.Node
+}
+
+func ParseConfigDoc(data []byte) (*ConfigDoc, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	if root.Kind == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) != 1 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("config is not a YAML mapping")
+	}
+	return &ConfigDoc{root: &root}, nil
+}
+
+// Bytes renders the document laid out like config.yaml: a two-space indent
+// and a blank line between top-level sections and between regions, which
+// the YAML encoder would otherwise drop.
+func (d *ConfigDoc) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	prevIndent := 0
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		topLevel := indent == 0 && strings.TrimSpace(line) != ""
+		region := strings.HasPrefix(line, "    - ")
+		if topLevel && prevIndent > 0 || region && prevIndent > 4 {
+			out.WriteString("\n")
+		}
+		out.WriteString(line)
+		prevIndent = indent
+	}
+	return out.Bytes(), nil
+}
+
+// regions returns the regional_venues.regions sequence, creating it if
+// needed.
+func (d *ConfigDoc) regions() (*yaml.Node, error) {
+	rv := mappingValue(d.root.Content[0], "regional_venues")
+	if rv == nil {
+		rv = &yaml.Node{Kind: yaml.MappingNode}
+		setMappingValue(d.root.Content[0], "regional_venues", rv)
+	}
+	regions := mappingValue(rv, "regions")
+	if regions == nil || regions.Tag == "!!null" {
+		regions = &yaml.Node{Kind: yaml.SequenceNode}
+		setMappingValue(rv, "regions", regions)
+	}
+	if rv.Kind != yaml.MappingNode || regions.Kind != yaml.SequenceNode {
+		return nil, errors.New("regional_venues.regions is not a list")
+	}
+	return regions, nil
+}
+
+// region returns the index of the region with the given code, or -1.
+func (d *ConfigDoc) region(regions *yaml.Node, code string) int {
+	for i, r := range regions.Content {
+		if c := mappingValue(r, "code"); c != nil && strings.EqualFold(c.Value, code) {
+			return i
+		}
+	}
+	return -1
+}
+
+// venue returns the venue list holding the venue with the given code and
+// its index in it, or nil.
+func (d *ConfigDoc) venue(regions *yaml.Node, code string) (*yaml.Node, int) {
+	for _, r := range regions.Content {
+		venues := mappingValue(r, "venues")
+		if venues == nil || venues.Kind != yaml.SequenceNode {
+			continue
+		}
+		for i, v := range venues.Content {
+			if c := mappingValue(v, "code"); c != nil && strings.EqualFold(c.Value, code) {
+				return venues, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+func (d *ConfigDoc) AddRegion(region RegionConfig) error {
+	regions, err := d.regions()
+	if err != nil {
+		return err
+	}
+	if d.region(regions, region.Code) >= 0 {
+		return errRegionExists
+	}
+	for _, v := range region.Venues {
+		if venues, _ := d.venue(regions, v.Code); venues != nil {
+			return fmt.Errorf("venue %s: %w", v.Code, errVenueExists)
+		}
+	}
+	var n yaml.Node
+	if err := n.Encode(region); err != nil {
+		return err
+	}
+	regions.Content = append(regions.Content, &n)
+	return nil
+}
+
+// UpdateRegion replaces the settings of a region other than its venues,
+// which are managed one by one.
+func (d *ConfigDoc) UpdateRegion(code string, region RegionConfig) error {
+	regions, err := d.regions()
+	if err != nil {
+		return err
+	}
+	i := d.region(regions, code)
+	if i < 0 {
+		return errRegionNotFound
+	}
+	if region.Code == "" {
+		region.Code = mappingValue(regions.Content[i], "code").Value
+	} else if !strings.EqualFold(region.Code, code) {
+		return errCodeChange
+	}
+	region.Venues = nil
+	return mergeMapping(regions.Content[i], region, "venues")
+}
+
+func (d *ConfigDoc) DeleteRegion(code string) error {
+	regions, err := d.regions()
+	if err != nil {
+		return err
+	}
+	i := d.region(regions, code)
+	if i < 0 {
+		return errRegionNotFound
+	}
+	if venues := mappingValue(regions.Content[i], "venues"); venues != nil && len(venues.Content) > 0 {
+		return errRegionNotEmpty
+	}
+	regions.Content = append(regions.Content[:i], regions.Content[i+1:]...)
+	return nil
+}
+
+func (d *ConfigDoc) AddVenue(region string, venue VenueConfig) error {
+	regions, err := d.regions()
+	if err != nil {
+		return err
+	}
+	if venues, _ := d.venue(regions, venue.Code); venues != nil {
+		return errVenueExists
+	}
+	i := d.region(regions, region)
+	if i < 0 {
+		return errRegionNotFound
+	}
+	var n yaml.Node
+	if err := n.Encode(venue); err != nil {
+		return err
+	}
+	venues := venueList(regions.Content[i])
+	venues.Content = append(venues.Content, &n)
+	return nil
+}
+
+// venueList returns a region's venue sequence, creating it if needed, in
+// block style so venues added to an empty "venues: []" are laid out like
+// the rest.
+func venueList(region *yaml.Node) *yaml.Node {
+	venues := mappingValue(region, "venues")
+	if venues == nil || venues.Kind != yaml.SequenceNode {
+		venues = &yaml.Node{Kind: yaml.SequenceNode}
+		setMappingValue(region, "venues", venues)
+	}
+	venues.Style &^= yaml.FlowStyle
+	return venues
+}
+
+// UpdateVenue replaces a venue's settings, moving it to region if that is
+// not empty and not where the venue is now.
+func (d *ConfigDoc) UpdateVenue(code, region string, venue VenueConfig) error {
+	regions, err := d.regions()
+	if err != nil {
+		return err
+	}
+	venues, i := d.venue(regions, code)
+	if venues == nil {
+		return errVenueNotFound
+	}
+	if venue.Code == "" {
+		venue.Code = mappingValue(venues.Content[i], "code").Value
+	} else if !strings.EqualFold(venue.Code, code) {
+		return errCodeChange
+	}
+	n := venues.Content[i]
+	if err := mergeMapping(n, venue); err != nil {
+		return err
+	}
+	if region == "" {
+		return nil
+	}
+
+	r := d.region(regions, region)
+	if r < 0 {
+		return errRegionNotFound
+	}
+	target := venueList(regions.Content[r])
+	if target == venues {
+		return nil
+	}
+	venues.Content = append(venues.Content[:i], venues.Content[i+1:]...)
+	target.Content = append(target.Content, n)
+	return nil
+}
+
+func (d *ConfigDoc) DeleteVenue(code string) error {
+	regions, err := d.regions()
+	if err != nil {
+		return err
+	}
+	venues, i := d.venue(regions, code)
+	if venues == nil {
+		return errVenueNotFound
+	}
+	venues.Content = append(venues.Content[:i], venues.Content[i+1:]...)
+	return nil
+}
+
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func deleteMappingKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// mergeMapping sets the fields of v on the mapping m, removing those left
+// empty. Keys v's type does not know about, and those in keep, are left as
+// they are, along with the comments on keys that remain.
+func mergeMapping(m *yaml.Node, v interface{}, keep ...string) error {
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return err
+	}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" || containsFold(keep, key) {
+			continue
+		}
+		if value := mappingValue(&n, key); value != nil && value.Tag != "!!null" {
+			if old := mappingValue(m, key); old != nil && old.Kind == yaml.ScalarNode && value.Kind == yaml.ScalarNode {
+				// Keep the quoting style of the existing value.
+				value.Style = old.Style
+			}
+			setMappingValue(m, key, value)
+		} else {
+			deleteMappingKey(m, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigDocEdits(t *testing.T) {
+	// Laid out like config.yaml, with blank lines between sections.
+	source := "# Scraper settings\n" + strings.Replace(testConfigYAML, "regional_venues:", "\nregional_venues:", 1) +
+		"\nrate_limits:\n  wikidata:\n    requests_per_second: 2\n"
+	doc, err := ParseConfigDoc([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := doc.Bytes(); string(out) != source {
+		t.Fatalf("unchanged document rendered as\n%s", out)
+	}
+
+	if err := doc.AddRegion(RegionConfig{Name: "New Mexico", Code: "nm"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.AddRegion(RegionConfig{Code: "SOCAL"}); err != errRegionExists {
+		t.Errorf("duplicate region: %v", err)
+	}
+	if err := doc.AddVenue("nm", VenueConfig{Name: "Santa Fe Opera", Code: "santafeopera", OfficialURL: "https://www.santafeopera.org"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.AddVenue("socal", VenueConfig{Code: "santafeopera"}); err != errVenueExists {
+		t.Errorf("duplicate venue: %v", err)
+	}
+	if err := doc.AddVenue("atl", VenueConfig{Code: "atlanta"}); err != errRegionNotFound {
+		t.Errorf("venue in missing region: %v", err)
+	}
+	if err := doc.UpdateVenue("laopera", "nm", VenueConfig{Name: "LA Opera", CalendarURL: "https://www.laopera.org/by-date", City: "Los Angeles"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.UpdateVenue("laopera", "", VenueConfig{Code: "la"}); err != errCodeChange {
+		t.Errorf("code change: %v", err)
+	}
+	if err := doc.DeleteRegion("nm"); err != errRegionNotEmpty {
+		t.Errorf("deleting region with venues: %v", err)
+	}
+	if err := doc.UpdateRegion("socal", RegionConfig{Name: "SoCal", Schedule: "@daily"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.DeleteRegion("socal"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Scraper settings", "rate_limits:", "requests_per_second: 2"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("lost %q:\n%s", want, out)
+		}
+	}
+	cfg, problems := ParseConfig(out)
+	if len(problems) > 0 {
+		t.Fatalf("edited config invalid: %v\n%s", problems, out)
+	}
+	if got := targetCodes(mustTargets(t, cfg)); got != "nm/santafeopera,nm/laopera" {
+		t.Errorf("venues = %s", got)
+	}
+	venue, _ := findVenue(cfg, "laopera")
+	if venue.CalendarURL != "https://www.laopera.org/by-date" || venue.City != "Los Angeles" {
+		t.Errorf("updated venue = %+v", venue)
+	}
+}
+
+func mustTargets(t *testing.T, cfg Config) []scrapeTarget {
+	t.Helper()
+	targets, err := scrapeTargets(cfg, ScrapeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return targets
+}
+
+func TestHandleVenues(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(testConfigYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(configPath, dir, "")
+	s.lookup = publicLookup
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		switch {
+		case path == "/api/regions":
+			s.handleRegions(rec, req)
+		case strings.HasPrefix(path, "/api/regions/"):
+			s.handleRegion(rec, req)
+		case path == "/api/venues" || strings.HasPrefix(path, "/api/venues?"):
+			s.handleVenues(rec, req)
+		default:
+			s.handleVenue(rec, req)
+		}
+		return rec
+	}
+
+	if rec := do("POST", "/api/regions", `{"name": "Pacific Northwest", "code": "pnw"}`); rec.Code != 201 || rec.Header().Get("Location") != "/api/regions/pnw" {
+		t.Fatalf("POST region: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("POST", "/api/venues", `{"region": "pnw", "name": "Seattle Opera", "code": "seattleopera", "official_url": "seattleopera.org"}`); rec.Code != 422 {
+		t.Errorf("POST venue with bad URL: %d, want 422", rec.Code)
+	}
+	if rec := do("POST", "/api/venues", `{"region": "pnw", "name": "Seattle Opera", "code": "seattleopera", "official_url": "https://www.seattleopera.org", "city": "Seattle", "state": "WA"}`); rec.Code != 201 {
+		t.Fatalf("POST venue: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("POST", "/api/venues", `{"region": "socal", "name": "Copy", "code": "SeattleOpera", "official_url": "https://example.org"}`); rec.Code != 409 {
+		t.Errorf("POST duplicate venue: %d, want 409", rec.Code)
+	}
+	if rec := do("POST", "/api/venues", `{"region": "pnw", "name": "Metadata", "code": "metadata", "calendar_url": "http://169.254.169.254/latest/meta-data/"}`); rec.Code != 422 {
+		t.Errorf("POST venue at a link-local address: %d, want 422", rec.Code)
+	}
+	if rec := do("PUT", "/api/venues/seattleopera", `{"region": "pnw", "name": "Seattle Opera", "official_url": "http://localhost:8080/"}`); rec.Code != 422 {
+		t.Errorf("PUT venue on localhost: %d, want 422", rec.Code)
+	}
+	s.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) { return nil, errors.New("no such host") }
+	if rec := do("PUT", "/api/venues/seattleopera", `{"region": "pnw", "name": "Seattle Opera", "official_url": "https://unresolvable.example/"}`); rec.Code != 422 {
+		t.Errorf("PUT venue on an unresolvable host: %d, want 422", rec.Code)
+	}
+	s.lookup = publicLookup
+	if rec := do("POST", "/api/venues", `{"region": "pnw", "name": "`+strings.Repeat("x", maxJSONBodyBytes)+`"}`); rec.Code != 413 {
+		t.Errorf("POST oversized venue: %d, want 413", rec.Code)
+	}
+
+	rec := do("GET", "/api/venues?region=pnw", "")
+	var venues []ManagedVenue
+	json.NewDecoder(rec.Body).Decode(&venues)
+	if len(venues) != 1 || venues[0].Code != "seattleopera" || venues[0].Region != "pnw" || venues[0].State != "WA" {
+		t.Errorf("GET venues: %+v", venues)
+	}
+
+	rec = do("PUT", "/api/venues/seattleopera", `{"region": "socal", "name": "Seattle Opera", "official_url": "https://www.seattleopera.org"}`)
+	var venue ManagedVenue
+	json.NewDecoder(rec.Body).Decode(&venue)
+	if rec.Code != 200 || venue.Region != "socal" || venue.City != "" {
+		t.Errorf("PUT venue: %d %+v", rec.Code, venue)
+	}
+	if rec := do("DELETE", "/api/regions/socal", ""); rec.Code != 409 {
+		t.Errorf("DELETE non-empty region: %d, want 409", rec.Code)
+	}
+	if rec := do("DELETE", "/api/venues/seattleopera", ""); rec.Code != 204 {
+		t.Errorf("DELETE venue: %d", rec.Code)
+	}
+	if rec := do("GET", "/api/venues/seattleopera", ""); rec.Code != 404 {
+		t.Errorf("GET deleted venue: %d, want 404", rec.Code)
+	}
+	if rec := do("PUT", "/api/regions/pnw", `{"name": "Northwest", "schedule": "@weekly"}`); rec.Code != 200 || !strings.Contains(rec.Body.String(), `"schedule":"@weekly"`) {
+		t.Errorf("PUT region: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("PUT", "/api/regions/pnw", `{"name": "`+strings.Repeat("x", maxJSONBodyBytes)+`"}`); rec.Code != 413 {
+		t.Errorf("PUT oversized region: %d, want 413", rec.Code)
+	}
+	if rec := do("DELETE", "/api/regions/pnw", ""); rec.Code != 204 {
+		t.Errorf("DELETE empty region: %d", rec.Code)
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if !strings.HasPrefix(string(data), "scraping:\n  navigation:") || strings.Contains(string(data), "pnw") {
+		t.Errorf("config after edits:\n%s", data)
+	}
+	if _, err := os.Stat(configPath + ".bak"); err != nil {
+		t.Errorf("no backup: %v", err)
+	}
+}
@@ -5,13 +5,60 @@ import { StopIcon, PlayIcon, ReloadIcon, Cross2Icon, CheckCircledIcon, Exclamati
 interface StatusResponse {
     status: string
     logs?: string[]
+    job?: { id: string; state: string; done: number; total: number; events: number; error?: string }
+}
+
+interface ScrapeProgress {
+    seq: number
+    type: string
+    time: string
+    region?: string
+    venue?: string
+    url?: string
+    robots?: string
+    cache?: string
+    fetch_ms?: number
+    strikes?: number
+    events?: number
+    rejected?: number
+    state?: string
+    error?: string
+}
+
+const PROGRESS_TYPES = ['job_started', 'venue_started', 'robots', 'cache', 'fetched', 'strike', 'parsed', 'venue_finished', 'job_finished']
+
+function formatProgress(p: ScrapeProgress): string {
+    const time = p.time.slice(11, 19)
+    const where = p.venue ? `[${p.venue}] ` : ''
+    switch (p.type) {
+        case 'job_started': return `${time} Job started`
+        case 'venue_started': return `${time} ${where}Started`
+        case 'robots': return `${time} ${where}robots.txt: ${p.robots}`
+        case 'cache': return `${time} ${where}Cache ${p.cache}`
+        case 'fetched': return `${time} ${where}Fetched in ${p.fetch_ms ?? 0} ms`
+        case 'strike': return `${time} ${where}Strike ${p.strikes}: ${p.error}`
+        case 'parsed': return `${time} ${where}Parsed ${p.events ?? 0} events`
+        case 'venue_finished': return `${time} ${where}${p.error ? `Failed: ${p.error}` : `Saved ${p.events ?? 0} events`}`
+        case 'job_finished': return `${time} Job ${p.state}${p.error ? `: ${p.error}` : ''}, ${p.events ?? 0} events`
+        default: return `${time} ${where}${p.type}`
+    }
 }
 
 export function AdminPage({ onClose }: { onClose: () => void }) {
     const [config, setConfig] = useState('')
+    const [savedConfig, setSavedConfig] = useState('')
+    const [configEtag, setConfigEtag] = useState<string | null>(null)
+    const [configErrors, setConfigErrors] = useState<string[]>([])
+    const [configNotice, setConfigNotice] = useState<string | null>(null)
     const [status, setStatus] = useState('Unknown')
+    const [job, setJob] = useState<StatusResponse['job']>()
+    const [consoleLines, setConsoleLines] = useState<string[]>([])
     const [loading, setLoading] = useState(false)
     const [error, setError] = useState<string | null>(null)
+    const [needsLogin, setNeedsLogin] = useState(false)
+    const [username, setUsername] = useState('')
+    const [password, setPassword] = useState('')
+    const [loginError, setLoginError] = useState<string | null>(null)
 
     const API_BASE = `${import.meta.env.BASE_URL}api`
 
@@ -24,20 +71,50 @@ export function AdminPage({ onClose }: { onClose: () => void }) {
     const fetchConfig = async () => {
         try {
             const res = await fetch(`${API_BASE}/config`)
+            if (res.status === 401 || res.status === 403) {
+                setNeedsLogin(true)
+                return
+            }
             if (!res.ok) throw new Error('Failed to fetch config')
             const text = await res.text()
             setConfig(text)
+            setSavedConfig(text)
+            setConfigEtag(res.headers.get('ETag'))
+            setConfigErrors([])
         } catch (err) {
             setError('Could not load config. Ensure the scraper server (port 8080) is running.')
         }
     }
 
+    // Sign in as an admin when the server has auth enabled.
+    const login = async (e: React.FormEvent) => {
+        e.preventDefault()
+        setLoginError(null)
+        try {
+            const res = await fetch(`${API_BASE}/auth/login`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ username, password }),
+            })
+            if (!res.ok) {
+                setLoginError(res.status === 401 ? 'Wrong username or password' : await res.text())
+                return
+            }
+            setPassword('')
+            setNeedsLogin(false)
+            fetchConfig()
+        } catch (err) {
+            setLoginError('Could not reach the scraper server.')
+        }
+    }
+
     const fetchStatus = async () => {
         try {
             const res = await fetch(`${API_BASE}/status`)
             if (res.ok) {
                 const data: StatusResponse = await res.json()
                 setStatus(data.status)
+                setJob(data.job)
             } else {
                 setStatus('Disconnected')
             }
@@ -46,6 +123,56 @@ export function AdminPage({ onClose }: { onClose: () => void }) {
         }
     }
 
+    // Follow the running job's progress stream for the run console.
+    const runningJobId = status === 'Running' ? job?.id : undefined
+    useEffect(() => {
+        if (!runningJobId) return
+        setConsoleLines([])
+        const source = new EventSource(`${API_BASE}/jobs/${runningJobId}/events`)
+        const onProgress = (e: MessageEvent) => {
+            const line = formatProgress(JSON.parse(e.data))
+            setConsoleLines((lines) => [...lines.slice(-499), line])
+            if (e.type === 'job_finished') source.close()
+        }
+        PROGRESS_TYPES.forEach((t) => source.addEventListener(t, onProgress))
+        return () => source.close()
+    }, [runningJobId])
+
+    // Dry-run the edited config, or save it when it validates.
+    const submitConfig = async (save: boolean) => {
+        setConfigNotice(null)
+        try {
+            const headers: Record<string, string> = { 'Content-Type': 'application/yaml' }
+            if (save && configEtag) headers['If-Match'] = configEtag
+            const res = await fetch(save ? `${API_BASE}/config` : `${API_BASE}/config/validate`, {
+                method: save ? 'PUT' : 'POST',
+                headers,
+                body: config,
+            })
+            if (res.status === 412) {
+                setConfigErrors(['config.yaml was changed elsewhere since it was loaded. Reload it before saving.'])
+                return
+            }
+            if (res.headers.get('Content-Type')?.includes('application/json')) {
+                const result: { valid: boolean; errors: string[] } = await res.json()
+                setConfigErrors(result.errors)
+                if (!result.valid) return
+            } else if (!res.ok) {
+                setConfigErrors([await res.text()])
+                return
+            }
+            if (save) {
+                setSavedConfig(config)
+                setConfigEtag(res.headers.get('ETag'))
+                setConfigNotice('Saved and reloaded')
+            } else {
+                setConfigNotice('Config is valid')
+            }
+        } catch (err) {
+            setConfigErrors(['Could not reach the scraper server.'])
+        }
+    }
+
     const handleScrape = async () => {
         setLoading(true)
         try {
@@ -137,7 +264,9 @@ export function AdminPage({ onClose }: { onClose: () => void }) {
                                     <span>{statusText}</span>
                                 </div>
                                 {status === "Running" && (
-                                    <span className="text-xs text-slate-500 animate-pulse">Processing jobs...</span>
+                                    <span className="text-xs text-slate-500 animate-pulse">
+                                        {job ? `Scraped ${job.done} of ${job.total} venues, ${job.events} events...` : 'Processing jobs...'}
+                                    </span>
                                 )}
                             </div>
 
@@ -161,16 +290,70 @@ export function AdminPage({ onClose }: { onClose: () => void }) {
                                 <div className="lg:col-span-2 flex flex-col gap-4 h-full">
                                     <div className="flex items-center justify-between">
                                         <h3 className="text-sm font-medium text-slate-300">Configuration Source</h3>
-                                        <span className="text-xs font-mono text-slate-500">config.yaml</span>
+                                        <div className="flex items-center gap-2">
+                                            {configNotice && <span className="text-xs text-emerald-400">{configNotice}</span>}
+                                            <span className="text-xs font-mono text-slate-500">config.yaml{config !== savedConfig ? ' •' : ''}</span>
+                                            <button
+                                                onClick={fetchConfig}
+                                                className="px-2 py-1 text-xs rounded-md border border-white/10 text-slate-300 hover:bg-white/10"
+                                            >
+                                                Reload
+                                            </button>
+                                            <button
+                                                onClick={() => submitConfig(false)}
+                                                className="px-2 py-1 text-xs rounded-md border border-white/10 text-slate-300 hover:bg-white/10"
+                                            >
+                                                Validate
+                                            </button>
+                                            <button
+                                                onClick={() => submitConfig(true)}
+                                                disabled={config === savedConfig}
+                                                className="px-2 py-1 text-xs rounded-md bg-indigo-500 text-white hover:bg-indigo-400 disabled:opacity-50 disabled:cursor-not-allowed"
+                                            >
+                                                Save
+                                            </button>
+                                        </div>
                                     </div>
                                     <div className="flex-1 relative group">
                                         <div className="absolute inset-0 bg-gradient-to-b from-indigo-500/5 to-transparent rounded-xl pointer-events-none" />
                                         <textarea
                                             className="w-full h-full p-4 font-mono text-xs md:text-sm bg-[#0b1120] border border-white/10 rounded-xl text-slate-300 focus:ring-2 focus:ring-indigo-500/50 focus:border-indigo-500/50 outline-none resize-none shadow-inner leading-relaxed transition-all"
                                             value={config}
-                                            readOnly
+                                            onChange={(e) => {
+                                                setConfig(e.target.value)
+                                                setConfigNotice(null)
+                                            }}
                                             spellCheck={false}
                                         />
+                                        {needsLogin && (
+                                            <form onSubmit={login} className="absolute inset-0 flex flex-col items-center justify-center gap-3 bg-[#0b1120]/95 rounded-xl">
+                                                <p className="text-xs text-slate-400">Sign in as an admin to edit the config.</p>
+                                                <input
+                                                    className="w-64 px-3 py-2 text-sm bg-white/5 border border-white/10 rounded-lg text-slate-200 outline-none focus:ring-2 focus:ring-indigo-500/50"
+                                                    placeholder="Username"
+                                                    autoComplete="username"
+                                                    value={username}
+                                                    onChange={(e) => setUsername(e.target.value)}
+                                                />
+                                                <input
+                                                    className="w-64 px-3 py-2 text-sm bg-white/5 border border-white/10 rounded-lg text-slate-200 outline-none focus:ring-2 focus:ring-indigo-500/50"
+                                                    type="password"
+                                                    placeholder="Password"
+                                                    autoComplete="current-password"
+                                                    value={password}
+                                                    onChange={(e) => setPassword(e.target.value)}
+                                                />
+                                                <button type="submit" className="w-64 px-3 py-2 text-sm rounded-lg bg-indigo-500 text-white hover:bg-indigo-400">
+                                                    Sign in
+                                                </button>
+                                                {loginError && <span className="text-xs text-rose-400">{loginError}</span>}
+                                            </form>
+                                        )}
+                                        {configErrors.length > 0 && (
+                                            <ul className="absolute top-4 left-4 right-4 max-h-40 overflow-auto p-3 bg-rose-500/10 border border-rose-500/20 text-rose-300 text-xs rounded-lg backdrop-blur-md list-disc list-inside">
+                                                {configErrors.map((e) => <li key={e}>{e}</li>)}
+                                            </ul>
+                                        )}
                                         {error && (
                                             <div className="absolute bottom-4 left-4 right-4 p-3 bg-rose-500/10 border border-rose-500/20 text-rose-400 text-xs rounded-lg backdrop-blur-md">
                                                 Error: {error}
@@ -197,6 +380,15 @@ export function AdminPage({ onClose }: { onClose: () => void }) {
                                         </div>
                                     </div>
 
+                                    {consoleLines.length > 0 && (
+                                        <div className="flex flex-col gap-2 min-h-0">
+                                            <h3 className="text-sm font-medium text-slate-300">Run Console</h3>
+                                            <pre className="max-h-64 overflow-auto p-3 font-mono text-[11px] leading-relaxed bg-[#0b1120] border border-white/10 rounded-xl text-slate-400 whitespace-pre-wrap">
+                                                {consoleLines.join('\n')}
+                                            </pre>
+                                        </div>
+                                    )}
+
                                     <div className="mt-auto p-4 rounded-xl bg-indigo-500/10 border border-indigo-500/20">
                                         <h4 className="text-xs font-bold text-indigo-300 mb-2 uppercase tracking-wide">Pro Tip</h4>
                                         <p className="text-xs text-indigo-200/70 leading-relaxed">
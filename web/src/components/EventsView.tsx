@@ -11,7 +11,7 @@ const REGIONS: Record<string, string> = {
 }
 
 export function EventsView() {
-  const { events, loading, error, loadEvents } = useEventsStore()
+  const { events, total, nextCursor, loading, error, loadEvents, loadMoreEvents } = useEventsStore()
   const [region, setRegion] = useState('')
 
   useEffect(() => {
@@ -40,7 +40,7 @@ export function EventsView() {
           </select>
         </div>
 
-        {loading && (
+        {loading && events.length === 0 && (
           <div className="text-center py-12 text-[color:var(--c-muted)]">
             Loading events...
           </div>
@@ -67,10 +67,10 @@ export function EventsView() {
           </div>
         )}
 
-        {!loading && events.length > 0 && (
+        {events.length > 0 && (
           <div className="space-y-2">
             <div className="text-xs text-[color:var(--c-muted-2)] mb-3">
-              {events.length} event{events.length !== 1 ? 's' : ''} found
+              {total} upcoming event{total !== 1 ? 's' : ''} found
             </div>
             {events.map((event, i) => (
               <div
@@ -123,6 +123,15 @@ export function EventsView() {
                 </div>
               </div>
             ))}
+            {nextCursor && (
+              <button
+                onClick={() => loadMoreEvents()}
+                disabled={loading}
+                className="w-full text-xs py-2 rounded-lg border border-[color:var(--c-border)] text-[color:var(--c-muted)] hover:text-[color:var(--c-text)] hover:border-[color:var(--c-accent)]/30 transition-colors disabled:opacity-50"
+              >
+                {loading ? 'Loading...' : `Load more (${events.length} of ${total})`}
+              </button>
+            )}
           </div>
         )}
       </div>
@@ -1,7 +1,9 @@
 import { useMemo, useState, useRef, useEffect } from 'react'
 import { useFilterStore } from '@/store/filterStore'
 import { useGraphStore } from '@/store/graphStore'
+import { useSelectionStore } from '@/store/selectionStore'
 import { ERA_COLORS } from '@/types/graph'
+import type { SearchResult } from '@/types/graph'
 
 const ERAS = ['Baroque', 'Classical', 'Early Romantic', 'Late Romantic', '20th Century', 'Contemporary']
 
@@ -24,12 +26,47 @@ export default function FilterBar() {
 
   const [composerDropdownOpen, setComposerDropdownOpen] = useState(false)
   const dropdownRef = useRef<HTMLDivElement>(null)
+  const searchRef = useRef<HTMLDivElement>(null)
+  const { setSelected } = useSelectionStore()
+
+  // Server-side search across events, venues and graph nodes. Without a
+  // server (e.g. the static demo) the query only filters the graph.
+  const [searchResults, setSearchResults] = useState<SearchResult[]>([])
+  useEffect(() => {
+    if (searchQuery.trim().length < 2) {
+      setSearchResults([])
+      return
+    }
+    const controller = new AbortController()
+    const timer = setTimeout(() => {
+      fetch(`${import.meta.env.BASE_URL}api/search?q=${encodeURIComponent(searchQuery)}&limit=8`, { signal: controller.signal })
+        .then((res) => (res.ok ? res.json() : { results: [] }))
+        .then((data: { results: SearchResult[] }) => setSearchResults(data.results))
+        .catch(() => {})
+    }, 200)
+    return () => {
+      clearTimeout(timer)
+      controller.abort()
+    }
+  }, [searchQuery])
+
+  const openResult = (r: SearchResult) => {
+    if (r.node_key) {
+      setSelected(new Set([r.node_key]), 'filter')
+    } else if (r.url) {
+      window.open(r.url, '_blank', 'noopener')
+    }
+    setSearchResults([])
+  }
 
   useEffect(() => {
     function handleClickOutside(e: MouseEvent) {
       if (dropdownRef.current && !dropdownRef.current.contains(e.target as Node)) {
         setComposerDropdownOpen(false)
       }
+      if (searchRef.current && !searchRef.current.contains(e.target as Node)) {
+        setSearchResults([])
+      }
     }
     document.addEventListener('mousedown', handleClickOutside)
     return () => document.removeEventListener('mousedown', handleClickOutside)
@@ -57,13 +94,32 @@ export default function FilterBar() {
   return (
     <div className="flex items-center gap-4 px-4 py-2 bg-[color:var(--c-panel)] border-b border-[color:var(--c-border)] overflow-x-auto">
       {/* Search */}
-      <input
-        type="text"
-        placeholder="Search operas..."
-        value={searchQuery}
-        onChange={(e) => setSearchQuery(e.target.value)}
-        className="bg-[color:var(--c-panel-2)] text-[color:var(--c-text)] placeholder:text-[color:var(--c-muted-2)] text-sm px-3 py-1.5 rounded border border-[color:var(--c-border)] focus:border-[color:var(--c-accent)] focus:outline-none w-48"
-      />
+      <div className="relative flex-shrink-0" ref={searchRef}>
+        <input
+          type="text"
+          placeholder="Search operas..."
+          value={searchQuery}
+          onChange={(e) => setSearchQuery(e.target.value)}
+          className="bg-[color:var(--c-panel-2)] text-[color:var(--c-text)] placeholder:text-[color:var(--c-muted-2)] text-sm px-3 py-1.5 rounded border border-[color:var(--c-border)] focus:border-[color:var(--c-accent)] focus:outline-none w-48"
+        />
+        {searchResults.length > 0 && (
+          <div className="absolute top-full left-0 mt-1 bg-[color:var(--c-panel)] border border-[color:var(--c-border)] rounded shadow-[var(--shadow-panel)] z-50 max-h-72 overflow-y-auto w-72">
+            {searchResults.map((r) => (
+              <button
+                key={`${r.type}:${r.id}`}
+                onClick={() => openResult(r)}
+                className="w-full text-left px-3 py-1.5 hover:bg-[color:var(--c-panel-2)]"
+              >
+                <div className="flex items-center gap-2">
+                  <span className="text-sm text-[color:var(--c-text)] truncate">{r.label}</span>
+                  <span className="ml-auto text-[10px] uppercase tracking-wider text-[color:var(--c-muted-2)] flex-shrink-0">{r.type}</span>
+                </div>
+                {r.detail && <div className="text-[11px] text-[color:var(--c-muted)] truncate">{r.detail}</div>}
+              </button>
+            ))}
+          </div>
+        )}
+      </div>
 
       {/* Composer multi-select */}
       <div className="relative flex-shrink-0" ref={dropdownRef}>
@@ -1,18 +1,18 @@
 import { useEffect, useState } from 'react'
-import type { PerformanceEvent } from '@/types/graph'
+import type { EventPage, PerformanceEvent } from '@/types/graph'
 
 export function NowPlaying({ onViewAll }: { onViewAll: () => void }) {
   const [events, setEvents] = useState<PerformanceEvent[]>([])
   const [loaded, setLoaded] = useState(false)
 
   useEffect(() => {
-    fetch(`${import.meta.env.BASE_URL}api/events`)
+    fetch(`${import.meta.env.BASE_URL}api/events?limit=5`)
       .then((res) => {
         if (!res.ok) throw new Error('not available')
         return res.json()
       })
-      .then((data: PerformanceEvent[]) => {
-        setEvents(data.slice(0, 5))
+      .then((page: EventPage) => {
+        setEvents(page.events)
         setLoaded(true)
       })
       .catch(() => {
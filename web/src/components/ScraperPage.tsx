@@ -4,7 +4,7 @@ import { useEventsStore } from '@/store/eventsStore'
 export function ScraperPage({ onClose }: { onClose: () => void }) {
   const [url, setUrl] = useState('')
   const [label, setLabel] = useState('')
-  const { scraping, error, scrapeResult, sources, scrapeUrl, loadSources, clearError } = useEventsStore()
+  const { scraping, error, scrapeResult, sources, scrapeUrl, loadSources, rescrapeSource, deleteSource, clearError } = useEventsStore()
 
   useEffect(() => {
     loadSources()
@@ -144,16 +144,37 @@ export function ScraperPage({ onClose }: { onClose: () => void }) {
                 Scraped Sources ({sources.length})
               </h2>
               <div className="space-y-2">
-                {sources.map((source, i) => (
-                  <div key={i} className="p-3 rounded-lg bg-[color:var(--c-panel-2)] border border-[color:var(--c-border)] flex items-center justify-between">
+                {sources.map((source) => (
+                  <div key={source.id} className="p-3 rounded-lg bg-[color:var(--c-panel-2)] border border-[color:var(--c-border)] flex items-center justify-between">
                     <div className="min-w-0">
                       <div className="text-xs font-medium text-[color:var(--c-text)] truncate">{source.label || source.url}</div>
                       <div className="text-[10px] text-[color:var(--c-muted-2)] truncate">{source.url}</div>
+                      {source.promoted_to && (
+                        <div className="text-[10px] text-emerald-500">Promoted to venue {source.promoted_to}</div>
+                      )}
                     </div>
                     <div className="text-right flex-shrink-0 ml-3">
                       <div className="text-xs text-[color:var(--c-text)]">{source.event_count} events</div>
                       <div className="text-[10px] text-[color:var(--c-muted-2)]">
                         {new Date(source.scraped_at).toLocaleDateString()}
+                        {source.scrape_count > 1 ? ` · ${source.scrape_count} scrapes` : ''}
+                      </div>
+                      <div className="flex justify-end gap-2 mt-1">
+                        <button
+                          onClick={() => rescrapeSource(source.id)}
+                          disabled={scraping}
+                          className="text-[10px] text-[color:var(--c-muted)] hover:text-[color:var(--c-text)] disabled:opacity-50"
+                        >
+                          Re-scrape
+                        </button>
+                        <button
+                          onClick={() => {
+                            if (confirm(`Delete ${source.label || source.url} and its events?`)) deleteSource(source.id)
+                          }}
+                          className="text-[10px] text-rose-400 hover:text-rose-300"
+                        >
+                          Delete
+                        </button>
                       </div>
                     </div>
                   </div>
@@ -1,23 +1,32 @@
 import { create } from 'zustand'
-import type { PerformanceEvent, CustomSource } from '@/types/graph'
+import type { PerformanceEvent, CustomSource, EventPage } from '@/types/graph'
 
 const API_BASE = `${import.meta.env.BASE_URL}api`
 
 interface EventsState {
   events: PerformanceEvent[]
+  total: number
+  nextCursor: string | null
+  region: string | undefined
   sources: CustomSource[]
   loading: boolean
   scraping: boolean
   error: string | null
   scrapeResult: { events: PerformanceEvent[]; strategy: string; count: number } | null
   loadEvents: (region?: string) => Promise<void>
+  loadMoreEvents: () => Promise<void>
   loadSources: () => Promise<void>
   scrapeUrl: (url: string, label: string) => Promise<void>
+  rescrapeSource: (id: string) => Promise<void>
+  deleteSource: (id: string) => Promise<void>
   clearError: () => void
 }
 
-export const useEventsStore = create<EventsState>((set) => ({
+export const useEventsStore = create<EventsState>((set, get) => ({
   events: [],
+  total: 0,
+  nextCursor: null,
+  region: undefined,
   sources: [],
   loading: false,
   scraping: false,
@@ -25,13 +34,29 @@ export const useEventsStore = create<EventsState>((set) => ({
   scrapeResult: null,
 
   loadEvents: async (region?: string) => {
-    set({ loading: true, error: null })
+    set({ loading: true, error: null, region })
     try {
       const params = region ? `?region=${encodeURIComponent(region)}` : ''
       const res = await fetch(`${API_BASE}/events${params}`)
       if (!res.ok) throw new Error(`Failed to load events: ${res.statusText}`)
-      const events = await res.json()
-      set({ events, loading: false })
+      const page: EventPage = await res.json()
+      set({ events: page.events, total: page.total, nextCursor: page.next_cursor ?? null, loading: false })
+    } catch (e) {
+      set({ error: (e as Error).message, loading: false })
+    }
+  },
+
+  loadMoreEvents: async () => {
+    const { nextCursor, region, events } = get()
+    if (!nextCursor) return
+    set({ loading: true, error: null })
+    try {
+      const params = new URLSearchParams({ cursor: nextCursor })
+      if (region) params.set('region', region)
+      const res = await fetch(`${API_BASE}/events?${params}`)
+      if (!res.ok) throw new Error(`Failed to load events: ${res.statusText}`)
+      const page: EventPage = await res.json()
+      set({ events: [...events, ...page.events], total: page.total, nextCursor: page.next_cursor ?? null, loading: false })
     } catch (e) {
       set({ error: (e as Error).message, loading: false })
     }
@@ -67,5 +92,29 @@ export const useEventsStore = create<EventsState>((set) => ({
     }
   },
 
+  // Starts a background job; the source list is refreshed once it is queued.
+  rescrapeSource: async (id: string) => {
+    try {
+      const res = await fetch(`${API_BASE}/sources/${encodeURIComponent(id)}/scrape`, { method: 'POST' })
+      if (!res.ok) {
+        const text = await res.text()
+        throw new Error(text || `Re-scrape failed: ${res.statusText}`)
+      }
+      await get().loadSources()
+    } catch (e) {
+      set({ error: (e as Error).message })
+    }
+  },
+
+  deleteSource: async (id: string) => {
+    try {
+      const res = await fetch(`${API_BASE}/sources/${encodeURIComponent(id)}`, { method: 'DELETE' })
+      if (!res.ok) throw new Error(`Delete failed: ${res.statusText}`)
+      set({ sources: get().sources.filter((s) => s.id !== id) })
+    } catch (e) {
+      set({ error: (e as Error).message })
+    }
+  },
+
   clearError: () => set({ error: null }),
 }))
@@ -88,11 +88,78 @@ export interface PerformanceEvent {
   scraped_at: string
   matched_opera_key?: string
   match_confidence?: number
+  strategy?: string
+  confidence?: number
+  confidence_reasons?: string[]
+  composer_sources?: Record<string, string>
+  composer_conflict?: boolean
+  first_seen_at?: string
+  cast?: string[]
+}
+
+export interface EventSnapshot {
+  event: string
+  file: string
+  scraped_at: string
+  opera_title: string
+  dates: string[]
+  source_url: string
+}
+
+export interface EventDetail extends PerformanceEvent {
+  id: string
+  production_id: string
+  history: EventSnapshot[]
+}
+
+export interface Production {
+  id: string
+  venue_code: string
+  venue_name: string
+  city: string
+  state: string
+  region: string
+  opera_title: string
+  composer: string
+  matched_opera_key?: string
+  dates: string[]
+  source_urls: string[]
+  first_seen_at?: string
+  events: string[]
+  history: EventSnapshot[]
+  opera?: { key: string; attributes: Partial<GraphNode['attributes']> }
+}
+
+export interface SearchResult {
+  type: string
+  id: string
+  label: string
+  detail?: string
+  node_key?: string
+  url?: string
+  score: number
+  fields: string[]
+}
+
+export interface EventPage {
+  events: PerformanceEvent[]
+  total: number
+  next_cursor?: string
 }
 
 export interface CustomSource {
+  id: string
   url: string
+  canonical_url: string
   label: string
+  region?: string
+  city?: string
+  state?: string
+  schedule?: string
   scraped_at: string
+  first_scraped_at?: string
   event_count: number
+  scrape_count: number
+  files?: string[]
+  promoted_to?: string
 }